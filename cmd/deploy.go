@@ -95,6 +95,11 @@ func deployChanges(m *runtime.Manager, p *runtime.ProgInfo, isWatcher bool) erro
 		return err
 	}
 
+	err = m.ValidateRuntime()
+	if err != nil {
+		return err
+	}
+
 	dc, err := m.GetDepChanges()
 	if err != nil {
 		return err
@@ -125,7 +130,10 @@ func deployChanges(m *runtime.Manager, p *runtime.ProgInfo, isWatcher bool) erro
 
 		msg := "Successfully deployed changes"
 		fmt.Println(msg)
-		m.StoreState()
+		err = m.UpdateState(c)
+		if err != nil {
+			fmt.Printf("failed to update local state of the files,\nfurther calls to `deta deploy` might lead to unexpected behaviour\n")
+		}
 	}
 
 	if dc != nil {
@@ -102,13 +102,18 @@ func update(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
-		for k := range envChanges.Vars {
+		if progInfo.Env == nil {
+			progInfo.Env = make(map[string]string)
+		}
+		for k, v := range envChanges.Vars {
 			if !inSlice(progInfo.Envs, k) {
 				progInfo.Envs = append(progInfo.Envs, k)
 			}
+			progInfo.Env[k] = runtime.HashEnvValue(v)
 		}
 		for _, d := range envChanges.Removed {
 			progInfo.Envs = removeFromSlice(progInfo.Envs, d)
+			delete(progInfo.Env, d)
 		}
 		runtimeManager.StoreProgInfo(progInfo)
 
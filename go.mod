@@ -3,6 +3,7 @@ module github.com/deta/deta-cli
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/aws/aws-sdk-go v1.32.6
 	github.com/rjeczalik/notify v0.9.2
 	github.com/spf13/cobra v1.0.0
@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// CompareWith compares the files of the root dir with the files of the root dir of other by relative path and checksum
+// eg: to diff a staging and a production copy of a program before promoting one over the other
+// the changes are the changes to turn the files of other into the files of m: files only in m or with different contents
+// are in Changes or BinaryFiles with the contents in m, files with different contents are also in Differing
+// and files only in other are in Deletions, returns nil if the files are the same
+// both managers should skip the same files, so runtimes must match and other ignore rules are warned about
+// checksums of both are calculated with the settings of m eg: SetNormalizeEOL
+func (m *Manager) CompareWith(other *Manager) (*StateChanges, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+	otherRuntime, err := other.GetRuntime()
+	if err != nil {
+		return nil, fmt.Errorf("getting runtime of %s: %w", other.rootDir, err)
+	}
+	if r.Name != otherRuntime.Name {
+		return nil, fmt.Errorf("%w: %s runtime of %s and %s runtime of %s", ErrRuntimeMismatch, r.Name, m.rootDir, otherRuntime.Name, other.rootDir)
+	}
+	if !m.sameFilters(other, r.Name) {
+		m.warn("ignore rules of %s and %s differ, files skipped in only one of them are reported as changes", m.rootDir, other.rootDir)
+	}
+
+	otherFiles := make(map[string]string)
+	err = other.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := other.relPath(filepath.Join(other.rootDir, path))
+		if err != nil {
+			return err
+		}
+		otherFiles[m.stateKey(slash)] = slash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &StateChanges{
+		Changes:     make(map[string]string),
+		BinaryFiles: make(map[string]string),
+		Sizes:       make(map[string]int64),
+	}
+	err = m.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		otherPath, ok := otherFiles[m.stateKey(slash)]
+		if ok {
+			delete(otherFiles, m.stateKey(slash))
+			checksum, err := m.calcChecksum(filepath.Join(m.rootDir, path))
+			if err != nil {
+				return err
+			}
+			otherContents, err := other.readProgFile(filepath.Join(other.rootDir, filepath.FromSlash(otherPath)))
+			if err != nil {
+				return err
+			}
+			if checksum == m.checksumOf(path, otherContents) {
+				return nil
+			}
+			sc.Differing = append(sc.Differing, slash)
+		}
+		contents, isBinary, err := m.readFileIsBinary(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if isBinary {
+			sc.BinaryFiles[slash] = base64.StdEncoding.EncodeToString(contents)
+		} else {
+			sc.Changes[slash] = string(contents)
+		}
+		sc.Sizes[slash] = int64(len(contents))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sc.Deletions = []string{}
+	for _, path := range otherFiles {
+		sc.Deletions = append(sc.Deletions, path)
+	}
+	sort.Strings(sc.Deletions)
+	sort.Strings(sc.Differing)
+	if sc.isEmpty() {
+		return nil, nil
+	}
+	return sc, nil
+}
+
+// checks if m and other skip the same files of the runtime by patterns of the ignore file, the config and hidden files
+func (m *Manager) sameFilters(other *Manager, runtime string) bool {
+	patterns := func(ps []Pattern) []string {
+		var s []string
+		for _, p := range ps {
+			s = append(s, fmt.Sprintf("%t:%s", p.Skip, p.Value))
+		}
+		return s
+	}
+	return reflect.DeepEqual(patterns(m.skipPaths[runtime]), patterns(other.skipPaths[runtime])) &&
+		reflect.DeepEqual(patterns(m.ignorePatterns), patterns(other.ignorePatterns)) &&
+		reflect.DeepEqual(m.config.Ignore, other.config.Ignore) &&
+		reflect.DeepEqual(m.config.Prune, other.config.Prune) &&
+		reflect.DeepEqual(m.includeHidden, other.includeHidden) &&
+		reflect.DeepEqual(m.dockerPatterns, other.dockerPatterns)
+}
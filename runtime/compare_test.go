@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCompareWith(t *testing.T) {
+	staging := newTestManager(t, map[string]string{
+		"main.py":         "print('v2')",
+		"lib/utils.py":    "def f(): pass",
+		"lib/new.py":      "new = 1",
+		"static/logo.png": "png\x00v2",
+		".env":            "KEY=staging",
+	})
+	production := newTestManager(t, map[string]string{
+		"main.py":         "print('v1')",
+		"lib/utils.py":    "def f(): pass",
+		"lib/old.py":      "old = 1",
+		"static/logo.png": "png\x00v1",
+		".env":            "KEY=production",
+	})
+
+	sc, err := staging.CompareWith(production)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/new.py", "main.py", "static/logo.png"})
+	assert.Equal(t, sc.Changes["main.py"], "print('v2')")
+	assert.DeepEqual(t, sc.Differing, []string{"main.py", "static/logo.png"})
+	assert.DeepEqual(t, sc.Deletions, []string{"lib/old.py"})
+	assert.Equal(t, len(staging.Warnings()), 0)
+
+	// the other way around
+	sc, err = production.CompareWith(staging)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/old.py", "main.py", "static/logo.png"})
+	assert.DeepEqual(t, sc.Deletions, []string{"lib/new.py"})
+
+	// the same files
+	left := newTestManager(t, map[string]string{"main.py": "print('v2')", "lib/utils.py": "def f(): pass"})
+	right := newTestManager(t, map[string]string{"main.py": "print('v2')", "lib/utils.py": "def f(): pass"})
+	sc, err = left.CompareWith(right)
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// different ignore rules are warned about
+	ignoring := newTestManager(t, map[string]string{"main.py": "print('v2')", "lib/utils.py": "def f(): pass", ignoreFile: "lib"})
+	sc, err = left.CompareWith(ignoring)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/utils.py"})
+	assert.Equal(t, len(left.Warnings()), 1)
+	assert.Assert(t, strings.HasPrefix(left.Warnings()[0], "ignore rules of"))
+
+	node := newTestManager(t, map[string]string{"index.js": ""})
+	_, err = left.CompareWith(node)
+	assert.Assert(t, errors.Is(err, ErrRuntimeMismatch))
+}
@@ -0,0 +1,158 @@
+package runtime
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	configFile = "config.json"
+
+	// hashers for checksums of files
+	hasherSHA256 = "sha256"
+	hasherSHA1   = "sha1"
+	hasherSHA512 = "sha512"
+)
+
+// Config per program settings of the walk stored in .deta/config.json
+// unknown fields are ignored
+type Config struct {
+	Ignore        []string `json:"ignore"`         // globs of paths relative to the root dir that are skipped eg: docs/**, *.log
+	Prune         []string `json:"prune"`          // names or globs of dir names that are not walked into eg: build
+	IncludeHidden []string `json:"include_hidden"` // hidden files or dirs that are not skipped eg: .env.example
+	Hasher        string   `json:"hasher"`         // hash used for checksums of files: sha256(default), sha1 or sha512
+	// maps names of entrypoint files in the root dir to runtimes eg: {"app.py": "python"}
+	// overrides built in entrypoints and is preferred over them
+	Entrypoints map[string]string `json:"entrypoints"`
+}
+
+// loads the config from the deta dir, an absent config is an empty config
+func (m *Manager) loadConfig() error {
+	contents, err := m.readFile(filepath.Join(m.detaPath, configFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var c Config
+	err = json.Unmarshal(contents, &c)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", configFile, err)
+	}
+	if _, err := newHasher(c.Hasher); err != nil {
+		return fmt.Errorf("reading %s: %w", configFile, err)
+	}
+	for _, name := range sortedKeys(c.Entrypoints) {
+		runtime := c.Entrypoints[name]
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("reading %s: entrypoint '%s' is not a file name in the root dir", configFile, name)
+		}
+		if _, ok := runtimes[runtime]; !ok {
+			return fmt.Errorf("reading %s: entrypoint '%s' maps to unknown runtime '%s'", configFile, name, runtime)
+		}
+		if builtin, _, ok := entrypointRuntime(name); ok && builtin != runtime {
+			m.warn("entrypoint %s of %s maps to the %s runtime instead of the %s runtime", name, configFile, runtime, builtin)
+		}
+	}
+	// validate patterns so a bad pattern does not silently skip nothing
+	for _, p := range c.Ignore {
+		if _, err := matchGlob(p, ""); err != nil {
+			return fmt.Errorf("reading %s: invalid ignore pattern '%s': %w", configFile, p, err)
+		}
+	}
+	for _, p := range c.Prune {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("reading %s: invalid prune pattern '%s': %w", configFile, p, err)
+		}
+	}
+
+	m.config = c
+	m.includeHidden = append(m.includeHidden, c.IncludeHidden...)
+	return nil
+}
+
+// returns a new hash for the hasher name, sha256 if name is empty
+func newHasher(name string) (hash.Hash, error) {
+	switch name {
+	case "", hasherSHA256:
+		return sha256.New(), nil
+	case hasherSHA1:
+		return sha1.New(), nil
+	case hasherSHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hasher '%s'", name)
+}
+
+// checksum returns the checksum of contents with the configured hasher
+func (m *Manager) checksum(contents []byte) string {
+	h, err := newHasher(m.config.Hasher)
+	if err != nil {
+		// the hasher is validated when the config is loaded
+		h = sha256.New()
+	}
+	if m.normalizeEOL && !isBinary(contents) {
+		contents = normalizeText(contents, m.trimTrailing)
+	}
+	h.Write(contents)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// checksumOf returns the checksum of contents of the file in path relative to the root dir
+// json dependency files are canonicalized first if set by SetCanonicalJSON
+func (m *Manager) checksumOf(path string, contents []byte) string {
+	if m.canonicalJSON && strings.EqualFold(filepath.Ext(path), ".json") && isAnyDepFile(path) {
+		if canonical, err := canonicalizeJSON(contents); err == nil {
+			contents = canonical
+		} else {
+			m.debugf("hashing %s as is: %v", filepath.ToSlash(path), err)
+		}
+	}
+	return m.checksum(contents)
+}
+
+// canonicalizeJSON re-serializes json with sorted keys and without whitespace, numbers are kept as is
+func canonicalizeJSON(contents []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid json: data after the top level value")
+	}
+	return json.Marshal(v)
+}
+
+// if a path relative to the root dir matches an ignore pattern of the config
+func (m *Manager) isConfigIgnored(path string) bool {
+	for _, p := range m.config.Ignore {
+		if ok, _ := matchGlob(p, filepath.ToSlash(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// if a dir should not be walked into as its name matches a prune pattern of the config
+func (m *Manager) isPruned(path string) bool {
+	name := filepath.Base(path)
+	for _, p := range m.config.Prune {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestConfig(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		".deta/config.json": `{
+			"ignore": ["docs/**", "**/*.log"],
+			"prune": ["build"],
+			"include_hidden": [".env.example"],
+			"hasher": "sha1",
+			"unknown": true
+		}`,
+		"main.py":             "print('hello')",
+		"lib/utils.py":        "def f(): pass",
+		"lib/debug.log":       "log",
+		"docs/index.md":       "docs",
+		"build/out.py":        "out",
+		"lib/build/nested.py": "nested",
+		".env.example":        "KEY=",
+	})
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{".env.example", "lib/utils.py", "main.py"})
+
+	assert.NilError(t, m.StoreState())
+	stored, err := m.getStoredState()
+	assert.NilError(t, err)
+	assert.Equal(t, stored["main.py"], fmt.Sprintf("%x", sha1.Sum([]byte("print('hello')"))))
+}
+
+func TestNoConfig(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":       "print('hello')",
+		"build/out.py":  "out",
+		"lib/debug.log": "log",
+	})
+	assert.DeepEqual(t, m.config, Config{})
+	// build is not pruned as an output dir
+	m.SetOutputDirs(nil)
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"build/out.py", "lib/debug.log", "main.py"})
+}
+
+func TestConfigInvalid(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	configPath := filepath.Join(m.detaPath, configFile)
+
+	assert.NilError(t, ioutil.WriteFile(configPath, []byte(`{"hasher": "md4"}`), filePermMode))
+	_, err := NewManager(&m.rootDir, true)
+	assert.ErrorContains(t, err, "unsupported hasher 'md4'")
+
+	assert.NilError(t, ioutil.WriteFile(configPath, []byte(`{"ignore": "docs"}`), filePermMode))
+	_, err = NewManager(&m.rootDir, true)
+	assert.ErrorContains(t, err, configFile)
+}
+
+func TestConfigEntrypoints(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		".deta/config.json": `{"entrypoints": {"app.py": "python"}}`,
+		"app.py":            "print('hello')",
+		"main.py":           "print('main')",
+	})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Python)
+	// the entrypoint of the config is preferred over the built in entrypoint
+	entrypoint, err := m.GetEntrypoint()
+	assert.NilError(t, err)
+	assert.Equal(t, entrypoint, "app.py")
+	effective := m.EffectiveEntrypoints()
+	assert.Equal(t, effective["app.py"], Python)
+	assert.Equal(t, effective["main.py"], Python)
+	assert.Equal(t, effective["index.js"], Node)
+	assert.Equal(t, len(m.Warnings()), 0)
+
+	// an entrypoint of an unknown runtime
+	configPath := filepath.Join(m.detaPath, configFile)
+	assert.NilError(t, ioutil.WriteFile(configPath, []byte(`{"entrypoints": {"app.go": "golang"}}`), filePermMode))
+	_, err = NewManager(&m.rootDir, true)
+	assert.ErrorContains(t, err, "entrypoint 'app.go' maps to unknown runtime 'golang'")
+	assert.NilError(t, ioutil.WriteFile(configPath, []byte(`{"entrypoints": {"src/app.py": "python"}}`), filePermMode))
+	_, err = NewManager(&m.rootDir, true)
+	assert.ErrorContains(t, err, "entrypoint 'src/app.py' is not a file name in the root dir")
+
+	// an entrypoint shadowing a built in entrypoint of another runtime
+	m = newTestManager(t, map[string]string{
+		".deta/config.json": `{"entrypoints": {"main.py": "custom"}}`,
+		"main.py":           "print('hello')",
+	})
+	assert.DeepEqual(t, m.Warnings(), []string{"entrypoint main.py of config.json maps to the custom runtime instead of the python runtime"})
+	assert.Equal(t, m.EffectiveEntrypoints()["main.py"], Custom)
+	r, err = m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Custom)
+}
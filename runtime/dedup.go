@@ -0,0 +1,38 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// SetDedupContents sets if changed files with identical contents are reported in Duplicates of the changes
+// eg: vendored copies, so callers can upload the contents once and reference them by every path
+// files are still in Changes or BinaryFiles
+func (m *Manager) SetDedupContents(dedup bool) {
+	m.dedupContents = dedup
+}
+
+// returns the sha256 digest of contents identifying duplicate files
+// the contents are hashed as is as duplicates are uploaded from the same contents
+func contentHash(contents []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(contents))
+}
+
+// sets Duplicates of the changes from the content hashes of paths, paths are in walk order
+func (sc *StateChanges) setDuplicates(paths []string, hashes map[string]string) {
+	groups := make(map[string][]string)
+	for _, path := range paths {
+		if hash, ok := hashes[path]; ok {
+			groups[hash] = append(groups[hash], path)
+		}
+	}
+	for hash, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		if sc.Duplicates == nil {
+			sc.Duplicates = make(map[string][]string)
+		}
+		sc.Duplicates[hash] = group
+	}
+}
@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDedupContents(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":                 "print('hello')",
+		"vendor/a/six.py":         "import sys",
+		"vendor/b/six.py":         "import sys",
+		"vendor/c/six.py":         "import sys",
+		"gen/one.py":              "x = 1",
+		"gen/two.py":              "x = 1",
+		"lib/unique.py":           "y = 2",
+		"assets/logo.png":         "\x00\x01\x02",
+		"assets/logo_copy.png":    "\x00\x01\x02",
+		"lib/not_a_duplicate.txt": "import sys\n",
+	})
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.Assert(t, sc.Duplicates == nil)
+
+	m.SetDedupContents(true)
+	sc, err = m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Duplicates, map[string][]string{
+		contentHash([]byte("import sys")):   {"vendor/a/six.py", "vendor/b/six.py", "vendor/c/six.py"},
+		contentHash([]byte("x = 1")):        {"gen/one.py", "gen/two.py"},
+		contentHash([]byte("\x00\x01\x02")): {"assets/logo.png", "assets/logo_copy.png"},
+	})
+	// duplicates are still read
+	assert.Equal(t, sc.Changes["vendor/c/six.py"], "import sys")
+
+	// only changed files are grouped
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"lib/unique.py": "import sys",
+		"gen/two.py":    "x = 2",
+	})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc.Duplicates == nil)
+	writeTestFiles(t, m.rootDir, map[string]string{"gen/one.py": "x = 2"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Duplicates, map[string][]string{
+		contentHash([]byte("x = 2")): {"gen/one.py", "gen/two.py"},
+	})
+}
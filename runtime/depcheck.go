@@ -0,0 +1,154 @@
+package runtime
+
+// Finding a problem found in a dependency eg: a known vulnerability
+type Finding struct {
+	Dep     string // the dependency as read from the dependency file eg: requests==2.19.0
+	ID      string // id of the advisory if any eg: CVE-2018-18074
+	Message string
+	Rule    DepRule // the kind of problem, an advisory if empty
+}
+
+// DepRule a kind of problem of a dependency
+type DepRule string
+
+const (
+	// RuleAdvisory the dependency has a known vulnerability
+	RuleAdvisory DepRule = "advisory"
+	// RuleYanked the version of the dependency was yanked from the registry
+	RuleYanked DepRule = "yanked"
+	// RuleDeprecated the dependency is deprecated
+	RuleDeprecated DepRule = "deprecated"
+	// RuleUnpinned the dependency is not pinned to an exact version
+	RuleUnpinned DepRule = "unpinned"
+	// RuleNotInstalled the dependency is not installed eg: an editable install or a local path
+	RuleNotInstalled DepRule = "not_installed"
+)
+
+// Severity how severe a finding is, eg: to set the exit code of the cli
+type Severity int
+
+const (
+	// SeverityInfo informational findings
+	SeverityInfo Severity = iota
+	// SeverityWarning findings that should be fixed
+	SeverityWarning
+	// SeverityError findings that should fail a deploy
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "error"
+}
+
+// DepFinding a problem found in a dependency by ValidateDeps
+type DepFinding struct {
+	Package  string // name of the package eg: requests
+	Dep      string // the dependency as read from the dependency file eg: requests>=2.0
+	Rule     DepRule
+	Severity Severity
+	Message  string
+}
+
+// severities of findings by rule, unpinned deps are errors if the pin check is strict
+var ruleSeverities = map[DepRule]Severity{
+	RuleAdvisory:     SeverityError,
+	RuleYanked:       SeverityError,
+	RuleDeprecated:   SeverityWarning,
+	RuleUnpinned:     SeverityWarning,
+	RuleNotInstalled: SeverityInfo,
+}
+
+// DepChecker checks dependencies eg: against an advisory database
+type DepChecker interface {
+	Check(deps []string) ([]Finding, error)
+}
+
+// SetDepChecker sets the checker used by CheckDeps, deps are not checked if not set
+func (m *Manager) SetDepChecker(c DepChecker) {
+	m.depChecker = c
+}
+
+// CheckDeps checks the deps of the dependency file of the runtime with the dep checker
+// returns no findings if no dep checker is set
+func (m *Manager) CheckDeps() ([]Finding, error) {
+	if m.depChecker == nil {
+		return nil, nil
+	}
+
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+	deps, err := m.readDeps(r.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(deps) == 0 {
+		return nil, nil
+	}
+	return m.depChecker.Check(deps)
+}
+
+// ValidateDeps validates the deps of the dependency file of the runtime
+// deps that are not installed, unpinned python deps if the pin check is not off and findings of the dep checker are returned
+// in this order, the findings of the dep checker are advisories unless they have a rule eg: yanked, deprecated
+func (m *Manager) ValidateDeps() ([]DepFinding, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+	pd, err := m.readProgDeps(r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []DepFinding
+	add := func(dep string, rule DepRule, message string) {
+		severity := ruleSeverities[rule]
+		if rule == RuleUnpinned && m.pinCheck == PinCheckStrict {
+			severity = SeverityError
+		}
+		findings = append(findings, DepFinding{
+			Package:  depName(r.Name, dep),
+			Dep:      dep,
+			Rule:     rule,
+			Severity: severity,
+			Message:  message,
+		})
+	}
+	for _, d := range pd.editable {
+		add(d, RuleNotInstalled, "editable installs are not installed")
+	}
+	for _, d := range pd.localPaths {
+		add(d, RuleNotInstalled, "local path requirements are not installed")
+	}
+	if r.Name == Python && m.pinCheck != PinCheckOff {
+		for _, d := range unpinnedDeps(pd.deps) {
+			add(d, RuleUnpinned, "not pinned to an exact version (==)")
+		}
+	}
+	if m.depChecker != nil && len(pd.deps) > 0 {
+		checked, err := m.depChecker.Check(pd.deps)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range checked {
+			rule := f.Rule
+			if rule == "" {
+				rule = RuleAdvisory
+			}
+			message := f.Message
+			if f.ID != "" {
+				message = f.ID + ": " + message
+			}
+			add(f.Dep, rule, message)
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,92 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// flags deps of a package
+type testDepChecker struct {
+	pkg     string
+	checked []string
+}
+
+func (c *testDepChecker) Check(deps []string) ([]Finding, error) {
+	c.checked = deps
+	var findings []Finding
+	for _, d := range deps {
+		if strings.HasPrefix(d, c.pkg+"==") {
+			findings = append(findings, Finding{Dep: d, ID: "CVE-2018-18074", Message: "insecure redirects"})
+		}
+	}
+	return findings, nil
+}
+
+func TestCheckDeps(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "requests==2.19.0\nflask==2.0.1\n",
+	})
+
+	findings, err := m.CheckDeps()
+	assert.NilError(t, err)
+	assert.Assert(t, findings == nil)
+
+	checker := &testDepChecker{pkg: "requests"}
+	m.SetDepChecker(checker)
+	findings, err = m.CheckDeps()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, checker.checked, []string{"requests==2.19.0", "flask==2.0.1"})
+	assert.DeepEqual(t, findings, []Finding{{Dep: "requests==2.19.0", ID: "CVE-2018-18074", Message: "insecure redirects"}})
+}
+
+// returns the findings of deps by dep
+type mapDepChecker map[string]Finding
+
+func (c mapDepChecker) Check(deps []string) ([]Finding, error) {
+	var findings []Finding
+	for _, d := range deps {
+		if f, ok := c[d]; ok {
+			f.Dep = d
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+func TestValidateDeps(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "requests==2.19.0\nflask>=2.0\nnose==1.3.7\nurllib3==1.26.0\n-e ./libs/core\n",
+	})
+	findings, err := m.ValidateDeps()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, findings, []DepFinding{
+		{Package: "./libs/core", Dep: "./libs/core", Rule: RuleNotInstalled, Severity: SeverityInfo, Message: "editable installs are not installed"},
+	})
+
+	m.SetPinCheck(PinCheckReport)
+	m.SetDepChecker(mapDepChecker{
+		"requests==2.19.0": {ID: "CVE-2018-18074", Message: "insecure redirects"},
+		"nose==1.3.7":      {Rule: RuleDeprecated, Message: "nose is no longer maintained"},
+		"urllib3==1.26.0":  {Rule: RuleYanked, Message: "yanked"},
+	})
+	findings, err = m.ValidateDeps()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, findings, []DepFinding{
+		{Package: "./libs/core", Dep: "./libs/core", Rule: RuleNotInstalled, Severity: SeverityInfo, Message: "editable installs are not installed"},
+		{Package: "flask", Dep: "flask>=2.0", Rule: RuleUnpinned, Severity: SeverityWarning, Message: "not pinned to an exact version (==)"},
+		{Package: "requests", Dep: "requests==2.19.0", Rule: RuleAdvisory, Severity: SeverityError, Message: "CVE-2018-18074: insecure redirects"},
+		{Package: "nose", Dep: "nose==1.3.7", Rule: RuleDeprecated, Severity: SeverityWarning, Message: "nose is no longer maintained"},
+		{Package: "urllib3", Dep: "urllib3==1.26.0", Rule: RuleYanked, Severity: SeverityError, Message: "yanked"},
+	})
+	assert.Equal(t, SeverityWarning.String(), "warning")
+
+	// unpinned deps are errors if the pin check is strict
+	m.SetPinCheck(PinCheckStrict)
+	findings, err = m.ValidateDeps()
+	assert.NilError(t, err)
+	assert.Equal(t, findings[1].Severity, SeverityError)
+}
@@ -0,0 +1,1485 @@
+package runtime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	setupPyFile  = "setup.py"
+	pipfile      = "Pipfile"
+	yarnLockFile = "yarn.lock"
+	condaEnvFile = "environment.yml"
+
+	// group of the deps of dependency files without groups
+	defaultDepGroup = "dependencies"
+)
+
+var (
+	// matches the start of the install_requires list literal in setup.py
+	installRequiresRegexp = regexp.MustCompile(`install_requires\s*=\s*\[`)
+	// matches a quoted string
+	quotedStringRegexp = regexp.MustCompile(`'([^'\\]*)'|"([^"\\]*)"`)
+	// matches what can be between the strings of a list literal, separators and comments
+	listSeparatorsRegexp = regexp.MustCompile(`^(\s|,|#[^\n]*)*$`)
+
+	// matches an inline comment of a requirements.txt line
+	inlineCommentRegexp = regexp.MustCompile(`\s+#.*$`)
+	// matches the start of a direct url or version control requirement eg: https://, git+https://
+	remoteURLRegexp = regexp.MustCompile(`^((git|hg|svn|bzr)\+[a-z+]+|https?|ftp)://`)
+	// utf-8 byte order mark some editors on windows write at the start of files
+	utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+	errUnparsableInstallRequires = errors.New("install_requires is not a list of strings")
+)
+
+// readDepFile reads a dependency file relative to the root dir without a leading utf-8 byte order mark
+func (m *Manager) readDepFile(name string) ([]byte, error) {
+	contents, err := m.readFile(filepath.Join(m.rootDir, name))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(contents, utf8BOM), nil
+}
+
+// other files deps are read from for runtimes
+var altDepFiles = map[string][]string{
+	Python: {pipfile, condaEnvFile, pyprojectFile, setupPyFile},
+	Node:   {yarnLockFile},
+}
+
+// IsDepFile checks if a path relative to the root dir is a file deps of the runtime are read from eg: requirements.txt
+// so callers can recognize the dependency file in StateChanges
+func (m *Manager) IsDepFile(relPath string) bool {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return false
+	}
+	return isDepFileOf(r.Name, relPath)
+}
+
+// checks if a path relative to the root dir is a file deps of runtime are read from
+func isDepFileOf(runtime, relPath string) bool {
+	path := filepath.ToSlash(filepath.Clean(relPath))
+	if runtime == Custom {
+		return false
+	}
+	if runtime == DotNet {
+		return !strings.Contains(path, "/") && strings.HasSuffix(path, csprojExt)
+	}
+	return path == depFiles[runtime] || contains(altDepFiles[runtime], path)
+}
+
+// checks if a dependency file of the runtime is present in the root dir
+func (m *Manager) depFileExists(runtime string) (bool, error) {
+	if runtime == Custom {
+		return false, nil
+	}
+	if runtime == DotNet {
+		csproj, err := m.csprojFile()
+		return csproj != "", err
+	}
+	names := []string{depFiles[runtime]}
+	// python deps are read from other files if requirements.txt is not present
+	if runtime == Python {
+		names = append(names, altDepFiles[Python]...)
+	}
+	for _, name := range names {
+		_, err := m.fs.Stat(filepath.Join(m.rootDir, name))
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// DependencyFilePath returns the path of the dependency file of the runtime joined with the root dir eg: to open it in an editor
+// the file might not be present, python deps are read from an alternative file eg: pyproject.toml if requirements.txt is not
+func (m *Manager) DependencyFilePath() (string, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return "", err
+	}
+	if r.Name == DotNet {
+		csproj, err := m.csprojFile()
+		if err != nil {
+			return "", err
+		}
+		if csproj == "" {
+			return "", fmt.Errorf("%w: no %s file present", ErrNoDepFile, csprojExt)
+		}
+		return filepath.Join(m.rootDir, csproj), nil
+	}
+	depFile, ok := depFiles[r.Name]
+	if !ok {
+		return "", fmt.Errorf("%w: runtime '%s'", ErrNoDepFile, r.Name)
+	}
+	if r.Name == Python {
+		_, err := m.fs.Stat(filepath.Join(m.rootDir, depFile))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil {
+			for _, alt := range altDepFiles[Python] {
+				if _, err := m.fs.Stat(filepath.Join(m.rootDir, alt)); err == nil {
+					return filepath.Join(m.rootDir, alt), nil
+				}
+			}
+		}
+	}
+	return filepath.Join(m.rootDir, depFile), nil
+}
+
+// returns dependency files of other runtimes present in the root dir, which are ignored for runtime
+// eg: a package.json of a node tool in a python program
+func (m *Manager) ignoredDepFiles(runtime string) ([]string, error) {
+	// dependency files of any runtime can be used by the Dockerfile of the custom runtime
+	if runtime == Custom {
+		return nil, nil
+	}
+	var ignored []string
+	for _, other := range sortedKeys(depFiles) {
+		// project files of dotnet are matched by a pattern
+		if other == runtime || other == DotNet {
+			continue
+		}
+		_, err := m.fs.Stat(filepath.Join(m.rootDir, depFiles[other]))
+		if err == nil {
+			ignored = append(ignored, depFiles[other])
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return ignored, nil
+}
+
+// DepsFingerprint returns a sha256 digest of the deps of the detected runtime for cache keys
+// deps are normalized and sorted, so comments, whitespace and order in the dependency file do not change the digest
+func (m *Manager) DepsFingerprint() (string, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return "", err
+	}
+	deps, err := m.readDeps(r.Name)
+	if err != nil {
+		return "", err
+	}
+
+	normalized := make(map[string]struct{}, len(deps))
+	for _, d := range deps {
+		// eg: Requests >= 2.0 is requests>=2.0
+		normalized[strings.Join(strings.Fields(strings.ToLower(d)), "")] = struct{}{}
+	}
+	sorted := make([]string, 0, len(normalized))
+	for d := range normalized {
+		sorted = append(sorted, d)
+	}
+	sort.Strings(sorted)
+
+	hash := sha256.New()
+	m.writeSalt(hash)
+	fmt.Fprintf(hash, "%s\x00", r.Name)
+	for _, d := range sorted {
+		fmt.Fprintf(hash, "%s\x00", d)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// ListDepNames returns the sorted names of the deps of the detected runtime without versions, extras and markers
+// eg: flask[async]>=2.0; python_version>"3.7" is flask, @types/node@^14.0 is @types/node
+func (m *Manager) ListDepNames() ([]string, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+	deps, err := m.readDeps(r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(deps))
+	names := []string{}
+	for _, d := range deps {
+		name := depName(r.Name, d)
+		if _, ok := seen[name]; ok || name == "" {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// depName returns the name of dep as read by readDeps for runtime
+func depName(runtime, dep string) string {
+	if runtime == Python {
+		// python names are case insensitive eg: Flask is flask
+		name := strings.TrimSpace(requirementIdentity(dep))
+		if i := strings.IndexAny(name, "[<>=!~;@ "); i >= 0 {
+			name = name[:i]
+		}
+		return strings.ToLower(name)
+	}
+	// other deps are name@version, scoped npm packages start with @ eg: @types/node@^14.0
+	if i := strings.LastIndex(dep, "@"); i > 0 {
+		return dep[:i]
+	}
+	return dep
+}
+
+// invalidDepFile wraps a parse error of a dependency file with ErrInvalidDepFile and the name of the file
+// the line of the error is added for json errors, toml and xml errors already have the line
+func invalidDepFile(name string, contents []byte, err error) error {
+	var offset int64 = -1
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tomlErr toml.ParseError
+	if errors.As(err, &tomlErr) {
+		// the message without the toml prefix and the last key eg: toml: line 2 (last key "packages.requests"):
+		tomlErr.LastKey = ""
+		msg := strings.TrimPrefix(tomlErr.Error(), fmt.Sprintf("toml: line %d: ", tomlErr.Position.Line))
+		return fmt.Errorf("%w %s: line %d: %s", ErrInvalidDepFile, name, tomlErr.Position.Line, msg)
+	}
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	}
+	if offset >= 0 && offset <= int64(len(contents)) {
+		line := bytes.Count(contents[:offset], []byte("\n")) + 1
+		return fmt.Errorf("%w %s: line %d: %v", ErrInvalidDepFile, name, line, err)
+	}
+	return fmt.Errorf("%w %s: %v", ErrInvalidDepFile, name, err)
+}
+
+// PinCheck how python deps without an exact version pin are handled
+type PinCheck int
+
+const (
+	// PinCheckOff deps are not checked
+	PinCheckOff PinCheck = iota
+	// PinCheckReport unpinned deps are reported in DepChanges.Unpinned
+	PinCheckReport
+	// PinCheckStrict unpinned deps return ErrUnpinnedDeps
+	PinCheckStrict
+)
+
+// isPinned checks if a python requirement is pinned to an exact version eg: requests==2.28.0
+func isPinned(req string) bool {
+	// ignore environment markers eg: ; python_version < "3.8"
+	if i := strings.Index(req, ";"); i >= 0 {
+		req = req[:i]
+	}
+	i := strings.Index(req, "==")
+	if i < 0 || strings.Contains(req, ",") {
+		return false
+	}
+	version := strings.TrimPrefix(req[i+2:], "=")
+	// wildcards are not exact eg: ==2.*
+	return version != "" && !strings.ContainsAny(version, "*<>!~")
+}
+
+// unpinnedDeps returns the deps that are not pinned to an exact version
+func unpinnedDeps(deps []string) []string {
+	var unpinned []string
+	for _, d := range deps {
+		if !isPinned(d) {
+			unpinned = append(unpinned, d)
+		}
+	}
+	return unpinned
+}
+
+// deps read from the dependency files of a program
+type progDeps struct {
+	deps       []string            // deps that will be installed
+	editable   []string            // editable installs
+	localPaths []string            // local path requirements
+	includes   []string            // requirements files included with -r
+	groups     map[string][]string // deps by group, nil if the dependency file has no groups
+}
+
+// parseRequirements parses lines of a requirements.txt file
+// editable installs and local paths are collected separately from deps
+// hashes and options eg: --index-url of files compiled by pip-compile or uv are dropped
+func parseRequirements(lines []string) *progDeps {
+	pd := &progDeps{}
+	for _, l := range joinContinuations(lines) {
+		l = strings.TrimSpace(l)
+		// skip empty lines and commentes # eg: # via requests of compiled files
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		// inline comments start after whitespace, # of urls eg: #egg= is kept
+		l = inlineCommentRegexp.ReplaceAllString(l, "")
+
+		if include, ok := includeTarget(l); ok {
+			pd.includes = append(pd.includes, include)
+			continue
+		}
+		if target, ok := editableTarget(l); ok {
+			pd.editable = append(pd.editable, requirementIdentity(target))
+			continue
+		}
+		l = stripHashes(l)
+		// options of pip eg: --index-url, --no-binary are not deps
+		if l == "" || strings.HasPrefix(l, "-") {
+			continue
+		}
+		if isLocalPath(l) {
+			pd.localPaths = append(pd.localPaths, l)
+			continue
+		}
+		// whitespace eg: tabs, non breaking spaces between the name and the version is dropped
+		pd.deps = append(pd.deps, strings.Join(strings.Fields(l), ""))
+	}
+	return pd
+}
+
+// joinContinuations joins lines ending with a backslash with the lines after them
+// eg: a requirement and its hashes of a compiled requirements file
+func joinContinuations(lines []string) []string {
+	var joined []string
+	var current string
+	for _, l := range lines {
+		trimmed := strings.TrimRight(l, " \t")
+		if strings.HasSuffix(trimmed, "\\") {
+			current += strings.TrimSuffix(trimmed, "\\") + " "
+			continue
+		}
+		joined = append(joined, current+l)
+		current = ""
+	}
+	if current != "" {
+		joined = append(joined, current)
+	}
+	return joined
+}
+
+// stripHashes removes hashes of a requirement eg: requests==2.28.0 --hash=sha256:... returns requests==2.28.0
+func stripHashes(line string) string {
+	fields := strings.Fields(line)
+	kept := fields[:0]
+	for i := 0; i < len(fields); i++ {
+		switch {
+		case strings.HasPrefix(fields[i], "--hash="):
+		case fields[i] == "--hash":
+			// the hash is the next field
+			i++
+		default:
+			kept = append(kept, fields[i])
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// compiledBy returns the tool that generated a requirements file from its header eg: uv, pip-compile
+// returns an empty string if the file was not generated
+func compiledBy(lines []string) string {
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if !strings.HasPrefix(l, "#") {
+			break
+		}
+		for _, tool := range []string{"pip-compile", "uv"} {
+			if strings.Contains(l, "autogenerated by "+tool+" ") || strings.HasSuffix(l, "autogenerated by "+tool) {
+				return tool
+			}
+		}
+	}
+	return ""
+}
+
+// includeTarget returns the file of a line including another requirements file eg: -r base.txt , --requirement=base.txt
+func includeTarget(line string) (string, bool) {
+	for _, prefix := range []string{"--requirement=", "--requirement ", "-r"} {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(line[len(prefix):]), true
+		}
+	}
+	return "", false
+}
+
+// readRequirements reads the requirements file name relative to the root dir with contents and the files it includes
+// included files are relative to the including file, deps of the same package are merged by mergeRequirements
+// files included more than once are read once, files including each other in a cycle return a CircularRequirementsError
+func (m depReader) readRequirements(name string, contents []byte) (*progDeps, error) {
+	merged := &progDeps{}
+	var sources []string
+	seen := make(map[string]bool)
+	// files being read, from name to the file including the current file
+	var stack []string
+
+	var read func(name string, contents []byte) error
+	read = func(name string, contents []byte) error {
+		seen[name] = true
+		stack = append(stack, name)
+		defer func() {
+			stack = stack[:len(stack)-1]
+		}()
+		lines, err := readLines(contents)
+		if err != nil {
+			return err
+		}
+		if tool := compiledBy(lines); tool != "" {
+			m.debugf("%s is compiled by %s", filepath.ToSlash(name), tool)
+		}
+		pd := parseRequirements(lines)
+		for _, d := range pd.deps {
+			merged.deps = append(merged.deps, d)
+			sources = append(sources, filepath.ToSlash(name))
+		}
+		merged.editable = append(merged.editable, pd.editable...)
+		merged.localPaths = append(merged.localPaths, pd.localPaths...)
+
+		for _, include := range pd.includes {
+			path := filepath.Join(filepath.Dir(name), filepath.FromSlash(include))
+			for i, reading := range stack {
+				if reading == path {
+					var files []string
+					for _, f := range append(stack[i:], path) {
+						files = append(files, filepath.ToSlash(f))
+					}
+					return &CircularRequirementsError{Files: files}
+				}
+			}
+			if seen[path] {
+				continue
+			}
+			contents, err := m.readDepFile(path)
+			if err != nil {
+				return fmt.Errorf("reading %s included by %s: %w", include, filepath.ToSlash(name), err)
+			}
+			err = read(path, contents)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := read(name, contents)
+	if err != nil {
+		return nil, err
+	}
+	merged.deps = m.mergeRequirements(merged.deps, sources)
+	return merged, nil
+}
+
+// mergeRequirements keeps one requirement per package of reqs in order, sources are the files of reqs
+// the most specific requirement of a package is kept eg: requests==2.28.0 over requests>=2.0 over requests
+// and conflicting requirements are warned about, requirements with environment markers are kept as is
+func (m *Manager) mergeRequirements(reqs []string, sources []string) []string {
+	var merged []string
+	// indexes in merged by package name
+	index := make(map[string]int)
+	from := make(map[string]string)
+	for i, req := range reqs {
+		if strings.Contains(req, ";") {
+			merged = append(merged, req)
+			continue
+		}
+		name := depName(Python, req)
+		j, ok := index[name]
+		if !ok {
+			index[name] = len(merged)
+			from[name] = sources[i]
+			merged = append(merged, req)
+			continue
+		}
+		existing := merged[j]
+		if existing == req {
+			continue
+		}
+		use := existing
+		if requirementSpecificity(req) > requirementSpecificity(existing) {
+			use = req
+		}
+		m.warn("conflicting requirements for %s: %s in %s and %s in %s, using %s", name, existing, from[name], req, sources[i], use)
+		if use == req {
+			merged[j] = req
+			from[name] = sources[i]
+		}
+	}
+	return merged
+}
+
+// ranks how specific a requirement is, an exact pin is the most specific
+func requirementSpecificity(req string) int {
+	switch {
+	case isPinned(req):
+		return 2
+	case strings.ContainsAny(req, "<>=!~@"):
+		return 1
+	}
+	return 0
+}
+
+// editableTarget returns the target of an editable install line eg: -e . , --editable=git+https://...
+func editableTarget(line string) (string, bool) {
+	for _, prefix := range []string{"--editable=", "--editable ", "-e "} {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(line[len(prefix):]), true
+		}
+	}
+	// -e.
+	if strings.HasPrefix(line, "-e") && !strings.HasPrefix(line, "--") {
+		return strings.TrimSpace(line[2:]), true
+	}
+	return "", false
+}
+
+// requirementIdentity returns the egg name of a requirement if present
+// otherwise the name in the url of a direct url or version control requirement, otherwise the requirement
+func requirementIdentity(req string) string {
+	if i := strings.Index(req, "#egg="); i >= 0 {
+		egg := req[i+len("#egg="):]
+		// drop other fragments eg: #egg=foo&subdirectory=bar
+		if j := strings.IndexAny(egg, "&"); j >= 0 {
+			egg = egg[:j]
+		}
+		if egg != "" {
+			return egg
+		}
+	}
+	if remoteURLRegexp.MatchString(req) {
+		return urlIdentity(req)
+	}
+	return req
+}
+
+// urlIdentity returns the name of the package of a url from its basename
+// eg: pkg for https://host/pkg-1.0-py3-none-any.whl, https://host/pkg-1.0.tar.gz and git+https://host/org/pkg.git@v1.0
+func urlIdentity(url string) string {
+	if i := strings.IndexAny(url, "#?"); i >= 0 {
+		url = url[:i]
+	}
+	name := pathpkg.Base(strings.TrimRight(url, "/"))
+	// version control refs eg: repo.git@v1.0
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if strings.HasSuffix(name, ".whl") {
+		// wheels are name-version-tags.whl
+		return strings.SplitN(name, "-", 2)[0]
+	}
+	for _, ext := range []string{".git", ".tar.gz", ".tar.bz2", ".tgz", ".zip", ".tar"} {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			// source archives are name-version
+			if i := strings.LastIndex(name, "-"); i > 0 && i+1 < len(name) && name[i+1] >= '0' && name[i+1] <= '9' {
+				name = name[:i]
+			}
+			break
+		}
+	}
+	return name
+}
+
+// remoteDeps returns the python deps installed from a url or version control instead of the package index
+// eg: https://host/pkg.whl, git+https://host/org/repo@v1.0#egg=pkg, pkg @ https://host/pkg.zip
+func remoteDeps(deps []string) []string {
+	var remote []string
+	for _, d := range deps {
+		url := d
+		// direct references eg: pkg@https://host/pkg.zip
+		if i := strings.Index(d, "@"); i > 0 && !remoteURLRegexp.MatchString(d) {
+			url = d[i+1:]
+		}
+		if remoteURLRegexp.MatchString(url) {
+			remote = append(remote, d)
+		}
+	}
+	return remote
+}
+
+// isLocalPath checks if a requirement is a local path
+func isLocalPath(req string) bool {
+	for _, prefix := range []string{"./", "../", "/", ".\\", "..\\", "file:", "~"} {
+		if strings.HasPrefix(req, prefix) {
+			return true
+		}
+	}
+	return req == "." || req == ".."
+}
+
+// readAltPythonDeps reads python deps from Pipfile, environment.yml or setup.py when requirements.txt is not present
+func (m depReader) readAltPythonDeps() (*progDeps, error) {
+	deps, err := m.readPipfileDeps()
+	if err == nil {
+		return &progDeps{deps: deps}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	deps, err = m.readCondaEnvDeps()
+	if err == nil {
+		return &progDeps{deps: deps}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	pd, err := m.readPyprojectDeps()
+	if err == nil {
+		return pd, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// legacy python packages declare deps in setup.py
+	deps, err = m.readSetupPyDeps()
+	if err != nil {
+		return nil, err
+	}
+	return &progDeps{deps: deps}, nil
+}
+
+// readPipfileDeps reads deps from the [packages] table of Pipfile
+// returns an error satisfying errors.Is(err, os.ErrNotExist) if Pipfile is not present
+func (m depReader) readPipfileDeps() ([]string, error) {
+	contents, err := m.readDepFile(pipfile)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := parseTOML(contents)
+	if err != nil {
+		return nil, invalidDepFile(pipfile, contents, err)
+	}
+	return parsePipfilePackages(tables["packages"]), nil
+}
+
+// readPyprojectDeps reads deps of pyproject.toml, see parsePyproject
+func (m depReader) readPyprojectDeps() (*progDeps, error) {
+	contents, err := m.readDepFile(pyprojectFile)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := parseTOML(contents)
+	if err != nil {
+		return nil, invalidDepFile(pyprojectFile, contents, err)
+	}
+	return parsePyproject(tables, m.includeDevDeps), nil
+}
+
+// parsePyproject parses the deps of the tables of a pyproject.toml
+// deps of the PEP 621 [project] table are requirements eg: requests>=2.28, with the optional dependencies if includeOptional
+// deps of the [tool.poetry.dependencies] table are name@constraint eg: requests@^2.28,
+// if both are present, poetry deps are only added if not in the [project] table
+// the groups have the deps of the dependencies group and of every optional dependencies group regardless of includeOptional
+func parsePyproject(tables tomlTables, includeOptional bool) *progDeps {
+	var lines []string
+	if reqs, ok := tables["project"]["dependencies"].([]interface{}); ok {
+		for _, r := range reqs {
+			if s, ok := r.(string); ok {
+				lines = append(lines, s)
+			}
+		}
+	}
+	mainLines := len(lines)
+	optional := tables["project.optional-dependencies"]
+	groups := make(map[string][]string)
+	for _, group := range sortedKeysOf(optional) {
+		var groupLines []string
+		reqs, _ := optional[group].([]interface{})
+		for _, r := range reqs {
+			if s, ok := r.(string); ok {
+				groupLines = append(groupLines, s)
+			}
+		}
+		if deps := parseRequirements(groupLines).deps; len(deps) > 0 {
+			groups[group] = deps
+		}
+		if includeOptional {
+			lines = append(lines, groupLines...)
+		}
+	}
+	pd := parseRequirements(lines)
+
+	names := make(map[string]struct{}, len(pd.deps))
+	for _, d := range pd.deps {
+		names[depName(Python, d)] = struct{}{}
+	}
+	poetry := make(map[string]interface{})
+	for name, v := range tables["tool.poetry.dependencies"] {
+		// the python constraint is not a dep
+		if _, ok := names[strings.ToLower(name)]; !ok && name != "python" {
+			poetry[name] = v
+		}
+	}
+	poetryDeps := parsePipfilePackages(poetry)
+	pd.deps = append(pd.deps, poetryDeps...)
+
+	// the dependencies group does not have the optional deps
+	main := append(parseRequirements(lines[:mainLines]).deps, poetryDeps...)
+	if len(main) > 0 {
+		groups[defaultDepGroup] = main
+	}
+	pd.groups = groups
+	return pd
+}
+
+// parsePipfilePackages parses packages of a Pipfile into name@version eg: requests@*, requests@==2.28.0
+func parsePipfilePackages(packages map[string]interface{}) []string {
+	var deps []string
+	for _, name := range sortedKeysOf(packages) {
+		version := "*"
+		switch v := packages[name].(type) {
+		case string:
+			version = v
+		case map[string]interface{}:
+			// eg: {version = "==2.0", extras = ["security"]}
+			if s, ok := v["version"].(string); ok {
+				version = s
+			}
+		}
+		deps = append(deps, fmt.Sprintf("%s@%s", name, version))
+	}
+	return deps
+}
+
+// readCondaEnvDeps reads conda and pip deps from the dependencies of a conda environment.yml
+// returns an error satisfying errors.Is(err, os.ErrNotExist) if environment.yml is not present
+func (m depReader) readCondaEnvDeps() ([]string, error) {
+	contents, err := m.readDepFile(condaEnvFile)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := readLines(contents)
+	if err != nil {
+		return nil, err
+	}
+	return parseCondaEnv(lines), nil
+}
+
+// parseCondaEnv parses the dependencies list of a conda environment.yml
+// conda deps eg: numpy=1.21 and pip deps of the nested pip list eg: requests==2.28.0 are returned as declared
+// python and pip themselves are not deps of the program and are skipped
+func parseCondaEnv(lines []string) []string {
+	var deps []string
+	inDeps, inPip := false, false
+	pipIndent := 0
+	for _, line := range lines {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		// top level keys eg: name, channels, dependencies
+		if indent == 0 && !strings.HasPrefix(trimmed, "-") {
+			inDeps = trimmed == "dependencies:"
+			inPip = false
+			continue
+		}
+		if !inDeps || !strings.HasPrefix(trimmed, "-") {
+			continue
+		}
+
+		item := strings.Trim(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")), `"'`)
+		if inPip && indent <= pipIndent {
+			inPip = false
+		}
+		if item == "pip:" {
+			inPip, pipIndent = true, indent
+			continue
+		}
+		if !inPip {
+			name := strings.FieldsFunc(item, func(r rune) bool {
+				return strings.ContainsRune("=<>! ", r)
+			})
+			if len(name) > 0 && (name[0] == "python" || name[0] == "pip") {
+				continue
+			}
+		}
+		deps = append(deps, item)
+	}
+	return deps
+}
+
+// readSetupPyDeps reads deps from install_requires of setup.py
+// the file is not executed, if the list can not be statically parsed no deps are returned with a warning
+func (m depReader) readSetupPyDeps() ([]string, error) {
+	contents, err := m.readDepFile(setupPyFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	deps, err := parseInstallRequires(string(contents))
+	if err != nil {
+		m.warn("could not read dependencies from %s: %v", setupPyFile, err)
+		return nil, nil
+	}
+	return deps, nil
+}
+
+// parseInstallRequires parses the install_requires list literal of a setup.py file
+func parseInstallRequires(contents string) ([]string, error) {
+	loc := installRequiresRegexp.FindStringIndex(contents)
+	if loc == nil {
+		if strings.Contains(contents, "install_requires") {
+			return nil, errUnparsableInstallRequires
+		}
+		return nil, nil
+	}
+
+	// find the closing bracket of the list skipping brackets in strings
+	var quote byte
+	end := -1
+	for i := loc[1]; i < len(contents) && end < 0; i++ {
+		c := contents[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			end = i
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated install_requires list")
+	}
+
+	// the list must not be part of an expression eg: ["a"] + other
+	rest := strings.TrimLeft(contents[end+1:], " \t\r\n")
+	if rest != "" && rest[0] != ',' && rest[0] != ')' && rest[0] != '#' {
+		return nil, errUnparsableInstallRequires
+	}
+
+	list := contents[loc[1]:end]
+	// everything other than strings must be separators
+	// otherwise the list is computed eg: concatenated or comprehension
+	if !listSeparatorsRegexp.MatchString(quotedStringRegexp.ReplaceAllString(list, "")) {
+		return nil, errUnparsableInstallRequires
+	}
+
+	var deps []string
+	for _, match := range quotedStringRegexp.FindAllStringSubmatch(list, -1) {
+		dep := match[1] + match[2]
+		dep = strings.ReplaceAll(dep, " ", "")
+		if dep != "" {
+			deps = append(deps, dep)
+		}
+	}
+	return deps, nil
+}
+
+type pomXML struct {
+	Properties struct {
+		Entries []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	} `xml:"properties"`
+	Dependencies []struct {
+		GroupID    string `xml:"groupId"`
+		ArtifactID string `xml:"artifactId"`
+		Version    string `xml:"version"`
+	} `xml:"dependencies>dependency"`
+}
+
+// matches maven property references eg: ${junit.version}
+var pomPropertyRegexp = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// parsePomXML parses the dependencies of a maven pom.xml file into groupId:artifactId@version
+// deps without a version eg: inherited from a parent pom are returned as groupId:artifactId
+func parsePomXML(contents []byte) ([]string, error) {
+	var pom pomXML
+	err := xml.Unmarshal(contents, &pom)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]string)
+	for _, p := range pom.Properties.Entries {
+		properties[p.XMLName.Local] = strings.TrimSpace(p.Value)
+	}
+
+	var deps []string
+	for _, d := range pom.Dependencies {
+		dep := fmt.Sprintf("%s:%s", strings.TrimSpace(d.GroupID), strings.TrimSpace(d.ArtifactID))
+		version := pomPropertyRegexp.ReplaceAllStringFunc(strings.TrimSpace(d.Version), func(ref string) string {
+			if v, ok := properties[ref[2:len(ref)-1]]; ok {
+				return v
+			}
+			return ref
+		})
+		if version != "" {
+			dep = fmt.Sprintf("%s@%s", dep, version)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+const (
+	csprojExt     = ".csproj"
+	csprojPattern = "*" + csprojExt
+	// minimal project file written by InitProject
+	csprojTemplate = "<Project Sdk=\"Microsoft.NET.Sdk\">\n</Project>\n"
+)
+
+// findCsproj returns the name of the first .csproj file of files or an empty string if there is none
+func findCsproj(files []os.FileInfo) string {
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), csprojExt) {
+			return f.Name()
+		}
+	}
+	return ""
+}
+
+// csprojFile returns the name of the .csproj file in the root dir or an empty string if there is none
+func (m *Manager) csprojFile() (string, error) {
+	files, err := m.fs.ReadDir(m.rootDir)
+	if err != nil {
+		return "", err
+	}
+	return findCsproj(files), nil
+}
+
+type csprojXML struct {
+	PackageReferences []struct {
+		Include string `xml:"Include,attr"`
+		// the version is either an attribute or a child element
+		VersionAttr string `xml:"Version,attr"`
+		Version     string `xml:"Version"`
+	} `xml:"ItemGroup>PackageReference"`
+}
+
+// parseCsproj parses the package references of a .csproj file into name@version eg: Newtonsoft.Json@13.0.1
+// references without a version eg: with central package management are returned as name
+func parseCsproj(contents []byte) ([]string, error) {
+	var proj csprojXML
+	err := xml.Unmarshal(contents, &proj)
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []string
+	for _, ref := range proj.PackageReferences {
+		name := strings.TrimSpace(ref.Include)
+		if name == "" {
+			continue
+		}
+		version := strings.TrimSpace(ref.VersionAttr)
+		if version == "" {
+			version = strings.TrimSpace(ref.Version)
+		}
+		if version != "" {
+			name = fmt.Sprintf("%s@%s", name, version)
+		}
+		deps = append(deps, name)
+	}
+	return deps, nil
+}
+
+const (
+	cargoFile = "Cargo.toml"
+	// entrypoint of a binary crate
+	rustMainFile = "src/main.rs"
+)
+
+// parseCargoDeps parses the dependencies of the tables of a Cargo.toml into crate@version eg: serde@1.0
+// git deps are crate@git+url, path deps are local paths that are not installed
+// deps of the workspace eg: { workspace = true } are returned as crate
+func parseCargoDeps(tables tomlTables) *progDeps {
+	pd := &progDeps{}
+	crates := make(map[string]interface{})
+	for k, v := range tables["dependencies"] {
+		crates[k] = v
+	}
+	// table form eg: [dependencies.serde]
+	for name, table := range tables {
+		if strings.HasPrefix(name, "dependencies.") {
+			crates[strings.TrimPrefix(name, "dependencies.")] = table
+		}
+	}
+
+	for _, name := range sortedKeysOf(crates) {
+		switch v := crates[name].(type) {
+		case string:
+			pd.deps = append(pd.deps, fmt.Sprintf("%s@%s", name, v))
+		case map[string]interface{}:
+			// eg: { version = "1.0", features = ["derive"] }, the package key renames the crate
+			if pkg, ok := v["package"].(string); ok {
+				name = pkg
+			}
+			if path, ok := v["path"].(string); ok {
+				pd.localPaths = append(pd.localPaths, path)
+			} else if git, ok := v["git"].(string); ok {
+				pd.deps = append(pd.deps, fmt.Sprintf("%s@git+%s", name, git))
+			} else if version, ok := v["version"].(string); ok {
+				pd.deps = append(pd.deps, fmt.Sprintf("%s@%s", name, version))
+			} else {
+				pd.deps = append(pd.deps, name)
+			}
+		}
+	}
+	return pd
+}
+
+const (
+	sbtFile = "build.sbt"
+	// dir of the sources of a scala project
+	scalaMainDir = "src/main/scala"
+)
+
+var (
+	// matches appending to the library dependencies eg: libraryDependencies += , libraryDependencies ++=
+	sbtLibDepsRegexp = regexp.MustCompile(`\blibraryDependencies\s*(\+\+?=)`)
+	// matches a module eg: "org.typelevel" %% "cats-core" % "2.9.0" % Test , the version can be a val
+	sbtModuleRegexp = regexp.MustCompile(`"([^"]+)"\s*(%{1,3})\s*"([^"]+)"\s*%\s*(?:"([^"]+)"|(\w+))(?:\s*%\s*(?:"([^"]*)"|(\w+)))?`)
+	// matches a string val eg: val akkaVersion = "2.8.0"
+	sbtValRegexp = regexp.MustCompile(`\bval\s+(\w+)\s*=\s*"([^"]*)"`)
+	// matches the scala version eg: scalaVersion := "2.13.10" , ThisBuild / scalaVersion := "3.3.0"
+	sbtScalaVersionRegexp = regexp.MustCompile(`\bscalaVersion\s*:=\s*"([^"]+)"`)
+)
+
+// parseBuildSbt parses the modules appended to libraryDependencies of a build.sbt into org:name@version eg: org.typelevel:cats-core_2.13@2.9.0
+// modules of single appends eg: libraryDependencies += "org" %% "name" % "1.0" and of sequences eg: libraryDependencies ++= Seq(...) are parsed,
+// names of cross versioned modules (%%) have the binary version of scalaVersion appended eg: _2.13 or _3, if the scala version is set
+// versions of vals of strings are resolved, test modules are included if includeTest, the file is not evaluated
+func parseBuildSbt(contents string, includeTest bool) []string {
+	contents = stripScalaComments(contents)
+	vals := make(map[string]string)
+	for _, match := range sbtValRegexp.FindAllStringSubmatch(contents, -1) {
+		vals[match[1]] = match[2]
+	}
+	var suffix string
+	if match := sbtScalaVersionRegexp.FindStringSubmatch(contents); match != nil {
+		suffix = "_" + scalaBinaryVersion(match[1])
+	}
+
+	var deps []string
+	for _, loc := range sbtLibDepsRegexp.FindAllStringSubmatchIndex(contents, -1) {
+		rest := contents[loc[1]:]
+		var expr string
+		if contents[loc[2]:loc[3]] == "+=" {
+			// a single module ends with the line
+			expr = rest
+			if i := strings.IndexByte(rest, '\n'); i >= 0 {
+				expr = rest[:i]
+			}
+		} else {
+			expr = scalaParens(rest)
+		}
+
+		for _, match := range sbtModuleRegexp.FindAllStringSubmatch(expr, -1) {
+			config := strings.ToLower(match[6] + match[7])
+			if !includeTest && (config == "test" || config == "it" || config == "integrationtest" || strings.HasPrefix(config, "test,")) {
+				continue
+			}
+			name := match[3]
+			if match[2] != "%" {
+				name += suffix
+			}
+			version := match[4]
+			if match[5] != "" {
+				version = vals[match[5]]
+			}
+			dep := fmt.Sprintf("%s:%s", match[1], name)
+			if version != "" {
+				dep = fmt.Sprintf("%s@%s", dep, version)
+			}
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// scalaBinaryVersion returns the binary version of a scala version eg: 2.13 of 2.13.10, 3 of 3.3.0
+func scalaBinaryVersion(version string) string {
+	parts := strings.Split(version, ".")
+	if parts[0] == "2" && len(parts) > 1 {
+		return parts[0] + "." + parts[1]
+	}
+	return parts[0]
+}
+
+// scalaParens returns the contents of the first parenthesized expression of s eg: the modules of Seq(...) spanning lines
+// parens in strings are skipped, the rest of s is returned if the parens are not closed
+func scalaParens(s string) string {
+	start := strings.IndexByte(s, '(')
+	if start < 0 {
+		return ""
+	}
+	depth := 0
+	inString := false
+	for i := start; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s[start+1 : i]
+			}
+		}
+	}
+	return s[start+1:]
+}
+
+// stripScalaComments removes line comments and block comments outside of strings eg: of urls of resolvers
+func stripScalaComments(s string) string {
+	var b strings.Builder
+	inString := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case strings.HasPrefix(s[i:], "//"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				return b.String()
+			}
+			i += end - 1
+			continue
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			// keep lines of single appends apart
+			b.WriteString(strings.Repeat("\n", strings.Count(s[i:i+2+end], "\n")))
+			i += end + 3
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+var (
+	// matches a gem declaration eg: gem "rails", "~> 6.1", require: false
+	gemRegexp = regexp.MustCompile(`^gem\s*\(?\s*['"]([^'"]+)['"]\s*(.*)$`)
+	// matches a group block eg: group :development, :test do
+	gemGroupRegexp = regexp.MustCompile(`^group\s*\(?(.*?)\)?\s+do\b`)
+	// matches the start of a block that is not a group eg: platforms :jruby do
+	rubyBlockRegexp = regexp.MustCompile(`\bdo(\s*\|[^|]*\|)?\s*$`)
+)
+
+// parseGemfile parses gem declarations of a Gemfile into name@version eg: rails@~> 6.1
+// gems in groups other than the default and production groups are skipped
+func parseGemfile(lines []string) []string {
+	var deps []string
+	// stack of blocks, true if gems in the block are skipped
+	var blocks []bool
+	skipped := func() bool {
+		for _, b := range blocks {
+			if b {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, l := range lines {
+		// drop comments
+		if i := strings.Index(l, "#"); i >= 0 {
+			l = l[:i]
+		}
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		if match := gemGroupRegexp.FindStringSubmatch(l); match != nil {
+			groups := match[1]
+			blocks = append(blocks, !strings.Contains(groups, ":default") && !strings.Contains(groups, ":production"))
+			continue
+		}
+		if l == "end" {
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			continue
+		}
+
+		match := gemRegexp.FindStringSubmatch(l)
+		if match == nil {
+			if rubyBlockRegexp.MatchString(l) {
+				blocks = append(blocks, false)
+			}
+			continue
+		}
+		if skipped() {
+			continue
+		}
+
+		// version requirements are the quoted args before any options eg: require: false
+		var versions []string
+		for _, arg := range strings.Split(match[2], ",") {
+			arg = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(arg), ")"))
+			if arg == "" {
+				continue
+			}
+			if len(arg) < 2 || (arg[0] != '"' && arg[0] != '\'') || arg[len(arg)-1] != arg[0] {
+				break
+			}
+			versions = append(versions, arg[1:len(arg)-1])
+		}
+
+		dep := match[1]
+		if len(versions) > 0 {
+			dep = fmt.Sprintf("%s@%s", dep, strings.Join(versions, ", "))
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+type composerJSON struct {
+	Require    map[string]string `json:"require"`
+	RequireDev map[string]string `json:"require-dev"`
+}
+
+// checks if a composer requirement is a platform requirement eg: php, ext-json
+func isComposerPlatformReq(name string) bool {
+	return name == "php" || strings.HasPrefix(name, "ext-") || strings.HasPrefix(name, "lib-")
+}
+
+// parseComposerJSON parses requirements of composer.json into vendor/pkg@version skipping platform requirements
+// require-dev is included if includeDev is true
+func parseComposerJSON(contents []byte, includeDev bool) ([]string, error) {
+	var c composerJSON
+	err := json.Unmarshal(contents, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []string
+	for _, name := range sortedKeys(c.Require) {
+		if !isComposerPlatformReq(name) {
+			deps = append(deps, fmt.Sprintf("%s@%s", name, c.Require[name]))
+		}
+	}
+	if includeDev {
+		for _, name := range sortedKeys(c.RequireDev) {
+			if !isComposerPlatformReq(name) {
+				deps = append(deps, fmt.Sprintf("%s@%s", name, c.RequireDev[name]))
+			}
+		}
+	}
+	return deps, nil
+}
+
+// readYarnLock reads the versions resolved by yarn from yarn.lock if present
+// returns no versions with a warning if yarn.lock can not be parsed, so deps fall back to package.json ranges
+func (m depReader) readYarnLock() (map[string]string, error) {
+	contents, err := m.readDepFile(yarnLockFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	lines, err := readLines(contents)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := parseYarnLock(lines)
+	if err != nil {
+		m.warn("could not read versions from %s, using ranges of package.json: %v", yarnLockFile, err)
+		return nil, nil
+	}
+	return resolved, nil
+}
+
+// parseYarnLock parses a v1 or v2 yarn.lock into a map of descriptors eg: express@^4.17.1 to resolved versions eg: 4.17.1
+// the npm: protocol of v2 descriptors is removed eg: express@npm:^4.17.1 is express@^4.17.1
+func parseYarnLock(lines []string) (map[string]string, error) {
+	resolved := make(map[string]string)
+	var descriptors []string
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// entry header eg: "lodash@^4.17.20", lodash@^4.17.21:
+		if !strings.HasPrefix(line, " ") {
+			if !strings.HasSuffix(trimmed, ":") {
+				return nil, fmt.Errorf("line %d: expected an entry", i+1)
+			}
+			descriptors = nil
+			for _, d := range strings.Split(strings.TrimSuffix(trimmed, ":"), ",") {
+				d = strings.Trim(strings.TrimSpace(d), `"`)
+				// name of scoped packages starts with @
+				at := strings.LastIndex(d, "@")
+				if at <= 0 {
+					continue
+				}
+				name, rng := d[:at], strings.TrimPrefix(d[at+1:], "npm:")
+				descriptors = append(descriptors, name+"@"+rng)
+			}
+			continue
+		}
+
+		// v1: version "4.17.21", v2: version: 4.17.21
+		if strings.HasPrefix(trimmed, "version ") || strings.HasPrefix(trimmed, "version:") {
+			version := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(trimmed, "version"), ":"))
+			version = strings.Trim(version, `"`)
+			for _, d := range descriptors {
+				resolved[d] = version
+			}
+		}
+	}
+	if len(resolved) == 0 {
+		return nil, errors.New("no resolved versions found")
+	}
+	return resolved, nil
+}
+
+var (
+	// matches the body of the deps function of mix.exs
+	mixDepsRegexp = regexp.MustCompile(`(?s)defp?\s+deps(?:\(\))?\s+do\b(.*?)\n\s*end\b`)
+	// matches a dep tuple eg: {:phoenix, "~> 1.7"}, {:plug, github: "elixir-plug/plug"}
+	mixDepRegexp = regexp.MustCompile(`\{\s*:(\w+)\s*(?:,\s*"([^"]*)")?`)
+	// matches an elixir comment
+	elixirCommentRegexp = regexp.MustCompile(`#[^\n]*`)
+)
+
+// parseMixExs parses the dep tuples of the deps function of a mix.exs file into name@version eg: phoenix@~> 1.7
+// the file is not evaluated, deps without a version eg: git deps are returned as name
+func parseMixExs(contents string) []string {
+	contents = elixirCommentRegexp.ReplaceAllString(contents, "")
+	body := mixDepsRegexp.FindStringSubmatch(contents)
+	if body == nil {
+		return nil
+	}
+
+	var deps []string
+	for _, match := range mixDepRegexp.FindAllStringSubmatch(body[1], -1) {
+		if match[2] == "" {
+			deps = append(deps, match[1])
+			continue
+		}
+		deps = append(deps, fmt.Sprintf("%s@%s", match[1], match[2]))
+	}
+	return deps
+}
+
+// workspacePatterns returns the patterns of the workspaces of package.json
+// eg: "workspaces": ["packages/*"] or "workspaces": {"packages": ["packages/*"]}
+func workspacePatterns(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var patterns []string
+	if err := json.Unmarshal(raw, &patterns); err == nil {
+		return patterns, nil
+	}
+	var w struct {
+		Packages []string `json:"packages"`
+	}
+	err := json.Unmarshal(raw, &w)
+	if err != nil {
+		return nil, invalidDepFile(depFiles[Node], raw, err)
+	}
+	return w.Packages, nil
+}
+
+// mergeWorkspaceDeps merges the deps of the workspace packages into the deps of the root package.json
+// deps are de-duplicated by name, a warning is recorded for conflicting versions and the first version is used
+// deps on the workspace packages themselves are skipped as they are not installed from the registry
+func (m depReader) mergeWorkspaceDeps(pj *pkgJSON) error {
+	patterns, err := workspacePatterns(pj.Workspaces)
+	if err != nil || len(patterns) == 0 {
+		return err
+	}
+
+	manifests := []string{depFiles[Node]}
+	packages := []*pkgJSON{pj}
+	names := make(map[string]struct{})
+	for _, p := range patterns {
+		dirs, err := m.fs.Glob(filepath.Join(m.rootDir, filepath.FromSlash(p)))
+		if err != nil {
+			return fmt.Errorf("invalid workspace pattern '%s': %w", p, err)
+		}
+		for _, dir := range dirs {
+			if info, err := m.fs.Stat(dir); err != nil || !info.IsDir() {
+				continue
+			}
+			rel, err := m.relPath(filepath.Join(dir, depFiles[Node]))
+			if err != nil {
+				return err
+			}
+			contents, err := m.readDepFile(rel)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return err
+			}
+			var wpj pkgJSON
+			err = json.Unmarshal(contents, &wpj)
+			if err != nil {
+				return invalidDepFile(rel, contents, err)
+			}
+			manifests = append(manifests, rel)
+			packages = append(packages, &wpj)
+			names[wpj.Name] = struct{}{}
+		}
+	}
+
+	merge := func(get func(p *pkgJSON) map[string]string) map[string]string {
+		merged := make(map[string]string)
+		sources := make(map[string]string)
+		for i, p := range packages {
+			deps := get(p)
+			for _, name := range sortedKeys(deps) {
+				if _, ok := names[name]; ok {
+					continue
+				}
+				version := deps[name]
+				if existing, ok := merged[name]; ok {
+					if existing != version {
+						m.warn("conflicting versions of %s: %s in %s and %s in %s, using %s",
+							name, existing, sources[name], version, manifests[i], existing)
+					}
+					continue
+				}
+				merged[name] = version
+				sources[name] = manifests[i]
+			}
+		}
+		return merged
+	}
+	deps := merge(func(p *pkgJSON) map[string]string { return p.Deps })
+	devDeps := merge(func(p *pkgJSON) map[string]string { return p.DevDeps })
+	pj.Deps, pj.DevDeps = deps, devDeps
+	return nil
+}
@@ -0,0 +1,1102 @@
+package runtime
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReadSetupPyDeps(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py": "",
+		"setup.py": `from setuptools import setup
+
+setup(
+    name="app",
+    install_requires=[
+        "requests >= 2.28.0",  # http
+        'flask[async]==2.0.1',
+    ],
+)
+`,
+	})
+	deps, err := m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"requests>=2.28.0", "flask[async]==2.0.1"})
+	assert.Equal(t, len(m.Warnings()), 0)
+
+	// computed list can not be parsed
+	m = newTestManager(t, map[string]string{
+		"main.py": "",
+		"setup.py": `from setuptools import setup
+
+setup(
+    name="app",
+    install_requires=["requests"] + [l.strip() for l in open("deps.txt")],
+)
+`,
+	})
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deps), 0)
+	assert.Equal(t, len(m.Warnings()), 1)
+
+	// requirements.txt takes precedence
+	m = newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "flask",
+		"setup.py":         `setup(install_requires=["requests"])`,
+	})
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"flask"})
+}
+
+func TestParseRequirementsEditable(t *testing.T) {
+	lines := []string{
+		"# comment",
+		"requests == 2.28.0",
+		"-e .",
+		"-e git+https://github.com/org/foo.git@v1.0#egg=foo",
+		"--editable=./libs/bar",
+		"./libs/baz",
+		"../shared",
+		"file:///opt/pkgs/qux",
+		"",
+	}
+	pd := parseRequirements(lines)
+	assert.DeepEqual(t, pd.deps, []string{"requests==2.28.0"})
+	assert.DeepEqual(t, pd.editable, []string{".", "foo", "./libs/bar"})
+	assert.DeepEqual(t, pd.localPaths, []string{"./libs/baz", "../shared", "file:///opt/pkgs/qux"})
+}
+
+func TestGetDepChangesEditable(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "flask\n-e .\n./libs/foo\n",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+
+	dc, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dc.Added, []string{"flask"})
+	assert.DeepEqual(t, dc.Editable, []string{"."})
+	assert.DeepEqual(t, dc.LocalPaths, []string{"./libs/foo"})
+}
+
+func TestGetDepChangesDepFileRemoved(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "flask==2.0.1\nrequests==2.28.0\n",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9", Deps: []string{"flask==2.0.1"}}))
+
+	dc, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, !dc.DepFileRemoved)
+
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "requirements.txt")))
+	dc, err = m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dc.Removed, []string{"flask==2.0.1"})
+	assert.Assert(t, dc.DepFileRemoved)
+
+	// deps read from another dependency file
+	writeTestFiles(t, m.rootDir, map[string]string{"Pipfile": "[packages]\nflask = \"==2.0.1\"\n"})
+	dc, err = m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, dc == nil || !dc.DepFileRemoved)
+
+	// no deps were stored
+	m = newTestManager(t, map[string]string{"main.py": ""})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	dc, err = m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, dc == nil)
+}
+
+func TestGetDepChangesIgnoredDepFiles(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "flask==2.0.1\n",
+		"package.json":     `{"dependencies": {"prettier": "^2.3.0"}}`,
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+
+	dc, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dc.Added, []string{"flask==2.0.1"})
+	assert.DeepEqual(t, dc.IgnoredDepFiles, []string{"package.json"})
+	assert.DeepEqual(t, m.Warnings(), []string{"package.json is ignored, it is not a dependency file of the python runtime"})
+
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "package.json")))
+	dc, err = m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, dc.IgnoredDepFiles == nil)
+}
+
+func TestIsPinned(t *testing.T) {
+	testCases := []struct {
+		req    string
+		pinned bool
+	}{
+		{"requests==2.28.0", true},
+		{"requests===2.28.0", true},
+		{"flask[async]==2.0.1", true},
+		{"requests==2.28.0;python_version<\"3.8\"", true},
+		{"requests>=2.28.0", false},
+		{"requests~=2.28", false},
+		{"requests==2.*", false},
+		{"requests>=2.0,==2.28.0", false},
+		{"requests", false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, isPinned(tc.req), tc.pinned, tc.req)
+	}
+}
+
+func TestGetDepChangesPinCheck(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "requests==2.28.0\nflask>=2.0\nboto3~=1.0\nnumpy\n",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+
+	dc, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, dc.Unpinned == nil)
+
+	m.SetPinCheck(PinCheckReport)
+	dc, err = m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dc.Unpinned, []string{"flask>=2.0", "boto3~=1.0", "numpy"})
+
+	m.SetPinCheck(PinCheckStrict)
+	_, err = m.GetDepChanges()
+	assert.Assert(t, errors.Is(err, ErrUnpinnedDeps))
+}
+
+func TestRemoteDeps(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py": "",
+		"requirements.txt": `requests==2.28.0
+https://files.example.com/packages/My_Pkg-1.2.0-py3-none-any.whl
+git+https://github.com/org/repo@v1.0#egg=toolkit
+git+https://github.com/org/other.git@main
+pkg @ https://example.com/pkg-0.1.tar.gz
+`,
+	})
+	names, err := m.ListDepNames()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{"my_pkg", "other", "pkg", "requests", "toolkit"})
+
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	dc, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dc.RemoteDeps, []string{
+		"https://files.example.com/packages/My_Pkg-1.2.0-py3-none-any.whl",
+		"git+https://github.com/org/repo@v1.0#egg=toolkit",
+		"git+https://github.com/org/other.git@main",
+		"pkg@https://example.com/pkg-0.1.tar.gz",
+	})
+}
+
+func TestParsePomXML(t *testing.T) {
+	pom := `<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0"
+         xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <modelVersion>4.0.0</modelVersion>
+  <properties>
+    <junit.version>5.8.2</junit.version>
+  </properties>
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>com.example</groupId>
+        <artifactId>managed</artifactId>
+        <version>1.0</version>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+  <dependencies>
+    <dependency>
+      <groupId>com.google.code.gson</groupId>
+      <artifactId>gson</artifactId>
+      <version>2.9.0</version>
+    </dependency>
+    <dependency>
+      <groupId>org.junit.jupiter</groupId>
+      <artifactId>junit-jupiter</artifactId>
+      <version>${junit.version}</version>
+    </dependency>
+    <dependency>
+      <groupId>org.slf4j</groupId>
+      <artifactId>slf4j-api</artifactId>
+    </dependency>
+  </dependencies>
+</project>`
+	deps, err := parsePomXML([]byte(pom))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{
+		"com.google.code.gson:gson@2.9.0",
+		"org.junit.jupiter:junit-jupiter@5.8.2",
+		"org.slf4j:slf4j-api",
+	})
+
+	m := newTestManager(t, map[string]string{"Main.java": "", "pom.xml": pom, "target/Main.class": ""})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Java)
+	deps, err = m.readDeps(Java)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deps), 3)
+}
+
+func TestReadPipfileDeps(t *testing.T) {
+	pipfileContents := `[[source]]
+url = "https://pypi.org/simple"
+verify_ssl = true
+name = "pypi"
+
+[packages]
+requests = "*"
+flask = "==2.0.1"
+django = {version = ">=3.0", extras = ["bcrypt"]}
+mylib = {git = "https://github.com/org/mylib.git", ref = "main"}
+
+[dev-packages]
+pytest = "*"
+`
+	m := newTestManager(t, map[string]string{
+		"main.py": "",
+		"Pipfile": pipfileContents,
+	})
+	expected := []string{"django@>=3.0", "flask@==2.0.1", "mylib@*", "requests@*"}
+	deps, err := m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, expected)
+
+	// requirements.txt is preferred unless configured otherwise
+	writeTestFiles(t, m.rootDir, map[string]string{"requirements.txt": "numpy"})
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"numpy"})
+
+	m.SetPreferPipfile(true)
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, expected)
+}
+
+func TestParseGemfile(t *testing.T) {
+	gemfile := `# frozen_string_literal: true
+source "https://rubygems.org"
+ruby "2.7.2"
+
+gem "sinatra", "~> 2.1"
+gem 'puma' # web server
+gem "rails", ">= 6.0", "< 7", require: false
+gem "nokogiri", git: "https://github.com/sparklemotion/nokogiri"
+
+group :development, :test do
+  gem "rspec", "~> 3.10"
+end
+
+group :production do
+  gem "pg", "1.2.3"
+end
+
+platforms :jruby do
+  gem "jdbc"
+end
+`
+	lines, err := readLines([]byte(gemfile))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, parseGemfile(lines), []string{
+		"sinatra@~> 2.1",
+		"puma",
+		"rails@>= 6.0, < 7",
+		"nokogiri",
+		"pg@1.2.3",
+		"jdbc",
+	})
+
+	m := newTestManager(t, map[string]string{"main.rb": "", "Gemfile": gemfile})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Ruby)
+	deps, err := m.readDeps(Ruby)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deps), 6)
+}
+
+func TestParseComposerJSON(t *testing.T) {
+	composer := `{
+    "name": "org/micro",
+    "require": {
+        "php": ">=8.0",
+        "ext-json": "*",
+        "slim/slim": "^4.10",
+        "monolog/monolog": "^2.0"
+    },
+    "require-dev": {
+        "phpunit/phpunit": "^9.5"
+    }
+}`
+	deps, err := parseComposerJSON([]byte(composer), false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"monolog/monolog@^2.0", "slim/slim@^4.10"})
+
+	m := newTestManager(t, map[string]string{"index.php": "", "composer.json": composer})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, PHP)
+
+	m.SetIncludeDevDeps(true)
+	deps, err = m.readDeps(PHP)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"monolog/monolog@^2.0", "slim/slim@^4.10", "phpunit/phpunit@^9.5"})
+}
+
+func TestReadNodeDevDeps(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"index.js":     "",
+		"package.json": `{"dependencies": {"express": "^4.17.1"}, "devDependencies": {"jest": "^27.0.0"}}`,
+	})
+	deps, err := m.readDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"express@^4.17.1"})
+
+	m.SetIncludeDevDeps(true)
+	deps, err = m.readDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"express@^4.17.1", "jest@^27.0.0"})
+}
+
+func TestReadDepsBOM(t *testing.T) {
+	bom := "\xEF\xBB\xBF"
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": bom + "requests==2.28.0\nflask==2.0.1\n",
+	})
+	deps, err := m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"requests==2.28.0", "flask==2.0.1"})
+
+	m = newTestManager(t, map[string]string{
+		"index.js":     "",
+		"package.json": bom + `{"dependencies": {"express": "^4.17.1"}}`,
+	})
+	deps, err = m.readDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"express@^4.17.1"})
+}
+
+func TestReadCondaEnvDeps(t *testing.T) {
+	env := `name: micro
+channels:
+  - conda-forge
+dependencies:
+  - python=3.9
+  - numpy=1.21.2
+  - "pandas>=1.3"  # dataframes
+  - pip
+  - pip:
+      - requests==2.28.0
+      - deta==1.1.0
+  - scipy
+variables:
+  - NOT_A_DEP
+`
+	m := newTestManager(t, map[string]string{"main.py": "", "environment.yml": env})
+	deps, err := m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"numpy=1.21.2", "pandas>=1.3", "requests==2.28.0", "deta==1.1.0", "scipy"})
+
+	// requirements.txt is preferred
+	writeTestFiles(t, m.rootDir, map[string]string{"requirements.txt": "flask==2.0.1"})
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"flask==2.0.1"})
+}
+
+func TestReadYarnLockDeps(t *testing.T) {
+	yarnLock := `# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@types/node@^16.0.0":
+  version "16.11.7"
+  resolved "https://registry.yarnpkg.com/@types/node/-/node-16.11.7.tgz"
+
+express@^4.17.1:
+  version "4.17.1"
+  resolved "https://registry.yarnpkg.com/express/-/express-4.17.1.tgz"
+  dependencies:
+    accepts "~1.3.7"
+
+lodash@^4.17.20, lodash@^4.17.21:
+  version "4.17.21"
+`
+	m := newTestManager(t, map[string]string{
+		"index.js":     "",
+		"package.json": `{"dependencies": {"express": "^4.17.1", "lodash": "^4.17.21", "@types/node": "^16.0.0", "uuid": "^8.3.2"}}`,
+		"yarn.lock":    yarnLock,
+	})
+	deps, err := m.readDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"@types/node@16.11.7", "express@4.17.1", "lodash@4.17.21", "uuid@^8.3.2"})
+
+	// v2
+	lines, err := readLines([]byte(`__metadata:
+  version: 4
+
+"express@npm:^4.17.1":
+  version: 4.17.1
+  resolution: "express@npm:4.17.1"
+`))
+	assert.NilError(t, err)
+	resolved, err := parseYarnLock(lines)
+	assert.NilError(t, err)
+	assert.Equal(t, resolved["express@^4.17.1"], "4.17.1")
+
+	// falls back to ranges
+	writeTestFiles(t, m.rootDir, map[string]string{"yarn.lock": "not a lock file"})
+	deps, err = m.readDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"@types/node@^16.0.0", "express@^4.17.1", "lodash@^4.17.21", "uuid@^8.3.2"})
+	assert.Equal(t, len(m.Warnings()), 1)
+}
+
+func TestInvalidDepFile(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"index.js": "",
+		"package.json": `{
+  "dependencies": {
+    "express": "^4.17.1",
+  }
+}`,
+	})
+	_, err := m.readDeps(Node)
+	assert.Assert(t, errors.Is(err, ErrInvalidDepFile))
+	assert.ErrorContains(t, err, "invalid dependency file package.json: line 4: invalid character '}'")
+
+	m = newTestManager(t, map[string]string{
+		"main.py": "",
+		"Pipfile": "[packages]\nrequests = \"*\nflask = \"*\"\n",
+	})
+	m.SetPreferPipfile(true)
+	_, err = m.readDeps(Python)
+	assert.Assert(t, errors.Is(err, ErrInvalidDepFile))
+	assert.ErrorContains(t, err, "invalid dependency file Pipfile: line 2: strings cannot contain newlines")
+}
+
+func TestParseMixExs(t *testing.T) {
+	mixExs := `defmodule Micro.MixProject do
+  use Mix.Project
+
+  def project do
+    [
+      app: :micro,
+      version: "0.1.0",
+      elixir: "~> 1.14",
+      deps: deps()
+    ]
+  end
+
+  defp deps do
+    [
+      {:phoenix, "~> 1.7"},
+      {:jason, "~> 1.4"},
+      # {:commented, "~> 1.0"},
+      {:plug, github: "elixir-plug/plug"},
+      {:credo, "~> 1.6", only: [:dev, :test], runtime: false}
+    ]
+  end
+end
+`
+	assert.DeepEqual(t, parseMixExs(mixExs), []string{"phoenix@~> 1.7", "jason@~> 1.4", "plug", "credo@~> 1.6"})
+
+	m := newTestManager(t, map[string]string{"mix.exs": mixExs, "lib/micro.ex": "defmodule Micro do\nend\n"})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Elixir)
+	deps, err := m.readDeps(Elixir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deps), 4)
+}
+
+func TestIsDepFile(t *testing.T) {
+	tests := []struct {
+		entrypoint string
+		depFiles   []string
+	}{
+		{"main.py", []string{"requirements.txt", "Pipfile", "environment.yml", "setup.py"}},
+		{"index.js", []string{"package.json", "yarn.lock"}},
+		{"Main.java", []string{"pom.xml"}},
+		{"main.rb", []string{"Gemfile"}},
+		{"index.php", []string{"composer.json"}},
+		{"mix.exs", []string{"mix.exs"}},
+	}
+	for _, tc := range tests {
+		m := newTestManager(t, map[string]string{tc.entrypoint: ""})
+		for _, f := range tc.depFiles {
+			assert.Assert(t, m.IsDepFile(f), "%s for %s", f, tc.entrypoint)
+			assert.Assert(t, m.IsDepFile("./"+f), "./%s for %s", f, tc.entrypoint)
+			assert.Assert(t, !m.IsDepFile("lib/"+f), "lib/%s for %s", f, tc.entrypoint)
+		}
+		assert.Assert(t, !m.IsDepFile(tc.entrypoint) || tc.entrypoint == "mix.exs")
+	}
+
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	assert.Assert(t, !m.IsDepFile("package.json"))
+}
+
+func TestDepsFingerprint(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "requests==2.28.0\nflask==2.0.1\n",
+	})
+	fingerprint, err := m.DepsFingerprint()
+	assert.NilError(t, err)
+
+	// comments, whitespace and order do not change the fingerprint
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"requirements.txt": "# web\n\n  flask == 2.0.1  \n\nrequests==2.28.0 # http\n",
+	})
+	reformatted, err := m.DepsFingerprint()
+	assert.NilError(t, err)
+	assert.Equal(t, reformatted, fingerprint)
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"requirements.txt": "requests==2.28.1\nflask==2.0.1\n",
+	})
+	changed, err := m.DepsFingerprint()
+	assert.NilError(t, err)
+	assert.Assert(t, changed != fingerprint)
+}
+
+func TestParseRequirementsInlineComments(t *testing.T) {
+	pd := parseRequirements([]string{
+		"requests==2.28.0 # http",
+		"flask==2.0.1\t# web",
+		"git+https://github.com/org/repo.git#egg=repo",
+	})
+	assert.DeepEqual(t, pd.deps, []string{"requests==2.28.0", "flask==2.0.1", "git+https://github.com/org/repo.git#egg=repo"})
+}
+
+func TestReadNodeWorkspaceDeps(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"index.js":                     "",
+		"package.json":                 `{"name": "root", "workspaces": ["packages/*"], "dependencies": {"express": "^4.17.1"}}`,
+		"packages/api/package.json":    `{"name": "@org/api", "dependencies": {"express": "^4.18.0", "@org/shared": "*", "uuid": "^8.3.2"}}`,
+		"packages/shared/package.json": `{"name": "@org/shared", "dependencies": {"lodash": "^4.17.21"}}`,
+		"packages/README.md":           "",
+	})
+	deps, err := m.readDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"express@^4.17.1", "lodash@^4.17.21", "uuid@^8.3.2"})
+	assert.DeepEqual(t, m.Warnings(), []string{
+		"conflicting versions of express: ^4.17.1 in package.json and ^4.18.0 in packages/api/package.json, using ^4.17.1",
+	})
+
+	// object form of workspaces
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"package.json": `{"name": "root", "workspaces": {"packages": ["packages/shared"]}}`,
+	})
+	deps, err = m.readDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"lodash@^4.17.21"})
+}
+
+func TestParseCsproj(t *testing.T) {
+	csproj := `<Project Sdk="Microsoft.NET.Sdk">
+  <PropertyGroup>
+    <OutputType>Exe</OutputType>
+    <TargetFramework>net6.0</TargetFramework>
+  </PropertyGroup>
+  <ItemGroup>
+    <PackageReference Include="Newtonsoft.Json" Version="13.0.1" />
+    <PackageReference Include="Serilog">
+      <Version>2.12.0</Version>
+    </PackageReference>
+  </ItemGroup>
+  <ItemGroup>
+    <PackageReference Include="Dapper" />
+    <Compile Include="Utils.cs" />
+  </ItemGroup>
+</Project>
+`
+	deps, err := parseCsproj([]byte(csproj))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"Newtonsoft.Json@13.0.1", "Serilog@2.12.0", "Dapper"})
+
+	m := newTestManager(t, map[string]string{"Program.cs": "", "Micro.csproj": csproj})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, DotNet)
+	deps, err = m.readDeps(DotNet)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deps), 3)
+	assert.Assert(t, m.IsDepFile("Micro.csproj"))
+	assert.Assert(t, !m.IsDepFile("lib/Other.csproj"))
+
+	// Program.cs without a project file is not an entrypoint
+	m = newTestManager(t, map[string]string{"Program.cs": ""})
+	_, err = m.GetRuntime()
+	assert.Assert(t, errors.Is(err, ErrNoEntrypoint))
+
+	m = newTestManager(t, map[string]string{"Program.cs": "", "Micro.csproj": "<Project>"})
+	_, err = m.readDeps(DotNet)
+	assert.Assert(t, errors.Is(err, ErrInvalidDepFile))
+}
+
+func TestListDepNames(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py": "",
+		"requirements.txt": `Flask[async]>=2.0; python_version>"3.7"
+requests==2.28.0
+requests~=2.28
+numpy
+git+https://github.com/psf/black.git#egg=black
+pkg @ https://example.com/pkg.zip
+`,
+	})
+	names, err := m.ListDepNames()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{"black", "flask", "numpy", "pkg", "requests"})
+
+	m = newTestManager(t, map[string]string{
+		"index.js":     "",
+		"package.json": `{"dependencies": {"express": "^4.17.1", "@types/node": "~14.0.0", "lodash": "4.17.21"}}`,
+	})
+	names, err = m.ListDepNames()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{"@types/node", "express", "lodash"})
+
+	m = newTestManager(t, map[string]string{"index.js": ""})
+	names, err = m.ListDepNames()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{})
+}
+
+func TestParseRequirementsOddLines(t *testing.T) {
+	lines, err := readLines([]byte("flask==2.0.1\rrequests\t== 2.28.0\r\n# comment\n" + strings.Repeat("x", 70000) + "\n"))
+	assert.NilError(t, err)
+	pd := parseRequirements(lines)
+	assert.Equal(t, len(pd.deps), 3)
+	assert.Equal(t, pd.deps[0], "flask==2.0.1")
+	assert.Equal(t, pd.deps[1], "requests==2.28.0")
+}
+
+func TestParseCargoToml(t *testing.T) {
+	cargo := `[package]
+name = "micro"
+version = "0.1.0"
+edition = "2021"
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+tokio = "1.28"
+rand = { package = "rand_core", version = "0.6" }
+shared = { path = "../shared" }
+lambda = { git = "https://github.com/awslabs/aws-lambda-rust-runtime" }
+
+[dependencies.reqwest]
+version = "0.11"
+default-features = false
+
+[dev-dependencies]
+mockito = "1.0"
+`
+	m := newTestManager(t, map[string]string{"Cargo.toml": cargo, "src/main.rs": "fn main() {}"})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Rust)
+
+	pd, err := m.readProgDeps(Rust)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, pd.deps, []string{
+		"lambda@git+https://github.com/awslabs/aws-lambda-rust-runtime",
+		"rand_core@0.6",
+		"reqwest@0.11",
+		"serde@1.0",
+		"tokio@1.28",
+	})
+	assert.DeepEqual(t, pd.localPaths, []string{"../shared"})
+
+	// a library crate is not an entrypoint
+	m = newTestManager(t, map[string]string{"Cargo.toml": cargo, "src/lib.rs": ""})
+	_, err = m.GetRuntime()
+	assert.Assert(t, errors.Is(err, ErrNoEntrypoint))
+}
+
+func TestReadPyprojectDeps(t *testing.T) {
+	pyproject := `[project]
+name = "micro"
+requires-python = ">=3.8"
+dependencies = [
+    "requests >= 2.28",
+    "flask[async]==2.0.1",
+    "importlib-metadata; python_version<'3.8'",
+]
+
+[project.optional-dependencies]
+test = ["pytest>=7.0"]
+
+[tool.poetry.dependencies]
+python = "^3.8"
+requests = "^2.28"
+boto3 = { version = "^1.26", optional = true }
+`
+	m := newTestManager(t, map[string]string{"main.py": "", "pyproject.toml": pyproject})
+	deps, err := m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{
+		"requests>=2.28",
+		"flask[async]==2.0.1",
+		"importlib-metadata;python_version<'3.8'",
+		"boto3@^1.26",
+	})
+	assert.Assert(t, m.IsDepFile("pyproject.toml"))
+
+	m.SetIncludeDevDeps(true)
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.Assert(t, contains(deps, "pytest>=7.0"))
+
+	// poetry layout
+	m = newTestManager(t, map[string]string{"main.py": "", "pyproject.toml": "[tool.poetry.dependencies]\npython = \"^3.8\"\nrequests = \"^2.28\"\n"})
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"requests@^2.28"})
+
+	// requirements.txt is read first
+	m = newTestManager(t, map[string]string{"main.py": "", "pyproject.toml": pyproject, "requirements.txt": "flask==2.0.1"})
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"flask==2.0.1"})
+}
+
+func TestReadDeps(t *testing.T) {
+	tests := []struct {
+		runtime string
+		files   map[string]string
+		deps    []string
+	}{
+		{Python, map[string]string{"requirements.txt": "flask==2.0.1\n"}, []string{"flask==2.0.1"}},
+		{Node, map[string]string{"package.json": `{"dependencies": {"express": "^4.17.1"}}`}, []string{"express@^4.17.1"}},
+		{Java, map[string]string{"pom.xml": `<project><dependencies><dependency><groupId>com.google.code.gson</groupId><artifactId>gson</artifactId><version>2.9.0</version></dependency></dependencies></project>`}, []string{"com.google.code.gson:gson@2.9.0"}},
+		{Ruby, map[string]string{"Gemfile": "gem 'sinatra', '~> 2.1'\n"}, []string{"sinatra@~> 2.1"}},
+		{PHP, map[string]string{"composer.json": `{"require": {"slim/slim": "^4.10"}}`}, []string{"slim/slim@^4.10"}},
+		{Elixir, map[string]string{"mix.exs": "  defp deps do\n    [\n      {:jason, \"~> 1.4\"}\n    ]\n  end\n"}, []string{"jason@~> 1.4"}},
+		{DotNet, map[string]string{"Micro.csproj": `<Project><ItemGroup><PackageReference Include="Dapper" Version="2.0.123" /></ItemGroup></Project>`}, []string{"Dapper@2.0.123"}},
+		{Rust, map[string]string{"Cargo.toml": "[dependencies]\ntokio = \"1.28\"\n"}, []string{"tokio@1.28"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.runtime, func(t *testing.T) {
+			m := newTestManager(t, tc.files)
+			deps, err := m.ReadDeps(tc.runtime)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, deps, tc.deps)
+		})
+	}
+
+	m := newTestManager(t, map[string]string{"main.go": ""})
+	_, err := m.ReadDeps("go")
+	assert.ErrorContains(t, err, "unsupported runtime 'go'")
+}
+
+func TestReadDepsGrouped(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"index.js":     "",
+		"package.json": `{"dependencies": {"express": "^4.17.1"}, "devDependencies": {"jest": "^29.0.0"}, "peerDependencies": {"react": ">=17"}}`,
+	})
+	groups, err := m.ReadDepsGrouped(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, groups, map[string][]string{
+		"dependencies":     {"express@^4.17.1"},
+		"devDependencies":  {"jest@^29.0.0"},
+		"peerDependencies": {"react@>=17"},
+	})
+	// the flat deps do not have dev and peer deps unless dev deps are included
+	deps, err := m.ReadDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"express@^4.17.1"})
+	m.SetIncludeDevDeps(true)
+	deps, err = m.ReadDeps(Node)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"express@^4.17.1", "jest@^29.0.0"})
+
+	m = newTestManager(t, map[string]string{
+		"main.py": "",
+		"pyproject.toml": `[project]
+dependencies = ["requests>=2.28"]
+
+[project.optional-dependencies]
+test = ["pytest>=7", "coverage"]
+docs = ["sphinx"]
+`,
+	})
+	groups, err = m.ReadDepsGrouped(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, groups, map[string][]string{
+		"dependencies": {"requests>=2.28"},
+		"test":         {"pytest>=7", "coverage"},
+		"docs":         {"sphinx"},
+	})
+	deps, err = m.ReadDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"requests>=2.28"})
+
+	// deps of dependency files without groups are in the dependencies group
+	m = newTestManager(t, map[string]string{"main.py": "", "requirements.txt": "flask==2.0.1\n"})
+	groups, err = m.ReadDepsGrouped(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, groups, map[string][]string{"dependencies": {"flask==2.0.1"}})
+
+	_, err = m.ReadDepsGrouped("go")
+	assert.ErrorContains(t, err, "unsupported runtime 'go'")
+}
+
+func TestReadRequirementsIncludes(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":                "",
+		"requirements.txt":       "-r requirements/base.txt\nrequests>=2.0\nflask\n--requirement=requirements/extra.txt\n",
+		"requirements/base.txt":  "requests==2.28.0\nFlask>=2.0\nclick; python_version < \"3.8\"\n",
+		"requirements/extra.txt": "flask==2.0.1\nclick; python_version >= \"3.8\"\nrequests==2.28.0\n",
+	})
+	deps, err := m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{
+		"requests==2.28.0",
+		"flask==2.0.1",
+		"click;python_version<\"3.8\"",
+		"click;python_version>=\"3.8\"",
+	})
+	assert.DeepEqual(t, m.Warnings(), []string{
+		"conflicting requirements for requests: requests>=2.0 in requirements.txt and requests==2.28.0 in requirements/base.txt, using requests==2.28.0",
+		"conflicting requirements for flask: flask in requirements.txt and Flask>=2.0 in requirements/base.txt, using Flask>=2.0",
+		"conflicting requirements for flask: Flask>=2.0 in requirements/base.txt and flask==2.0.1 in requirements/extra.txt, using flask==2.0.1",
+	})
+
+	m = newTestManager(t, map[string]string{"main.py": "", "requirements.txt": "-r missing.txt\n"})
+	_, err = m.readDeps(Python)
+	assert.ErrorContains(t, err, "reading missing.txt included by requirements.txt")
+
+	// files included by several files are not cycles
+	m = newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "-r a.txt\n-r b.txt\n",
+		"a.txt":            "-r common.txt\nflask==2.0.1\n",
+		"b.txt":            "-r common.txt\n",
+		"common.txt":       "requests==2.28.0\n",
+	})
+	deps, err = m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"flask==2.0.1", "requests==2.28.0"})
+}
+
+func TestReadRequirementsCircularIncludes(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "two files",
+			files: map[string]string{
+				"requirements.txt": "-r a.txt\n",
+				"a.txt":            "flask==2.0.1\n-r b.txt\n",
+				"b.txt":            "-r a.txt\n",
+			},
+			want: []string{"a.txt", "b.txt", "a.txt"},
+		},
+		{
+			name: "three files",
+			files: map[string]string{
+				"requirements.txt":   "-r reqs/a.txt\n",
+				"reqs/a.txt":         "-r b.txt\n",
+				"reqs/b.txt":         "--requirement=../c.txt\n",
+				"c.txt":              "-r requirements.txt\n",
+				"reqs/unrelated.txt": "",
+			},
+			want: []string{"requirements.txt", "reqs/a.txt", "reqs/b.txt", "c.txt", "requirements.txt"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.files["main.py"] = ""
+			m := newTestManager(t, tc.files)
+			_, err := m.readDeps(Python)
+			assert.Assert(t, errors.Is(err, ErrCircularRequirements))
+			var circular *CircularRequirementsError
+			assert.Assert(t, errors.As(err, &circular))
+			assert.DeepEqual(t, circular.Files, tc.want)
+			assert.ErrorContains(t, err, strings.Join(tc.want, " -> "))
+		})
+	}
+}
+
+func TestDependencyFilePath(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "requests",
+	})
+	path, err := m.DependencyFilePath()
+	assert.NilError(t, err)
+	assert.Equal(t, path, filepath.Join(m.rootDir, "requirements.txt"))
+
+	// the file might not be present
+	m = newTestManager(t, map[string]string{"index.js": ""})
+	path, err = m.DependencyFilePath()
+	assert.NilError(t, err)
+	assert.Equal(t, path, filepath.Join(m.rootDir, "package.json"))
+
+	m = newTestManager(t, map[string]string{
+		"main.py":        "",
+		"pyproject.toml": "[project]\ndependencies = []\n",
+	})
+	path, err = m.DependencyFilePath()
+	assert.NilError(t, err)
+	assert.Equal(t, path, filepath.Join(m.rootDir, "pyproject.toml"))
+
+	m = newTestManager(t, map[string]string{"Dockerfile": "FROM scratch"})
+	_, err = m.DependencyFilePath()
+	assert.Assert(t, errors.Is(err, ErrNoDepFile))
+}
+
+func TestReadCompiledRequirements(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py": "",
+		"requirements.txt": `# This file was autogenerated by uv via the following command:
+#    uv pip compile requirements.in --generate-hashes -o requirements.txt
+--index-url https://pypi.org/simple
+
+anyio==4.2.0 \
+    --hash=sha256:745843b39e829e108e518c489b31dc757de7d2131d53fac32bd8df268227bfee \
+    --hash=sha256:e1875bb4b4e2de1669f4bc7869b6d3f54231cdced71605e6e64c9be77e3be50f
+    # via starlette
+idna==3.6 \
+    --hash=sha256:9ecdbbd083b06798ae1e86adcbfe8ab1479cf864e4ee30fe4e46a003d12491ca
+    # via
+    #   anyio
+    #   requests
+requests==2.31.0 ; python_version >= "3.8" \
+    --hash=sha256:58cd2187c01e70e6e26505bca751777aa9f2ee0b7f4300988b709f44e013003f
+    # via -r requirements.in
+starlette==0.36.3 \
+    --hash=sha256:13d429aa93a61dc40bf503e8c801db1f1bca3dc706b10ef2434a36123568f044
+    # via -r requirements.in
+`,
+	})
+	l := &testLogger{}
+	m.SetLogger(l)
+	deps, err := m.ReadDeps(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"anyio==4.2.0", "idna==3.6", `requests==2.31.0;python_version>="3.8"`, "starlette==0.36.3"})
+	assert.Assert(t, contains(l.debug, "requirements.txt is compiled by uv"))
+
+	// pip-compile annotates deps inline
+	lines := []string{
+		"#",
+		"# This file is autogenerated by pip-compile with Python 3.11",
+		"# by the following command:",
+		"#",
+		"#    pip-compile --generate-hashes",
+		"#",
+		"certifi==2024.2.2 \\",
+		"    --hash=sha256:0569859f95fc761b18b45ef421b1290a0f65f147e92a1e5eb3e635f9a5e4e66f",
+		"urllib3==2.2.1 --hash sha256:450b20ec296a467077128bff42b73080516e71b56ff59a60a02bef2232c4fa9d  # via requests",
+	}
+	assert.Equal(t, compiledBy(lines), "pip-compile")
+	assert.DeepEqual(t, parseRequirements(lines).deps, []string{"certifi==2024.2.2", "urllib3==2.2.1"})
+	assert.Equal(t, compiledBy([]string{"requests==2.31.0"}), "")
+}
+
+func TestReadDepsEmptyDepFile(t *testing.T) {
+	for _, contents := range []string{"", "  \n\t\r\n", "\xef\xbb\xbf\n"} {
+		m := newTestManager(t, map[string]string{"main.py": "", "requirements.txt": contents})
+		deps, err := m.ReadDeps(Python)
+		assert.NilError(t, err)
+		assert.Equal(t, len(deps), 0)
+
+		m = newTestManager(t, map[string]string{"index.js": "", "package.json": contents})
+		deps, err = m.ReadDeps(Node)
+		assert.NilError(t, err)
+		assert.Equal(t, len(deps), 0)
+	}
+
+	// a package.json without dependencies
+	m := newTestManager(t, map[string]string{"index.js": "", "package.json": `{"name": "app", "version": "1.0.0"}`})
+	deps, err := m.ReadDeps(Node)
+	assert.NilError(t, err)
+	assert.Assert(t, deps == nil)
+
+	// emptying the dependency file removes the stored deps
+	m = newTestManager(t, map[string]string{"main.py": "", "requirements.txt": "flask==2.0.1\n"})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9", RuntimeName: Python, Deps: []string{"flask==2.0.1"}}))
+	writeTestFiles(t, m.rootDir, map[string]string{"requirements.txt": "\n"})
+	dc, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.Equal(t, len(dc.Added), 0)
+	assert.DeepEqual(t, dc.Removed, []string{"flask==2.0.1"})
+}
+
+func TestParseBuildSbt(t *testing.T) {
+	sbt := `ThisBuild / scalaVersion := "2.13.10"
+
+val akkaVersion = "2.8.0" // akka
+
+resolvers += "jitpack" at "https://jitpack.io"
+
+lazy val root = (project in file("."))
+  .settings(
+    name := "micro",
+    libraryDependencies += "com.typesafe.akka" %% "akka-actor" % akkaVersion,
+    libraryDependencies += "org.json4s" % "json4s-core_2.13" % "4.0.6",
+    /* libraryDependencies += "org.old" % "old" % "1.0", */
+    libraryDependencies ++= Seq(
+      "org.typelevel" %% "cats-core" % "2.9.0", // (core)
+      "com.lihaoyi" %%% "upickle" % "3.1.0",
+      "ch.qos.logback" % "logback-classic" % "1.4.7" % Runtime,
+      "org.scalatest" %% "scalatest" % "3.2.15" % Test,
+      "org.mockito" % "mockito-core" % "5.3.1" % "test"
+    )
+  )
+`
+	m := newTestManager(t, map[string]string{"build.sbt": sbt, "src/main/scala/Main.scala": "object Main"})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Scala)
+
+	deps, err := m.readDeps(Scala)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{
+		"com.typesafe.akka:akka-actor_2.13@2.8.0",
+		"org.json4s:json4s-core_2.13@4.0.6",
+		"org.typelevel:cats-core_2.13@2.9.0",
+		"com.lihaoyi:upickle_2.13@3.1.0",
+		"ch.qos.logback:logback-classic@1.4.7",
+	})
+
+	// test modules are dev deps
+	assert.DeepEqual(t, parseBuildSbt(sbt, true)[5:], []string{
+		"org.scalatest:scalatest_2.13@3.2.15",
+		"org.mockito:mockito-core@5.3.1",
+	})
+
+	// cross versioned names are kept without a scala version, unresolved versions are dropped
+	assert.DeepEqual(t, parseBuildSbt(`libraryDependencies += "org.typelevel" %% "cats-core" % catsVersion`, false),
+		[]string{"org.typelevel:cats-core"})
+	assert.DeepEqual(t, parseBuildSbt(`scalaVersion := "3.3.0"
+libraryDependencies ++= Seq("org.typelevel" %% "cats-core" % "2.9.0")`, false), []string{"org.typelevel:cats-core_3@2.9.0"})
+
+	// a build without scala sources is not an entrypoint
+	m = newTestManager(t, map[string]string{"build.sbt": sbt})
+	_, err = m.GetRuntime()
+	assert.Assert(t, errors.Is(err, ErrNoEntrypoint))
+}
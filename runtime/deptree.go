@@ -0,0 +1,223 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	packageLockFile = "package-lock.json"
+	pipfileLockFile = "Pipfile.lock"
+)
+
+// package-lock.json, packages is written by npm 7 and later, dependencies by earlier versions
+type packageLock struct {
+	Packages     map[string]lockPackage    `json:"packages"`
+	Dependencies map[string]lockDependency `json:"dependencies"`
+}
+
+type lockPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Dev     bool   `json:"dev"`
+	Link    bool   `json:"link"`
+}
+
+type lockDependency struct {
+	Version      string                    `json:"version"`
+	Dev          bool                      `json:"dev"`
+	Dependencies map[string]lockDependency `json:"dependencies"`
+}
+
+// DepTree returns the sorted deps of the detected runtime including transitive deps as name@version
+// deps are read from the lockfile at their exact resolved versions, see readResolvedDeps
+// for runtimes without a lockfile or if the lockfile is not present, the direct deps are returned with a warning
+func (m *Manager) DepTree() ([]string, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, ok, err := m.readResolvedDeps(r.Name)
+	if err != nil || ok {
+		return resolved, err
+	}
+
+	deps, err := m.readDeps(r.Name)
+	if err != nil {
+		return nil, err
+	}
+	m.warn("no lockfile to read transitive dependencies of the %s runtime from, only direct dependencies are listed", r.Name)
+	sorted := append([]string{}, deps...)
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// parsePackageLock parses the resolved packages of a package-lock.json into sorted unique name@version
+func parsePackageLock(contents []byte, includeDev bool) ([]string, error) {
+	var lock packageLock
+	err := json.Unmarshal(contents, &lock)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	if lock.Packages != nil {
+		for path, p := range lock.Packages {
+			// the root package, workspace packages and links to them are not installed in node_modules
+			i := strings.LastIndex(path, "node_modules/")
+			if i < 0 || p.Link || (p.Dev && !includeDev) || p.Version == "" {
+				continue
+			}
+			name := p.Name
+			if name == "" {
+				// eg: node_modules/a/node_modules/@scope/b is @scope/b
+				name = path[i+len("node_modules/"):]
+			}
+			seen[fmt.Sprintf("%s@%s", name, p.Version)] = struct{}{}
+		}
+	} else {
+		var add func(deps map[string]lockDependency)
+		add = func(deps map[string]lockDependency) {
+			for name, d := range deps {
+				if d.Dev && !includeDev {
+					continue
+				}
+				seen[fmt.Sprintf("%s@%s", name, d.Version)] = struct{}{}
+				add(d.Dependencies)
+			}
+		}
+		add(lock.Dependencies)
+	}
+
+	deps := make([]string, 0, len(seen))
+	for d := range seen {
+		deps = append(deps, d)
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// readResolvedDeps reads the sorted deps of runtime including transitive deps at their exact resolved versions from the lockfile
+// node deps are name@version from package-lock.json or yarn.lock, python deps are name==version from Pipfile.lock
+// dev deps are only read if dev deps are included, returns false if the runtime has no lockfile or it is not present
+func (m *Manager) readResolvedDeps(runtime string) ([]string, bool, error) {
+	var lockfiles []string
+	switch runtime {
+	case Node:
+		lockfiles = []string{packageLockFile, yarnLockFile}
+	case Python:
+		lockfiles = []string{pipfileLockFile}
+	}
+	for _, name := range lockfiles {
+		contents, err := m.readDepFile(name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, false, err
+		}
+		var deps []string
+		switch name {
+		case packageLockFile:
+			deps, err = parsePackageLock(contents, m.includeDevDeps)
+		case yarnLockFile:
+			var lines []string
+			lines, err = readLines(contents)
+			if err == nil {
+				deps, err = yarnLockDeps(lines)
+			}
+		case pipfileLockFile:
+			deps, err = parsePipfileLock(contents, m.includeDevDeps)
+		}
+		if err != nil {
+			return nil, false, invalidDepFile(name, contents, err)
+		}
+		return deps, true, nil
+	}
+	return nil, false, nil
+}
+
+// yarnLockDeps returns the sorted unique resolved packages of a yarn.lock as name@version
+func yarnLockDeps(lines []string) ([]string, error) {
+	resolved, err := parseYarnLock(lines)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	for descriptor, version := range resolved {
+		seen[fmt.Sprintf("%s@%s", depName(Node, descriptor), version)] = struct{}{}
+	}
+	deps := make([]string, 0, len(seen))
+	for d := range seen {
+		deps = append(deps, d)
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// Pipfile.lock, develop has the dev packages
+type pipfileLock struct {
+	Default map[string]pipfileLockPackage `json:"default"`
+	Develop map[string]pipfileLockPackage `json:"develop"`
+}
+
+type pipfileLockPackage struct {
+	Version string `json:"version"` // eg: ==2.28.0
+}
+
+// parsePipfileLock parses the locked packages of a Pipfile.lock into sorted name==version, packages without a version eg: git deps are name
+func parsePipfileLock(contents []byte, includeDev bool) ([]string, error) {
+	var lock pipfileLock
+	err := json.Unmarshal(contents, &lock)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	add := func(packages map[string]pipfileLockPackage) {
+		for name, p := range packages {
+			seen[strings.ToLower(name)+p.Version] = struct{}{}
+		}
+	}
+	add(lock.Default)
+	if includeDev {
+		add(lock.Develop)
+	}
+	deps := make([]string, 0, len(seen))
+	for d := range seen {
+		deps = append(deps, d)
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// GetResolvedDepChanges gets the changes of the deps resolved by the lockfile including transitive deps
+// compared to ResolvedDeps of the program info eg: a transitive dep bumped by the lockfile without a change of the declared deps
+// returns nil if the runtime has no lockfile or the lockfile is not present
+func (m *Manager) GetResolvedDepChanges() (*DepChanges, error) {
+	progInfo, err := m.GetProgInfo()
+	if progInfo == nil || err != nil {
+		return nil, fmt.Errorf("no program information found")
+	}
+	if progInfo.RuntimeName == "" {
+		r, err := m.GetRuntime()
+		if err != nil {
+			return nil, err
+		}
+		progInfo.RuntimeName = r.Name
+	}
+
+	resolved, ok, err := m.readResolvedDeps(progInfo.RuntimeName)
+	if err != nil || !ok {
+		return nil, err
+	}
+	dc := DiffDeps(progInfo.ResolvedDeps, resolved)
+	if dc.IsEmpty() {
+		return nil, nil
+	}
+	return dc, nil
+}
@@ -0,0 +1,156 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDepTree(t *testing.T) {
+	lock := `{
+  "name": "micro",
+  "lockfileVersion": 2,
+  "packages": {
+    "": {"name": "micro", "dependencies": {"express": "^4.17.1"}},
+    "node_modules/express": {"version": "4.17.1"},
+    "node_modules/accepts": {"version": "1.3.7"},
+    "node_modules/mime-types": {"version": "2.1.35"},
+    "node_modules/accepts/node_modules/mime-types": {"version": "2.1.24"},
+    "node_modules/@types/node": {"version": "14.18.0", "dev": true},
+    "node_modules/shared": {"resolved": "packages/shared", "link": true},
+    "packages/shared": {"name": "shared", "version": "1.0.0"}
+  }
+}`
+	m := newTestManager(t, map[string]string{
+		"index.js":          "",
+		"package.json":      `{"dependencies": {"express": "^4.17.1"}}`,
+		"package-lock.json": lock,
+	})
+	deps, err := m.DepTree()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{
+		"accepts@1.3.7", "express@4.17.1", "mime-types@2.1.24", "mime-types@2.1.35",
+	})
+
+	m.SetIncludeDevDeps(true)
+	deps, err = m.DepTree()
+	assert.NilError(t, err)
+	assert.Equal(t, deps[0], "@types/node@14.18.0")
+}
+
+func TestDepTreeLockfileV1(t *testing.T) {
+	lock := `{
+  "lockfileVersion": 1,
+  "dependencies": {
+    "express": {
+      "version": "4.17.1",
+      "dependencies": {"debug": {"version": "2.6.9"}}
+    },
+    "debug": {"version": "4.3.1"},
+    "mocha": {"version": "9.0.0", "dev": true}
+  }
+}`
+	deps, err := parsePackageLock([]byte(lock), false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"debug@2.6.9", "debug@4.3.1", "express@4.17.1"})
+
+	_, err = parsePackageLock([]byte("{"), false)
+	assert.Assert(t, err != nil)
+}
+
+func TestDepTreeNoLockfile(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "requests==2.28.0\nflask==2.0.1\n",
+	})
+	deps, err := m.DepTree()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, []string{"flask==2.0.1", "requests==2.28.0"})
+	assert.Equal(t, len(m.Warnings()), 1)
+
+	m = newTestManager(t, map[string]string{
+		"index.js":          "",
+		"package-lock.json": "{",
+	})
+	_, err = m.DepTree()
+	assert.Assert(t, errors.Is(err, ErrInvalidDepFile))
+}
+
+func TestGetResolvedDepChanges(t *testing.T) {
+	lock := func(accepts string) string {
+		return `{
+  "lockfileVersion": 2,
+  "packages": {
+    "": {"name": "micro", "dependencies": {"express": "^4.17.1"}},
+    "node_modules/express": {"version": "4.17.1"},
+    "node_modules/accepts": {"version": "` + accepts + `"}
+  }
+}`
+	}
+	m := newTestManager(t, map[string]string{
+		"index.js":          "",
+		"package.json":      `{"dependencies": {"express": "^4.17.1"}}`,
+		"package-lock.json": lock("1.3.7"),
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{
+		Runtime:      "nodejs14.x",
+		Deps:         []string{"express@^4.17.1"},
+		ResolvedDeps: []string{"accepts@1.3.7", "express@4.17.1"},
+	}))
+	dc, err := m.GetResolvedDepChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, dc == nil)
+
+	// a transitive dep is bumped without a change of the declared deps
+	writeTestFiles(t, m.rootDir, map[string]string{"package-lock.json": lock("1.3.8")})
+	dc, err = m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, dc == nil)
+	dc, err = m.GetResolvedDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dc.Added, []string{"accepts@1.3.8"})
+	assert.DeepEqual(t, dc.Removed, []string{"accepts@1.3.7"})
+
+	// no lockfile
+	m = newTestManager(t, map[string]string{"main.py": "", "requirements.txt": "flask==2.0.1\n"})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	dc, err = m.GetResolvedDepChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, dc == nil)
+}
+
+func TestReadResolvedDeps(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py": "",
+		"Pipfile": "[packages]\nflask = \"*\"\n",
+		"Pipfile.lock": `{
+  "_meta": {"hash": {"sha256": "abc"}},
+  "default": {"Flask": {"version": "==2.0.1"}, "werkzeug": {"version": "==2.0.3"}, "mylib": {"git": "https://github.com/org/mylib.git"}},
+  "develop": {"pytest": {"version": "==7.0.0"}}
+}`,
+	})
+	deps, ok, err := m.readResolvedDeps(Python)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, deps, []string{"flask==2.0.1", "mylib", "werkzeug==2.0.3"})
+
+	m = newTestManager(t, map[string]string{
+		"index.js":     "",
+		"package.json": `{"dependencies": {"express": "^4.17.1"}}`,
+		"yarn.lock": `express@^4.17.1:
+  version "4.17.1"
+
+"accepts@~1.3.7", accepts@~1.3.8:
+  version "1.3.8"
+`,
+	})
+	deps, ok, err = m.readResolvedDeps(Node)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, deps, []string{"accepts@1.3.8", "express@4.17.1"})
+
+	_, ok, err = m.readResolvedDeps(Ruby)
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+}
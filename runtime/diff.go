@@ -0,0 +1,192 @@
+package runtime
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lines of context around changes in a unified diff
+const diffContext = 3
+
+// UnifiedDiff returns a unified diff of the file in relPath between the snapshot stored by SnapshotContents and the current file
+// relPath is relative to the root dir, files missing from the snapshot or the root dir are diffed as empty files
+// returns an empty diff if the file is unchanged or binary, and ErrNoSnapshot if no snapshot is stored
+func (m *Manager) UnifiedDiff(relPath string) (string, error) {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	old, err := m.readSnapshotFile(relPath)
+	if err != nil {
+		return "", err
+	}
+	current, err := m.readProgFile(filepath.Join(m.rootDir, filepath.FromSlash(relPath)))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if looksBinary(old) || looksBinary(current) {
+		m.debugf("skipping diff of binary file %s", relPath)
+		return "", nil
+	}
+	return unifiedDiff("a/"+relPath, "b/"+relPath, string(old), string(current)), nil
+}
+
+// reads the contents of the file in relPath from the snapshot, nil if the snapshot does not have the file
+func (m *Manager) readSnapshotFile(relPath string) ([]byte, error) {
+	f, err := m.fs.Open(filepath.Join(m.detaPath, snapshotFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoSnapshot
+		}
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot: %w", err)
+		}
+		if hdr.Name == relPath {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
+
+// an edit of a line in a diff
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// splits s into lines without the line endings
+func diffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// computes the line edits from a to b by the longest common subsequence of lines
+func lineEdits(a, b []string) []diffLine {
+	// lcs[i][j] length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var edits []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, diffLine{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return edits
+}
+
+// unifiedDiff returns a unified diff of the lines of a and b, an empty string if they are equal
+func unifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	edits := lineEdits(diffLines(a), diffLines(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(edits); {
+		// find the next change
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		// extend the hunk while changes are within twice the context of each other
+		end := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].op != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+		last := end + diffContext
+		if last > len(edits) {
+			last = len(edits)
+		}
+		writeHunk(&sb, edits, first, last)
+		start = last
+	}
+	return sb.String()
+}
+
+// writes the edits in [first, last) as a hunk
+func writeHunk(sb *strings.Builder, edits []diffLine, first, last int) {
+	// line numbers of the hunk start in a and b
+	aStart, bStart := 1, 1
+	for _, e := range edits[:first] {
+		if e.op != '+' {
+			aStart++
+		}
+		if e.op != '-' {
+			bStart++
+		}
+	}
+	aLen, bLen := 0, 0
+	for _, e := range edits[first:last] {
+		if e.op != '+' {
+			aLen++
+		}
+		if e.op != '-' {
+			bLen++
+		}
+	}
+	// an empty range starts at the line before it
+	if aLen == 0 {
+		aStart--
+	}
+	if bLen == 0 {
+		bStart--
+	}
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+	for _, e := range edits[first:last] {
+		sb.WriteByte(e.op)
+		sb.WriteString(e.text)
+		sb.WriteByte('\n')
+	}
+}
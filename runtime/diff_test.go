@@ -0,0 +1,71 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":  "import os\n\ndef main():\n    print('hello')\n\nmain()\n",
+		"utils.py": "def f(): pass\n",
+		"data.bin": "\x00\x01\x02",
+	})
+	_, err := m.UnifiedDiff("main.py")
+	assert.Assert(t, errors.Is(err, ErrNoSnapshot))
+	assert.NilError(t, m.SnapshotContents())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":  "import os\n\ndef main():\n    print('hello world')\n\nmain()\n",
+		"data.bin": "\x00\x01\x03",
+		"new.py":   "x = 1\n",
+	})
+
+	diff, err := m.UnifiedDiff("main.py")
+	assert.NilError(t, err)
+	assert.Equal(t, diff, `--- a/main.py
++++ b/main.py
+@@ -1,6 +1,6 @@
+ import os
+ 
+ def main():
+-    print('hello')
++    print('hello world')
+ 
+ main()
+`)
+
+	diff, err = m.UnifiedDiff("new.py")
+	assert.NilError(t, err)
+	assert.Equal(t, diff, "--- a/new.py\n+++ b/new.py\n@@ -0,0 +1,1 @@\n+x = 1\n")
+
+	// unchanged and binary files
+	for _, path := range []string{"utils.py", "data.bin"} {
+		diff, err = m.UnifiedDiff(path)
+		assert.NilError(t, err)
+		assert.Equal(t, diff, "")
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\nx\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n"
+	assert.Equal(t, unifiedDiff("a", "b", a, b), `--- a
++++ b
+@@ -1,5 +1,5 @@
+ 1
+-2
++x
+ 3
+ 4
+ 5
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++y
+`)
+}
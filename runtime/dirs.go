@@ -0,0 +1,198 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+)
+
+// map dir path to modification time of the dir in unix nanoseconds
+type dirMap map[string]int64
+
+// size and modification time in unix nanoseconds of a file
+type fileStamp struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+}
+
+func stampOf(info os.FileInfo) fileStamp {
+	return fileStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+}
+
+// modification times of dirs and stamps of files stored with the state
+type dirsRecord struct {
+	Dirs  dirMap               `json:"dirs"`
+	Files map[string]fileStamp `json:"files"`
+}
+
+// SetSkipUnchangedDirs sets if modification times of dirs are stored with the state
+// so GetChanges does not read dirs with the same modification time, eg: to speed up huge trees
+// the modification time of a dir only changes if files or dirs directly in it are created, deleted or renamed,
+// so the stored files of unchanged dirs are stat'ed instead and only hashed if their size or modification time changed
+// dirs in unchanged dirs are still checked, tracked empty dirs are still walked
+func (m *Manager) SetSkipUnchangedDirs(skip bool) {
+	m.dirShortcut = skip
+}
+
+// gets the stored modification times of dirs and stamps of files, returns nil if dirs are not skipped or not stored yet
+func (m *Manager) getStoredDirs() (*dirsRecord, error) {
+	if !m.dirShortcut {
+		return nil, nil
+	}
+	m.filesMu.RLock()
+	contents, err := m.readFile(filepath.Join(m.detaPath, dirsFile))
+	m.filesMu.RUnlock()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var dirs dirsRecord
+	err = json.Unmarshal(contents, &dirs)
+	if err != nil {
+		return nil, err
+	}
+	// records stored without file stamps are not used
+	if dirs.Dirs == nil || dirs.Files == nil {
+		return nil, nil
+	}
+	return &dirs, nil
+}
+
+func (m *Manager) storeDirs(dirs *dirsRecord) error {
+	marshalled, err := json.Marshal(dirs)
+	if err != nil {
+		return err
+	}
+	m.filesMu.Lock()
+	defer m.filesMu.Unlock()
+	return m.writeFileAtomic(filepath.Join(m.detaPath, dirsFile), marshalled, filePermMode)
+}
+
+// walkChangedFiles walks the files of the root dir like walkFiles but does not read dirs with stored modification times
+// that are unchanged, the paths of storedState directly in those dirs are stat'ed instead and passed to fn
+// if their size or modification time changed, onUnchanged is called with the others
+// dirs with unchanged stored digests are not walked into either, onUnchanged is called with the paths of storedState
+// anywhere under them
+// files of storedState that are always uploaded are passed to fn
+func (m *Manager) walkChangedFiles(runtime string, storedState stateMap, fn func(path string, info os.FileInfo) error,
+	onUnchanged func(storedPath string), onSkipped func(path string, special bool)) error {
+	stored, err := m.getStoredDirs()
+	if err != nil {
+		return err
+	}
+	var storedDirs dirMap
+	var stamps map[string]fileStamp
+	if stored != nil {
+		storedDirs, stamps = stored.Dirs, stored.Files
+	}
+	unchangedTrees, err := m.unchangedTrees(runtime)
+	if err != nil {
+		return err
+	}
+	if storedDirs == nil && unchangedTrees == nil {
+		return m.walkFiles(runtime, fn, onSkipped)
+	}
+
+	// files in unchanged trees have unchanged digests, files in unchanged dirs are stat'ed
+	visitStored := func(path string, inTree bool) error {
+		if inTree && storedState[path] != "" {
+			onUnchanged(path)
+			return nil
+		}
+		info, err := m.fs.Lstat(filepath.Join(m.rootDir, filepath.FromSlash(path)))
+		if err != nil {
+			// deleted files are reported as deletions
+			if !inTree && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if stamp, ok := stamps[path]; ok && stamp == stampOf(info) && storedState[path] != "" {
+			onUnchanged(path)
+			return nil
+		}
+		return fn(filepath.FromSlash(path), info)
+	}
+
+	skippedTrees := make(map[string]bool)
+	var unchanged []string
+	onDir := func(path string, info os.FileInfo) error {
+		dir, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if unchangedTrees[dir] {
+			m.debugf("skipping unchanged tree %s", dir)
+			skippedTrees[dir] = true
+			return filepath.SkipDir
+		}
+		if mtime, ok := storedDirs[dir]; ok && mtime == info.ModTime().UnixNano() {
+			m.debugf("skipping unchanged dir %s", dir)
+			unchanged = append(unchanged, dir)
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if unchangedTrees["."] {
+		m.debugf("skipping unchanged tree .")
+		skippedTrees["."] = true
+	} else {
+		err = m.walkFilesFrom(runtime, ".", fn, onDir, onSkipped)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(unchanged) > 0 {
+		files := make(map[string][]string)
+		for path := range storedState {
+			if !isEmptyDirKey(path) {
+				files[pathpkg.Dir(path)] = append(files[pathpkg.Dir(path)], path)
+			}
+		}
+		subDirs := make(map[string][]string)
+		for dir := range storedDirs {
+			subDirs[pathpkg.Dir(dir)] = append(subDirs[pathpkg.Dir(dir)], dir)
+		}
+
+		// dirs in unchanged dirs can have changed, onDir adds them to unchanged if they have not
+		for len(unchanged) > 0 {
+			dir := unchanged[0]
+			unchanged = unchanged[1:]
+
+			for _, path := range files[dir] {
+				if err := visitStored(path, false); err != nil {
+					return err
+				}
+			}
+			for _, sub := range subDirs[dir] {
+				err = m.walkFilesFrom(runtime, filepath.FromSlash(sub), fn, onDir, onSkipped)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if len(skippedTrees) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(storedState))
+	for path := range storedState {
+		if !isEmptyDirKey(path) && inTrees(path, skippedTrees) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := visitStored(path, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSkipUnchangedDirs(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":           "print('hello')",
+		"a/x.py":            "x = 1",
+		"a/c/z.py":          "z = 1",
+		"b/y.py":            "y = 1",
+		"a/assets/logo.png": "png",
+	})
+	m.SetSkipUnchangedDirs(true)
+	m.SetAlwaysUpload([]string{".png"}, 0)
+	l := &testLogger{}
+	m.SetLogger(l)
+
+	// modification times of dirs in the past so changes below change them
+	past := time.Now().Add(-time.Hour)
+	for _, dir := range []string{"a", "a/c", "a/assets", "b"} {
+		assert.NilError(t, os.Chtimes(filepath.Join(m.rootDir, filepath.FromSlash(dir)), past, past))
+	}
+	assert.NilError(t, m.StoreState())
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.AlwaysUpload, []string{"a/assets/logo.png"})
+	assert.DeepEqual(t, sortedKeys(sc.Changes), []string{"a/assets/logo.png"})
+	assert.Equal(t, len(sc.Deletions), 0)
+
+	// a file modified in place in an unchanged dir is hashed again without reading the dir
+	writeTestFiles(t, m.rootDir, map[string]string{"a/x.py": "x = 2"})
+	assert.NilError(t, os.Chtimes(filepath.Join(m.rootDir, "a"), past, past))
+	// created and deleted files change the dirs
+	writeTestFiles(t, m.rootDir, map[string]string{"b/new.py": "new = 1", "a/c/w.py": "w = 1"})
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "a", "c", "z.py")))
+
+	l.debug = nil
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sortedKeys(sc.Changes), []string{"a/assets/logo.png", "a/c/w.py", "a/x.py", "b/new.py"})
+	assert.Equal(t, sc.Changes["a/x.py"], "x = 2")
+	assert.DeepEqual(t, sc.Deletions, []string{"a/c/z.py"})
+	assert.Assert(t, contains(l.debug, "skipping unchanged dir a"))
+	assert.Assert(t, !contains(l.debug, "skipping unchanged dir b"))
+	assert.Assert(t, !contains(l.debug, "skipping unchanged dir a/c"))
+
+	// without the shortcut every file is walked
+	m.SetSkipUnchangedDirs(false)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Equal(t, sc.Changes["a/x.py"], "x = 2")
+}
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignore file of the build context of the custom runtime
+const dockerignoreFile = ".dockerignore"
+
+// a pattern of a .dockerignore file
+type dockerPattern struct {
+	segments  []string // slash separated segments of the glob
+	exception bool     // the pattern starts with ! and includes paths
+}
+
+// reads the patterns of the .dockerignore file in the root dir, a missing file has no patterns
+func (m *Manager) readDockerignore() error {
+	contents, err := m.readFile(filepath.Join(m.rootDir, dockerignoreFile))
+	if err != nil {
+		return err
+	}
+	lines, err := readLines(contents)
+	if err != nil {
+		return err
+	}
+	m.dockerPatterns = parseDockerignore(lines)
+	return nil
+}
+
+// parses lines of a .dockerignore file like docker
+// patterns are relative to the root dir with or without a leading / eg: *.log only matches logs in the root dir unlike gitignore
+// ** matches any number of dirs, lines starting with # are comments and invalid patterns are skipped
+func parseDockerignore(lines []string) []dockerPattern {
+	var patterns []dockerPattern
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		exception := strings.HasPrefix(line, "!")
+		if exception {
+			line = strings.TrimSpace(line[1:])
+		}
+		line = strings.TrimPrefix(path.Clean(filepath.ToSlash(line)), "/")
+		if line == "" || line == "." || line == ".." || strings.HasPrefix(line, "../") {
+			continue
+		}
+		if _, err := matchGlob(line, ""); err != nil {
+			continue
+		}
+		patterns = append(patterns, dockerPattern{segments: strings.Split(line, "/"), exception: exception})
+	}
+	return patterns
+}
+
+// checks if a slash separated path relative to the root dir is excluded by the .dockerignore patterns
+// a path is matched by a pattern matching the path or any of its parent dirs, the last matching pattern decides
+// returns false for matched if no pattern matches
+func (m *Manager) matchDockerignore(slashPath string, isDir bool) (skip bool, matched bool) {
+	parts := strings.Split(slashPath, "/")
+	for _, p := range m.dockerPatterns {
+		for i := range parts {
+			if ok, _ := matchGlobSegments(p.segments, parts[:i+1]); ok {
+				skip, matched = !p.exception, true
+				break
+			}
+		}
+	}
+	// excluded dirs with exceptions under them are walked into so the exceptions are included
+	if skip && isDir {
+		for _, p := range m.dockerPatterns {
+			if p.exception && mayMatchUnder(p.segments, parts) {
+				return false, true
+			}
+		}
+	}
+	return skip, matched
+}
+
+// checks if pattern can match paths under the dir of dirParts
+func mayMatchUnder(pattern, dirParts []string) bool {
+	for _, part := range dirParts {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], part); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+	}
+	return len(pattern) > 0
+}
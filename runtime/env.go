@@ -0,0 +1,139 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parseEnvFile parses lines of an env file into keys and values
+// lines can be prefixed with export, values can be single quoted which are taken literally
+// or double quoted or unquoted which can have ${VAR} references to earlier keys or the process env
+// double quoted values can have escapes eg: \n, \", unquoted values can have comments after a space
+func parseEnvFile(lines []string) (map[string]string, error) {
+	envs := make(map[string]string)
+	for n, l := range lines {
+		l = strings.TrimSpace(l)
+		// skip empty lines and commentes #
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		l = strings.TrimPrefix(l, "export ")
+
+		sepIndex := strings.Index(l, "=")
+		// expect format KEY=VALUE
+		if sepIndex <= 0 || strings.ContainsAny(strings.TrimSpace(l[:sepIndex]), " \t") {
+			return nil, fmt.Errorf("unexpected format in line %d, expected KEY=VALUE", n+1)
+		}
+		key := strings.TrimSpace(l[:sepIndex])
+		value, err := parseEnvValue(strings.TrimSpace(l[sepIndex+1:]), envs)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		envs[key] = value
+	}
+	return envs, nil
+}
+
+// parses the value of an env line, references are resolved against envs and the process env
+func parseEnvValue(raw string, envs map[string]string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+		if err := checkEnvValueEnd(raw[end+2:]); err != nil {
+			return "", err
+		}
+		return raw[1 : end+1], nil
+	case '"':
+		var sb strings.Builder
+		for i := 1; i < len(raw); i++ {
+			switch c := raw[i]; c {
+			case '"':
+				if err := checkEnvValueEnd(raw[i+1:]); err != nil {
+					return "", err
+				}
+				return expandEnvRefs(sb.String(), envs)
+			case '\\':
+				i++
+				if i == len(raw) {
+					return "", fmt.Errorf("unterminated double quoted value")
+				}
+				switch raw[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				case 'r':
+					sb.WriteByte('\r')
+				case '$':
+					// escaped $ is not a reference
+					sb.WriteString(escapedDollar)
+				default:
+					sb.WriteByte(raw[i])
+				}
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quoted value")
+	}
+
+	// comments in unquoted values start after a space
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return expandEnvRefs(raw, envs)
+}
+
+// placeholder for an escaped $ while expanding references
+const escapedDollar = "\x00$"
+
+// only a comment can follow a quoted value
+func checkEnvValueEnd(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected '%s' after quoted value", rest)
+	}
+	return nil
+}
+
+// expands ${VAR} references with earlier keys of envs or the process env
+func expandEnvRefs(value string, envs map[string]string) (string, error) {
+	var sb strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		// an escaped $ is not a reference
+		if start > 0 && value[start-1] == '\x00' {
+			sb.WriteString(value[:start+2])
+			value = value[start+2:]
+			continue
+		}
+		if start < 0 {
+			sb.WriteString(value)
+			break
+		}
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference '%s'", value[start:])
+		}
+		name := value[start+2 : start+end]
+		if name == "" {
+			return "", fmt.Errorf("empty reference '${}'")
+		}
+		sb.WriteString(value[:start])
+		if v, ok := envs[name]; ok {
+			sb.WriteString(v)
+		} else {
+			sb.WriteString(os.Getenv(name))
+		}
+		value = value[start+end+1:]
+	}
+	return strings.ReplaceAll(sb.String(), escapedDollar, "$"), nil
+}
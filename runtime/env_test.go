@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	os.Setenv("DETA_TEST_HOME", "/home/deta")
+	defer os.Unsetenv("DETA_TEST_HOME")
+
+	lines := []string{
+		"# comment",
+		"export HOST=localhost",
+		"PORT=8080 # inline comment",
+		"URL=http://${HOST}:${PORT}/api",
+		`QUOTED="hello ${HOST}\n\"world\""`,
+		`LITERAL='${HOST} \n stays'`,
+		`ESCAPED="\${HOST}"`,
+		"DATA=${DETA_TEST_HOME}/data",
+		"MISSING=${DETA_TEST_MISSING}",
+		"EQUALS=a=b",
+		"EMPTY=",
+	}
+	envs, err := parseEnvFile(lines)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, envs, map[string]string{
+		"HOST":    "localhost",
+		"PORT":    "8080",
+		"URL":     "http://localhost:8080/api",
+		"QUOTED":  "hello localhost\n\"world\"",
+		"LITERAL": `${HOST} \n stays`,
+		"ESCAPED": "${HOST}",
+		"DATA":    "/home/deta/data",
+		"MISSING": "",
+		"EQUALS":  "a=b",
+		"EMPTY":   "",
+	})
+}
+
+func TestParseEnvFileErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{"NOVALUE", "unexpected format in line 2, expected KEY=VALUE"},
+		{"BAD KEY=value", "unexpected format in line 2, expected KEY=VALUE"},
+		{`KEY="unterminated`, "line 2: unterminated double quoted value"},
+		{`KEY='unterminated`, "line 2: unterminated single quoted value"},
+		{"KEY=${UNTERMINATED", "line 2: unterminated reference '${UNTERMINATED'"},
+		{`KEY="value" extra`, "line 2: unexpected 'extra' after quoted value"},
+	}
+	for _, tc := range tests {
+		_, err := parseEnvFile([]string{"OK=1", tc.line})
+		assert.ErrorContains(t, err, tc.err)
+	}
+}
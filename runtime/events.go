@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// EventType type of an event of a walk
+type EventType string
+
+const (
+	// EventDiscovered a file that is not skipped was found
+	EventDiscovered EventType = "discovered"
+	// EventSkipped a file or dir was skipped, files of skipped dirs have no events
+	EventSkipped EventType = "skipped"
+	// EventHashed the checksum of a file was calculated
+	EventHashed EventType = "hashed"
+	// EventError walking or reading a path failed
+	EventError EventType = "error"
+)
+
+// Event an event of a walk written as a line of json by the writer of WithEventWriter
+type Event struct {
+	Type     EventType     `json:"type"`
+	Path     string        `json:"path"`               // relative to the root dir with forward slashes
+	Size     int64         `json:"size,omitempty"`     // size in bytes of discovered and hashed files
+	Duration time.Duration `json:"duration,omitempty"` // nanoseconds hashing took
+	Error    string        `json:"error,omitempty"`
+}
+
+// writes events as json lines, safe for concurrent use
+type eventStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// WithEventWriter writes events of walks eg: discovered, skipped and hashed files as json lines to w
+// so tools in other processes can follow the progress, events of concurrent reads are written in the order they happen
+func WithEventWriter(w io.Writer) Option {
+	return func(m *Manager) {
+		m.events = &eventStream{enc: json.NewEncoder(w)}
+	}
+}
+
+// emits an event if an event writer is set, path is relative to the root dir
+func (m *Manager) emit(e Event) {
+	if m.events == nil {
+		return
+	}
+	e.Path = filepath.ToSlash(e.Path)
+	m.events.mu.Lock()
+	defer m.events.mu.Unlock()
+	if err := m.events.enc.Encode(e); err != nil {
+		m.debugf("writing event: %v", err)
+	}
+}
+
+// emits an error event for path if err is not nil
+func (m *Manager) emitError(path string, err error) {
+	if err != nil {
+		m.emit(Event{Type: EventError, Path: path, Error: err.Error()})
+	}
+}
@@ -0,0 +1,64 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// reads the json lines of events written to buf
+func readEvents(t *testing.T, buf *bytes.Buffer) []Event {
+	var events []Event
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var e Event
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &e), scanner.Text())
+		events = append(events, e)
+	}
+	assert.NilError(t, scanner.Err())
+	return events
+}
+
+func TestEventWriter(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		".env":         "KEY=VALUE",
+	})
+	var buf bytes.Buffer
+	m, err := NewManager(&m.rootDir, true, WithEventWriter(&buf))
+	assert.NilError(t, err)
+
+	assert.NilError(t, m.StoreState())
+	events := readEvents(t, &buf)
+	var got []string
+	for _, e := range events {
+		got = append(got, string(e.Type)+" "+e.Path)
+	}
+	assert.DeepEqual(t, got, []string{
+		"skipped .deta",
+		"skipped .env",
+		"discovered lib/utils.py",
+		"hashed lib/utils.py",
+		"discovered main.py",
+		"hashed main.py",
+	})
+	assert.Equal(t, events[2].Size, int64(len("def f(): pass")))
+	assert.Equal(t, events[3].Size, int64(len("def f(): pass")))
+
+	// a failed read is an error event
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "main.py")))
+	_, err = m.calcChecksum(filepath.Join(m.rootDir, "main.py"))
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	events = readEvents(t, &buf)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Type, EventError)
+	assert.Equal(t, events[0].Path, "main.py")
+	assert.Assert(t, events[0].Error != "")
+}
@@ -0,0 +1,148 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// schema version of bundles written by Export
+const bundleSchemaVersion = 1
+
+// Bundle the program info, dependencies and tracked files of a program in one portable document
+// tracked files are listed with their checksums without contents
+type Bundle struct {
+	SchemaVersion int       `json:"schema_version"`
+	ProgInfo      *ProgInfo `json:"prog_info,omitempty"`
+	Deps          []string  `json:"deps"`
+	State         stateMap  `json:"state,omitempty"` // paths relative to the root dir to checksums
+	EnvRedacted   bool      `json:"env_redacted,omitempty"`
+	// contents of tracked text files by path relative to the root dir with secrets redacted, if exported with contents
+	Files map[string]string `json:"files,omitempty"`
+	// sorted paths of files with redacted values
+	Redacted []string `json:"redacted,omitempty"`
+}
+
+// ExportOption configures optional settings of Export
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	redactEnv bool
+	contents  bool
+}
+
+// WithRedactedEnv leaves the checksums of env values out of the exported program info
+// so short secrets can not be guessed from their checksums, names of env vars are still exported
+func WithRedactedEnv() ExportOption {
+	return func(o *exportOptions) {
+		o.redactEnv = true
+	}
+}
+
+// WithFileContents exports the contents of the tracked text files of the root dir
+// values matching the redaction rules of .deta/secrets are replaced with *** eg: .env* =(.+)
+// see readRedactRules, contents of binary files are not exported
+func WithFileContents() ExportOption {
+	return func(o *exportOptions) {
+		o.contents = true
+	}
+}
+
+// Export writes the program info, the current deps of the runtime and the checksums of the stored state as a json bundle to w
+// eg: to attach the view of the cli of a project to a support ticket, the bundle can be restored with Import
+func (m *Manager) Export(w io.Writer, opts ...ExportOption) error {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	progInfo, err := m.GetProgInfo()
+	if err != nil {
+		return err
+	}
+	r, err := m.GetRuntime()
+	if err != nil {
+		return err
+	}
+	deps, err := m.readDeps(r.Name)
+	if err != nil {
+		return err
+	}
+	state, err := m.getStoredState()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if progInfo != nil && o.redactEnv {
+		progInfo.Env = nil
+	}
+	b := &Bundle{
+		SchemaVersion: bundleSchemaVersion,
+		ProgInfo:      progInfo,
+		Deps:          deps,
+		State:         state,
+		EnvRedacted:   o.redactEnv,
+	}
+	if o.contents {
+		err = m.exportContents(b)
+		if err != nil {
+			return err
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// adds the redacted contents of the tracked text files to b
+func (m *Manager) exportContents(b *Bundle) error {
+	rules, err := m.readRedactRules()
+	if err != nil {
+		return err
+	}
+	sc, err := m.readAll()
+	if err != nil {
+		if errors.Is(err, ErrNoFiles) {
+			return nil
+		}
+		return err
+	}
+	b.Files = make(map[string]string, len(sc.Changes))
+	for path, contents := range sc.Changes {
+		redacted, ok := redact(rules, path, contents)
+		b.Files[path] = redacted
+		if ok {
+			b.Redacted = append(b.Redacted, path)
+		}
+	}
+	sort.Strings(b.Redacted)
+	return nil
+}
+
+// Import restores the program info and the stored state from a bundle written by Export
+// parts missing from the bundle are not changed, deps are read from the dependency files and are not restored
+// neither are contents of files
+func (m *Manager) Import(r io.Reader) error {
+	var b Bundle
+	err := json.NewDecoder(r).Decode(&b)
+	if err != nil {
+		return fmt.Errorf("reading bundle: %w", err)
+	}
+	if b.SchemaVersion > bundleSchemaVersion {
+		return fmt.Errorf("bundle schema version %d is not supported, update the cli", b.SchemaVersion)
+	}
+
+	if b.ProgInfo != nil {
+		err = m.StoreProgInfo(b.ProgInfo)
+		if err != nil {
+			return err
+		}
+	}
+	if b.State != nil {
+		return m.storeStateMap(b.State)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	files := map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "flask==2.0.1\n",
+	}
+	m := newTestManager(t, files)
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{
+		Name:    "micro",
+		Runtime: "python3.9",
+		Deps:    []string{"flask==2.0.1"},
+		Envs:    []string{"SECRET"},
+		Env:     map[string]string{"SECRET": HashEnvValue("hunter2")},
+	}))
+	assert.NilError(t, m.StoreState())
+
+	var buf bytes.Buffer
+	assert.NilError(t, m.Export(&buf))
+	var b Bundle
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &b))
+	assert.DeepEqual(t, b.Deps, []string{"flask==2.0.1"})
+	assert.Equal(t, len(b.State), 2)
+	assert.Equal(t, b.ProgInfo.Env["SECRET"], HashEnvValue("hunter2"))
+	// contents of files are not exported
+	assert.Assert(t, !bytes.Contains(buf.Bytes(), []byte("print('hello')")))
+
+	// round trip into a copy of the program
+	other := newTestManager(t, files)
+	assert.NilError(t, other.Import(bytes.NewReader(buf.Bytes())))
+	want, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	got, err := other.GetProgInfo()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, want)
+	sc, err := other.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// redacted env
+	buf.Reset()
+	assert.NilError(t, m.Export(&buf, WithRedactedEnv()))
+	b = Bundle{}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &b))
+	assert.Assert(t, b.EnvRedacted)
+	assert.Assert(t, b.ProgInfo.Env == nil)
+	assert.DeepEqual(t, b.ProgInfo.Envs, []string{"SECRET"})
+
+	assert.ErrorContains(t, other.Import(bytes.NewReader([]byte(`{"schema_version": 2}`))), "not supported")
+}
+
+func TestExportFileContents(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":        "print('hello')",
+		".env":           "API_KEY=hunter2\nDEBUG=1\n",
+		"config/db.yaml": "user: admin\npassword: s3cret\n",
+		filepath.Join(".deta", secretsFile): "# redacted values\n" +
+			".env* API_KEY=(.+)\n" +
+			"config/*.yaml password: (.+)\n",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	m.SetIncludeHidden([]string{".env"})
+
+	var buf bytes.Buffer
+	assert.NilError(t, m.Export(&buf, WithFileContents()))
+	var b Bundle
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &b))
+	assert.DeepEqual(t, b.Files, map[string]string{
+		"main.py":        "print('hello')",
+		".env":           "API_KEY=***\nDEBUG=1\n",
+		"config/db.yaml": "user: admin\npassword: ***\n",
+	})
+	assert.DeepEqual(t, b.Redacted, []string{".env", "config/db.yaml"})
+	assert.Assert(t, !bytes.Contains(buf.Bytes(), []byte("hunter2")))
+
+	// changes are not redacted
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.Equal(t, sc.Changes[".env"], "API_KEY=hunter2\nDEBUG=1\n")
+
+	// invalid rules
+	writeTestFiles(t, m.rootDir, map[string]string{filepath.Join(".deta", secretsFile): ".env (unclosed\n"})
+	assert.ErrorContains(t, m.Export(&buf, WithFileContents()), "line 1")
+}
@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package runtime
+
+import "os"
+
+// file ids are not available, hard links are not detected
+func getFileID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
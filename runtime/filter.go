@@ -0,0 +1,134 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FilterAction what a filter decides for a file or dir of a walk of the root dir
+type FilterAction int
+
+const (
+	// FilterPass leaves the decision to the next filter of the chain, files and dirs no filter decides for are included
+	FilterPass FilterAction = iota
+	// FilterInclude includes the file or dir without applying the next filters
+	FilterInclude
+	// FilterSkip skips the file or dir, a skipped dir is still walked into
+	FilterSkip
+	// FilterSkipDir skips the dir and does not walk into it, for files it is FilterSkip
+	FilterSkipDir
+)
+
+// reasons of the built-in filters
+const (
+	reasonDepth      = "depth"
+	reasonSpecial    = "special"
+	reasonBrokenLink = "broken link"
+)
+
+// Filter decides if a file or dir of a walk of the root dir for runtime is included and returns the reason eg: hidden
+// path is relative to the root dir, info is of the symlink for symlinks unless symlinks are followed
+// an error stops the walk
+type Filter func(runtime, path string, info os.FileInfo) (FilterAction, string, error)
+
+// SetFilters sets the chain of filters deciding which files and dirs of the root dir are walked
+// by every walk eg: of StoreState, GetChanges, readAll and ListFiles, and by IsIgnored
+// filters are applied in order and the first filter that does not pass decides, nil restores DefaultFilters
+// the .deta dir is skipped regardless of the filters
+// eg: m.SetFilters(append(m.DefaultFilters(), MaxSizeFilter(1<<20)))
+func (m *Manager) SetFilters(filters []Filter) {
+	m.filters = filters
+}
+
+// DefaultFilters returns the built-in filters in the order they are applied by default
+// ignore rules: hidden files, .detaignore, ignore and prune of .deta/config.json and default patterns of the runtime, see shouldSkip
+// depth: dirs deeper than the max depth of SetMaxDepth, an error if the depth is strict
+// special files: named pipes, sockets, devices, links to them and broken links
+func (m *Manager) DefaultFilters() []Filter {
+	return []Filter{m.ignoreFilter, m.depthFilter, m.specialFilter}
+}
+
+// MaxSizeFilter skips files larger than size bytes, links to files are of the size of their targets
+func MaxSizeFilter(size int64) Filter {
+	return func(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+		if !info.IsDir() && info.Size() > size {
+			return FilterSkip, fmt.Sprintf("larger than %d bytes", size), nil
+		}
+		return FilterPass, "", nil
+	}
+}
+
+// applyFilters applies the filter chain to a file or dir of a walk, the first filter that does not pass decides
+// returns FilterInclude if no filter decides, .deta dirs are never walked into regardless of the filters
+func (m *Manager) applyFilters(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+	filters := m.filters
+	if filters == nil {
+		filters = m.defaultFilters
+	}
+	action, reason := FilterInclude, reasonIncluded
+	for _, f := range filters {
+		a, r, err := f(runtime, path, info)
+		if err != nil {
+			return FilterPass, "", err
+		}
+		if a != FilterPass {
+			action, reason = a, r
+			break
+		}
+	}
+	if !info.IsDir() {
+		if action == FilterSkipDir {
+			action = FilterSkip
+		}
+	} else if action != FilterSkipDir && filepath.Base(path) == detaDir {
+		return FilterSkipDir, "prune:" + detaDir, nil
+	}
+	return action, reason, nil
+}
+
+// skips files and dirs by the ignore rules of shouldSkip, skipped dirs are not walked into
+func (m *Manager) ignoreFilter(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+	skip, reason, err := m.skipReason(path, runtime, info.IsDir())
+	if err != nil || !skip {
+		return FilterPass, "", err
+	}
+	if info.IsDir() {
+		return FilterSkipDir, reason, nil
+	}
+	return FilterSkip, reason, nil
+}
+
+// skips dirs deeper than the max depth, or fails if the depth is strict
+func (m *Manager) depthFilter(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+	if !info.IsDir() || m.maxDepth <= 0 || len(strings.Split(path, string(os.PathSeparator))) <= m.maxDepth {
+		return FilterPass, "", nil
+	}
+	if m.strictDepth {
+		return FilterPass, "", fmt.Errorf("%w: %s is deeper than %d dirs", ErrMaxDepthExceeded, path, m.maxDepth)
+	}
+	m.debugf("pruning dir %s: deeper than %d dirs", path, m.maxDepth)
+	return FilterSkipDir, reasonDepth, nil
+}
+
+// skips special files and links to them, opening them can block or fail, and broken links
+func (m *Manager) specialFilter(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+	if info.IsDir() {
+		return FilterPass, "", nil
+	}
+	special := isSpecialFile(info)
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := m.fs.Stat(filepath.Join(m.rootDir, path))
+		if err != nil && os.IsNotExist(err) {
+			m.debugf("skipping broken link %s", path)
+			return FilterSkip, reasonBrokenLink, nil
+		}
+		special = err == nil && isSpecialFile(target)
+	}
+	if special {
+		m.debugf("skipping special file %s", path)
+		return FilterSkip, reasonSpecial, nil
+	}
+	return FilterPass, "", nil
+}
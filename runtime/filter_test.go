@@ -0,0 +1,123 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// returns the files of every walk of m by the name of the walk
+func walkedFiles(t *testing.T, m *Manager) map[string][]string {
+	t.Helper()
+	walked := make(map[string][]string)
+
+	listed, err := m.ListFiles()
+	assert.NilError(t, err)
+	walked["ListFiles"] = listed
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	walked["readAll"] = changedPaths(sc)
+
+	assert.NilError(t, m.StoreState())
+	sm, err := m.getStoredState()
+	assert.NilError(t, err)
+	var stored []string
+	for path := range sm {
+		stored = append(stored, path)
+	}
+	sort.Strings(stored)
+	walked["StoreState"] = stored
+
+	// every file is a change against an empty state
+	assert.NilError(t, m.storeStateMap(stateMap{}))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	walked["GetChanges"] = changedPaths(sc)
+
+	var filtered []string
+	assert.NilError(t, m.WalkFiltered(func(string, os.FileInfo) bool { return true }, func(relPath string) error {
+		filtered = append(filtered, relPath)
+		return nil
+	}))
+	sort.Strings(filtered)
+	walked["WalkFiltered"] = filtered
+	return walked
+}
+
+// asserts every walk of m has the files want
+func assertWalked(t *testing.T, m *Manager, want []string) {
+	t.Helper()
+	for name, files := range walkedFiles(t, m) {
+		assert.DeepEqual(t, files, want)
+		assert.Assert(t, len(files) == len(want), name)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":              "print('hello')",
+		"lib/big.py":           strings.Repeat("x = 1\n", 50),
+		"app.log":              "started",
+		"data/big.csv":         strings.Repeat("1,2,3\n", 100),
+		"tmp/scratch.py":       "x = 1",
+		".env":                 "KEY=value",
+		"__pycache__/main.pyc": "\x00",
+		".detaignore":          "\\.csv$\n",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+
+	// the default filters
+	assertWalked(t, m, []string{".detaignore", "app.log", "lib/big.py", "main.py", "tmp/scratch.py"})
+
+	// custom filters apply to every walk
+	skipLogs := func(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+		if filepath.Ext(path) == ".log" {
+			return FilterSkip, "log", nil
+		}
+		return FilterPass, "", nil
+	}
+	skipTmp := func(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+		if path == "tmp" {
+			return FilterSkipDir, "scratch", nil
+		}
+		return FilterPass, "", nil
+	}
+	includeEnv := func(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+		if path == ".env" {
+			return FilterInclude, "env", nil
+		}
+		return FilterPass, "", nil
+	}
+	m.SetFilters(append([]Filter{includeEnv}, append(m.DefaultFilters(), skipLogs, skipTmp, MaxSizeFilter(100))...))
+	assertWalked(t, m, []string{".detaignore", ".env", "main.py"})
+
+	assert.Assert(t, m.IsIgnored("app.log"))
+	assert.Assert(t, m.IsIgnored("tmp/scratch.py"))
+	assert.Assert(t, m.IsIgnored("lib/big.py"))
+	assert.Assert(t, !m.IsIgnored(".env"))
+	report, err := m.IgnoreReport()
+	assert.NilError(t, err)
+	assert.Equal(t, report["app.log"], "log")
+	assert.Equal(t, report["tmp/scratch.py"], "scratch")
+	assert.Equal(t, report["lib/big.py"], "larger than 100 bytes")
+	assert.Equal(t, report["data/big.csv"], ".detaignore:"+m.ignorePatterns[0].Value.String())
+	assert.Equal(t, report["main.py"], reasonIncluded)
+
+	// skipped dirs that are walked into
+	m.SetFilters([]Filter{func(runtime, path string, info os.FileInfo) (FilterAction, string, error) {
+		if info.IsDir() {
+			return FilterSkip, "dir", nil
+		}
+		return FilterPass, "", nil
+	}})
+	assertWalked(t, m, []string{".detaignore", ".env", "__pycache__/main.pyc", "app.log", "data/big.csv", "lib/big.py", "main.py", "tmp/scratch.py"})
+
+	// nil restores the default filters
+	m.SetFilters(nil)
+	assertWalked(t, m, []string{".detaignore", "app.log", "lib/big.py", "main.py", "tmp/scratch.py"})
+}
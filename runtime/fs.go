@@ -0,0 +1,116 @@
+package runtime
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem the file system operations of a Manager on the root dir and the deta dir
+// eg: to inject a fake in tests that simulates errors, latency or special files
+type FileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	// ReadDir reads the dir like ioutil.ReadDir, infos are sorted by name
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	// Walk walks the tree rooted at root like filepath.Walk, infos passed to fn are not of targets of symlinks
+	Walk(root string, fn filepath.WalkFunc) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	// OpenFile opens a file for writing like os.OpenFile
+	OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error)
+	Remove(name string) error
+	RemoveAll(path string) error
+	Chmod(name string, mode os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	Rename(oldpath, newpath string) error
+	// EvalSymlinks returns the path after evaluating symlinks like filepath.EvalSymlinks
+	EvalSymlinks(path string) (string, error)
+	// Glob returns the names of the files and dirs matching pattern like filepath.Glob
+	Glob(pattern string) ([]string, error)
+}
+
+// osFS the file system of the os
+type osFS struct{}
+
+func (osFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
+func (osFS) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, fn)
+}
+
+func (osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (osFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) EvalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
+func (osFS) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+// WithFileSystem sets the file system all files are read from and written to including the user info in the home dir
+// defaults to the file system of the os
+func WithFileSystem(fs FileSystem) Option {
+	return func(m *Manager) {
+		m.fs = fs
+	}
+}
+
+// writes data to a temp file next to name and renames it to name
+// so a crash or a failed write does not leave name partially written
+func (m *Manager) writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmpPath := name + ".tmp"
+	err := m.fs.WriteFile(tmpPath, data, perm)
+	if err != nil {
+		m.fs.Remove(tmpPath)
+		return err
+	}
+	err = m.fs.Rename(tmpPath, name)
+	if err != nil {
+		m.fs.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,547 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// openFS replaces Open of a file system
+type openFS struct {
+	FileSystem
+	open func(name string) (io.ReadCloser, error)
+}
+
+func (fs openFS) Open(name string) (io.ReadCloser, error) {
+	return fs.open(name)
+}
+
+// countFS counts the reads of a file system
+type countFS struct {
+	FileSystem
+	mu    sync.Mutex
+	calls int
+}
+
+func (fs *countFS) count() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.calls
+}
+
+func (fs *countFS) inc() {
+	fs.mu.Lock()
+	fs.calls++
+	fs.mu.Unlock()
+}
+
+func (fs *countFS) Open(name string) (io.ReadCloser, error) {
+	fs.inc()
+	return fs.FileSystem.Open(name)
+}
+
+func (fs *countFS) Stat(name string) (os.FileInfo, error) {
+	fs.inc()
+	return fs.FileSystem.Stat(name)
+}
+
+func (fs *countFS) Lstat(name string) (os.FileInfo, error) {
+	fs.inc()
+	return fs.FileSystem.Lstat(name)
+}
+
+func (fs *countFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	fs.inc()
+	return fs.FileSystem.ReadDir(dirname)
+}
+
+func (fs *countFS) Walk(root string, fn filepath.WalkFunc) error {
+	fs.inc()
+	return fs.FileSystem.Walk(root, fn)
+}
+
+type memFile struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+type memInfo struct {
+	name string
+	file memFile
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.file.data)) }
+func (i memInfo) Mode() os.FileMode  { return i.file.mode }
+func (i memInfo) ModTime() time.Time { return i.file.modTime }
+func (i memInfo) IsDir() bool        { return i.file.mode.IsDir() }
+func (i memInfo) Sys() interface{}   { return nil }
+
+// memFS an in memory file system of the files under root, other paths are passed on to the file system of the os
+// operations fail with the errors queued in errs by op:full path eg: open:/prog/main.py, one error per call
+type memFS struct {
+	mu    sync.Mutex
+	root  string
+	files map[string]memFile // by slash separated path relative to root, dirs are implicit
+	errs  map[string][]error
+	calls map[string]int // calls by op:full path
+}
+
+func newMemFS(root string, files map[string]string) *memFS {
+	fs := &memFS{
+		root:  root,
+		files: make(map[string]memFile),
+		errs:  make(map[string][]error),
+		calls: make(map[string]int),
+	}
+	for name, contents := range files {
+		fs.files[name] = memFile{data: []byte(contents), mode: filePermMode, modTime: time.Unix(0, 0)}
+	}
+	return fs
+}
+
+// returns the path relative to root, false if name is not under root
+func (fs *memFS) rel(name string) (string, bool) {
+	rel, err := filepath.Rel(fs.root, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// counts the call and returns the next error queued for it
+func (fs *memFS) call(op, name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	key := op + ":" + name
+	fs.calls[key]++
+	if errs := fs.errs[key]; len(errs) > 0 {
+		fs.errs[key] = errs[1:]
+		return &os.PathError{Op: op, Path: name, Err: errs[0]}
+	}
+	return nil
+}
+
+func (fs *memFS) stat(rel string) (os.FileInfo, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if f, ok := fs.files[rel]; ok {
+		return memInfo{name: pathpkg.Base(rel), file: f}, true
+	}
+	for name := range fs.files {
+		if rel == "." || strings.HasPrefix(name, rel+"/") {
+			return memInfo{name: pathpkg.Base(rel), file: memFile{mode: os.ModeDir | dirPermMode}}, true
+		}
+	}
+	return nil, false
+}
+
+func (fs *memFS) Open(name string) (io.ReadCloser, error) {
+	rel, ok := fs.rel(name)
+	if !ok {
+		return os.Open(name)
+	}
+	if err := fs.call("open", name); err != nil {
+		return nil, err
+	}
+	info, ok := fs.stat(rel)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("opening %s: not a regular file", name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(info.(memInfo).file.data)), nil
+}
+
+func (fs *memFS) Stat(name string) (os.FileInfo, error) {
+	rel, ok := fs.rel(name)
+	if !ok {
+		return os.Stat(name)
+	}
+	if err := fs.call("stat", name); err != nil {
+		return nil, err
+	}
+	info, ok := fs.stat(rel)
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return info, nil
+}
+
+// files of memFS are not symlinks
+func (fs *memFS) Lstat(name string) (os.FileInfo, error) {
+	if _, ok := fs.rel(name); !ok {
+		return os.Lstat(name)
+	}
+	return fs.Stat(name)
+}
+
+func (fs *memFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	rel, ok := fs.rel(dirname)
+	if !ok {
+		return ioutil.ReadDir(dirname)
+	}
+	if err := fs.call("readdir", dirname); err != nil {
+		return nil, err
+	}
+	info, ok := fs.stat(rel)
+	if !ok || !info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: dirname, Err: os.ErrNotExist}
+	}
+	fs.mu.Lock()
+	names := make(map[string]bool)
+	for name := range fs.files {
+		if rel != "." && !strings.HasPrefix(name, rel+"/") {
+			continue
+		}
+		child := strings.TrimPrefix(name, rel+"/")
+		if rel == "." {
+			child = name
+		}
+		names[strings.SplitN(child, "/", 2)[0]] = true
+	}
+	fs.mu.Unlock()
+	infos := make([]os.FileInfo, 0, len(names))
+	for name := range names {
+		info, _ := fs.stat(pathpkg.Join(rel, name))
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (fs *memFS) Walk(root string, fn filepath.WalkFunc) error {
+	rel, ok := fs.rel(root)
+	if !ok {
+		return filepath.Walk(root, fn)
+	}
+	fs.mu.Lock()
+	paths := map[string]bool{rel: true}
+	for name := range fs.files {
+		if rel != "." && name != rel && !strings.HasPrefix(name, rel+"/") {
+			continue
+		}
+		for p := name; p != rel && p != "."; p = pathpkg.Dir(p) {
+			paths[p] = true
+		}
+	}
+	fs.mu.Unlock()
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var skipped []string
+	for _, p := range sorted {
+		if len(skipped) > 0 && strings.HasPrefix(p, skipped[len(skipped)-1]+"/") {
+			continue
+		}
+		full := filepath.Join(fs.root, filepath.FromSlash(p))
+		info, _ := fs.stat(p)
+		err := fs.call("walk", full)
+		if err != nil {
+			err = fn(full, nil, err)
+		} else {
+			err = fn(full, info, nil)
+		}
+		if err == filepath.SkipDir && info != nil && info.IsDir() {
+			skipped = append(skipped, p)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *memFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	rel, ok := fs.rel(name)
+	if err := fs.call("write", name); err != nil {
+		return err
+	}
+	if !ok {
+		return ioutil.WriteFile(name, data, perm)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.files[rel] = memFile{data: data, mode: perm, modTime: time.Now()}
+	return nil
+}
+
+// memWriter a file of memFS opened for writing, the file is written on Close
+type memWriter struct {
+	bytes.Buffer
+	fs   *memFS
+	name string
+	perm os.FileMode
+}
+
+func (w *memWriter) Close() error {
+	return w.fs.WriteFile(w.name, w.Bytes(), w.perm)
+}
+
+func (fs *memFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	if _, ok := fs.rel(name); !ok {
+		return os.OpenFile(name, flag, perm)
+	}
+	if flag&os.O_EXCL != 0 {
+		if _, err := fs.Stat(name); err == nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+	}
+	return &memWriter{fs: fs, name: name, perm: perm}, nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	rel, ok := fs.rel(name)
+	if !ok {
+		return os.Remove(name)
+	}
+	if err := fs.call("remove", name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.files[rel]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(fs.files, rel)
+	return nil
+}
+
+func (fs *memFS) Chmod(name string, mode os.FileMode) error {
+	rel, ok := fs.rel(name)
+	if !ok {
+		return os.Chmod(name, mode)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[rel]
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+	}
+	f.mode = f.mode&^os.ModePerm | mode.Perm()
+	fs.files[rel] = f
+	return nil
+}
+
+func (fs *memFS) MkdirAll(path string, perm os.FileMode) error {
+	if _, ok := fs.rel(path); !ok {
+		return os.MkdirAll(path, perm)
+	}
+	return fs.call("mkdir", path)
+}
+
+func (fs *memFS) Rename(oldpath, newpath string) error {
+	oldRel, oldOk := fs.rel(oldpath)
+	newRel, newOk := fs.rel(newpath)
+	if !oldOk && !newOk {
+		return os.Rename(oldpath, newpath)
+	}
+	if err := fs.call("rename", oldpath); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[oldRel]
+	if !oldOk || !newOk || !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrInvalid}
+	}
+	delete(fs.files, oldRel)
+	fs.files[newRel] = f
+	return nil
+}
+
+func (fs *memFS) RemoveAll(path string) error {
+	rel, ok := fs.rel(path)
+	if !ok {
+		return os.RemoveAll(path)
+	}
+	if err := fs.call("remove", path); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for name := range fs.files {
+		if rel == "." || name == rel || strings.HasPrefix(name, rel+"/") {
+			delete(fs.files, name)
+		}
+	}
+	return nil
+}
+
+// files of memFS are not symlinks
+func (fs *memFS) EvalSymlinks(path string) (string, error) {
+	rel, ok := fs.rel(path)
+	if !ok {
+		return filepath.EvalSymlinks(path)
+	}
+	if _, ok := fs.stat(rel); !ok {
+		return "", &os.PathError{Op: "lstat", Path: path, Err: os.ErrNotExist}
+	}
+	return filepath.Clean(path), nil
+}
+
+func (fs *memFS) Glob(pattern string) ([]string, error) {
+	rel, ok := fs.rel(pattern)
+	if !ok {
+		return filepath.Glob(pattern)
+	}
+	if _, err := pathpkg.Match(rel, ""); err != nil {
+		return nil, filepath.ErrBadPattern
+	}
+	fs.mu.Lock()
+	matches := make(map[string]bool)
+	for name := range fs.files {
+		// files and their parent dirs
+		for p := name; p != "."; p = pathpkg.Dir(p) {
+			if ok, _ := pathpkg.Match(rel, p); ok {
+				matches[p] = true
+			}
+		}
+	}
+	fs.mu.Unlock()
+	var names []string
+	for p := range matches {
+		names = append(names, filepath.Join(fs.root, filepath.FromSlash(p)))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// returns a manager of the files of an in memory file system with the state stored in a temp dir
+func newMemManager(t *testing.T, files map[string]string) (*Manager, *memFS) {
+	tmp := newTestManager(t, nil)
+	root, err := filepath.Abs(filepath.Join(tmp.rootDir, "mem"))
+	assert.NilError(t, err)
+	fs := newMemFS(root, files)
+	m, err := NewManager(&root, true, WithFileSystem(fs), WithDetaPath(tmp.detaPath))
+	assert.NilError(t, err)
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9", RuntimeName: Python}))
+	m.SetRetries(2, time.Millisecond)
+	m.SetConcurrency(1)
+	return m, fs
+}
+
+func TestMemFileSystem(t *testing.T) {
+	m, fs := newMemManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	fs.files["pipe"] = memFile{mode: os.ModeNamedPipe | filePermMode}
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/utils.py", "main.py"})
+	// special files are not opened
+	assert.DeepEqual(t, sc.SkippedSpecial, []string{"pipe"})
+	assert.Equal(t, fs.calls["open:"+filepath.Join(fs.root, "pipe")], 0)
+
+	assert.NilError(t, m.StoreState())
+	fs.files["main.py"] = memFile{data: []byte("print('updated')"), mode: filePermMode, modTime: time.Now()}
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"main.py"})
+
+	// the root dir is read and deleted files are pruned in the file system
+	r, err := m.ForceDetectRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Python)
+	assert.Equal(t, fs.calls["readdir:"+fs.root], 1)
+
+	delete(fs.files, "lib/utils.py")
+	pruned, err := m.PruneDeletions()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, pruned, []string{"lib/utils.py"})
+}
+
+func TestMemFileSystemDirs(t *testing.T) {
+	m, fs := newMemManager(t, map[string]string{".env": ""})
+	empty, err := m.IsProgDirEmpty()
+	assert.NilError(t, err)
+	assert.Assert(t, empty)
+	assert.Equal(t, fs.calls["readdir:"+fs.root], 1)
+
+	fs.files["lib/a/package.json"] = memFile{data: []byte("{}"), mode: filePermMode}
+	empty, err = m.IsProgDirEmpty()
+	assert.NilError(t, err)
+	assert.Assert(t, !empty)
+
+	dirs, err := m.fs.Glob(filepath.Join(fs.root, "lib", "*"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dirs, []string{filepath.Join(fs.root, "lib", "a")})
+}
+
+func TestFileSystemErrors(t *testing.T) {
+	files := map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	}
+
+	t.Run("transient open errors are retried", func(t *testing.T) {
+		m, fs := newMemManager(t, files)
+		path := filepath.Join(fs.root, "lib", "utils.py")
+		fs.errs["open:"+path] = []error{syscall.EAGAIN, syscall.EINTR}
+		sc, err := m.readAll()
+		assert.NilError(t, err)
+		assert.Equal(t, sc.Changes["lib/utils.py"], "def f(): pass")
+		assert.Equal(t, fs.calls["open:"+path], 3)
+	})
+
+	t.Run("retries are exhausted", func(t *testing.T) {
+		m, fs := newMemManager(t, files)
+		path := filepath.Join(fs.root, "main.py")
+		fs.errs["open:"+path] = []error{syscall.ETIMEDOUT, syscall.ETIMEDOUT, syscall.ETIMEDOUT}
+		_, err := m.readAll()
+		assert.Assert(t, errors.Is(err, syscall.ETIMEDOUT))
+		assert.ErrorContains(t, err, path)
+	})
+
+	t.Run("permission denied is not retried", func(t *testing.T) {
+		m, fs := newMemManager(t, files)
+		assert.NilError(t, m.StoreState())
+		// a changed file is not in the checksum cache
+		fs.files["main.py"] = memFile{data: []byte("print('updated')"), mode: filePermMode, modTime: time.Now()}
+		path := filepath.Join(fs.root, "main.py")
+		fs.errs["open:"+path] = []error{os.ErrPermission}
+		calls := fs.calls["open:"+path]
+		_, err := m.GetChanges()
+		assert.Assert(t, errors.Is(err, os.ErrPermission))
+		assert.Equal(t, fs.calls["open:"+path], calls+1)
+	})
+
+	t.Run("walk errors fail the walk", func(t *testing.T) {
+		m, fs := newMemManager(t, files)
+		fs.errs["walk:"+filepath.Join(fs.root, "lib")] = []error{os.ErrPermission}
+		_, err := m.readAll()
+		assert.Assert(t, errors.Is(err, os.ErrPermission))
+		assert.ErrorContains(t, err, "walking")
+	})
+
+	t.Run("failed state writes are returned", func(t *testing.T) {
+		m, fs := newMemManager(t, files)
+		fs.errs["write:"+m.statePath+".tmp"] = []error{syscall.ENOSPC}
+		err := m.StoreState()
+		assert.Assert(t, errors.Is(err, syscall.ENOSPC))
+		// the state is not stored
+		_, err = m.getStoredState()
+		assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	})
+}
@@ -0,0 +1,44 @@
+package runtime
+
+import "os"
+
+// identifies a file by device and inode
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// files seen in a walk by their file id, nil if hard links are not deduplicated
+type hardlinks map[fileID]string
+
+// SetDedupHardlinks sets if hard links to the same file are read and counted once when walking the root dir
+// the first path of the file in walk order is read, other paths are reported in Hardlinks of the changes
+// without contents, so callers can upload them from the contents of the first path
+// files are identified by device and inode on unix, hard links are not detected on other platforms
+func (m *Manager) SetDedupHardlinks(dedup bool) {
+	m.dedupLinks = dedup
+}
+
+// returns a tracker of hard links for a walk, nil if hard links are not deduplicated
+func (m *Manager) newHardlinks() hardlinks {
+	if !m.dedupLinks {
+		return nil
+	}
+	return make(hardlinks)
+}
+
+// returns the path of the file seen before that path is a hard link to, records path if it is the first
+func (h hardlinks) original(path string, info os.FileInfo) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	id, ok := getFileID(info)
+	if !ok {
+		return "", false
+	}
+	if orig, ok := h[id]; ok {
+		return orig, true
+	}
+	h[id] = path
+	return "", false
+}
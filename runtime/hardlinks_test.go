@@ -0,0 +1,72 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDedupHardlinks(t *testing.T) {
+	if goruntime.GOOS == "windows" {
+		t.Skip("hard links are not detected on windows")
+	}
+	m := newTestManager(t, map[string]string{
+		"main.py":       "print('hello')",
+		"lib/assets.js": "const a = 1",
+	})
+	assert.NilError(t, os.Link(filepath.Join(m.rootDir, "lib", "assets.js"), filepath.Join(m.rootDir, "lib", "copy.js")))
+
+	// hard links are counted twice by default
+	stats, err := m.Stats()
+	assert.NilError(t, err)
+	assert.Equal(t, stats.FileCount, 3)
+
+	m.SetDedupHardlinks(true)
+	stats, err = m.Stats()
+	assert.NilError(t, err)
+	assert.Equal(t, stats.FileCount, 2)
+	assert.Equal(t, stats.TotalBytes, int64(len("print('hello')")+len("const a = 1")))
+	assert.Equal(t, stats.Hardlinks, 1)
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/assets.js", "main.py"})
+	assert.DeepEqual(t, sc.Hardlinks, map[string]string{"lib/copy.js": "lib/assets.js"})
+
+	// a stored hard link is not a deletion
+	assert.NilError(t, m.StoreState())
+	sm, err := m.getStoredState()
+	assert.NilError(t, err)
+	sm["lib/copy.js"] = sm["lib/assets.js"]
+	assert.NilError(t, m.storeStateMap(sm))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// a new hard link is a change
+	assert.NilError(t, os.Link(filepath.Join(m.rootDir, "main.py"), filepath.Join(m.rootDir, "main2.py")))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc != nil)
+	assert.DeepEqual(t, sc.Hardlinks, map[string]string{"main2.py": "main.py"})
+	assert.Equal(t, len(sc.Changes), 0)
+
+	// updating the state stores the link with the checksum of the file it links to
+	assert.NilError(t, m.UpdateState(sc))
+	sm, err = m.getStoredState()
+	assert.NilError(t, err)
+	assert.Equal(t, sm["main2.py"], sm["main.py"])
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// the links of a changed file are changed
+	writeTestFiles(t, m.rootDir, map[string]string{"lib/assets.js": "const a = 2"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/assets.js"})
+	assert.DeepEqual(t, sc.Hardlinks, map[string]string{"lib/copy.js": "lib/assets.js"})
+}
@@ -0,0 +1,248 @@
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// shouldSkip checks if a file or dir should be skipped, skipped dirs are not walked into
+// the .deta dir is always skipped and the .detaignore file never, for the custom runtime the patterns of .dockerignore decide first
+// other paths are matched against layers in order
+// and the first layer that matches decides, so the allowlist overrides ignores which override defaults
+// allowlist: negated patterns of .detaignore eg: !\.env and hidden files and dirs included with SetIncludeHidden
+// ignores: patterns of .detaignore, ignore globs and, for dirs, prune patterns of .deta/config.json
+// defaults: default patterns of the runtime eg: node_modules, output dirs eg: dist and hidden files and dirs
+// patterns of later lines of .detaignore take precedence over earlier lines
+func (m *Manager) shouldSkip(path string, runtime string, isDir bool) (bool, error) {
+	skip, _, err := m.skipReason(path, runtime, isDir)
+	return skip, err
+}
+
+// reasons of IgnoreReport for paths that are not skipped by a pattern
+const (
+	reasonIncluded = "included"
+	reasonHidden   = "hidden"
+	reasonDefault  = "default"
+)
+
+// skipReason checks if a file or dir should be skipped like shouldSkip and returns the reason it is skipped or included
+// eg: hidden, .detaignore:<pattern>, prune:node_modules, see IgnoreReport
+func (m *Manager) skipReason(path string, runtime string, isDir bool) (bool, string, error) {
+	if path == "." {
+		return false, reasonIncluded, nil
+	}
+	// do not skip .detaignore file
+	if regexp.MustCompile(ignoreFile).MatchString(path) {
+		return false, reasonIncluded, nil
+	}
+	slash := filepath.ToSlash(path)
+
+	// the build context of the custom runtime is what docker sends, which always has the Dockerfile and the .dockerignore file
+	if runtime == Custom && filepath.Base(path) != detaDir {
+		if slash == dockerfile || slash == dockerignoreFile {
+			return false, reasonIncluded, nil
+		}
+		if skip, ok := m.matchDockerignore(slash, isDir); ok {
+			if skip {
+				m.debugf("skipping %s: matches a pattern of %s", path, dockerignoreFile)
+				return true, dockerignoreFile, nil
+			}
+			return false, reasonIncluded, nil
+		}
+	}
+
+	ignorePattern, ignoreMatched := matchPatterns(m.ignorePatterns, slash)
+	if ignoreMatched && !ignorePattern.Skip && filepath.Base(path) != detaDir {
+		return false, reasonIncluded, nil
+	}
+	hidden, err := m.isHidden(path)
+	if err != nil {
+		return false, "", err
+	}
+	if hidden && m.isIncludedHidden(path) {
+		return false, reasonIncluded, nil
+	}
+
+	if ignoreMatched {
+		m.debugf("skipping %s: matches pattern %s of %s", path, ignorePattern.Value, ignoreFile)
+		return true, ignoreFile + ":" + ignorePattern.Value.String(), nil
+	}
+	if m.isConfigIgnored(path) {
+		m.debugf("skipping %s: ignored by %s", path, configFile)
+		return true, configFile + ":ignore", nil
+	}
+	if isDir && m.isPruned(path) {
+		m.debugf("skipping %s: pruned by %s", path, configFile)
+		return true, configFile + ":prune", nil
+	}
+
+	if p, ok := matchPatterns(m.skipPaths[runtime], slash); ok {
+		if !p.Skip {
+			return false, reasonIncluded, nil
+		}
+		m.debugf("skipping %s: matches pattern %s", path, p.Value)
+		if isDir {
+			return true, "prune:" + filepath.Base(path), nil
+		}
+		return true, reasonDefault, nil
+	}
+	if isDir && contains(m.outputDirs, filepath.Base(path)) {
+		if m.isTrackedDir(slash) {
+			m.debugf("walking output dir %s: it has stored files", path)
+			return false, reasonIncluded, nil
+		}
+		m.debugf("skipping %s: output dir", path)
+		return true, "prune:" + filepath.Base(path), nil
+	}
+	if hidden {
+		m.debugf("skipping hidden %s", path)
+		return true, reasonHidden, nil
+	}
+	return false, reasonIncluded, nil
+}
+
+// returns the first pattern of patterns matching path
+func matchPatterns(patterns []Pattern, path string) (Pattern, bool) {
+	for _, p := range patterns {
+		if p.Value.MatchString(path) {
+			return p, true
+		}
+	}
+	return Pattern{}, false
+}
+
+// IsIgnored checks if a path relative to the root dir is skipped when walking the root dir eg: for debugging ignore rules
+// a path is ignored if it is skipped or any of its parent dirs is not walked into by the filters, see SetFilters
+// paths that do not exist are checked against the ignore rules only, see shouldSkip for the order rules are applied in
+func (m *Manager) IsIgnored(relPath string) bool {
+	var runtime string
+	if r, err := m.GetRuntime(); err == nil {
+		runtime = r.Name
+	}
+
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(relPath)), "/")
+	for i := range parts {
+		path := filepath.FromSlash(strings.Join(parts[:i+1], "/"))
+		last := i == len(parts)-1
+		info, err := m.fs.Lstat(filepath.Join(m.rootDir, path))
+		if err != nil {
+			skip, err := m.shouldSkip(path, runtime, !last)
+			if err != nil || skip {
+				return true
+			}
+			continue
+		}
+		action, _, err := m.applyFilters(runtime, path, info)
+		if err != nil || action == FilterSkipDir || (last && action == FilterSkip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoreReport walks the whole root dir including skipped dirs and returns the reason every path relative to the root dir
+// is included or skipped by the filters eg: for debugging ignore rules, paths in dirs that are not walked into have the reason of the dir
+// reasons are included, hidden, .detaignore:<pattern>, .dockerignore, config.json:ignore, config.json:prune,
+// prune:<dir> for dirs skipped by default eg: prune:node_modules, default for files skipped by default eg: *.pyc,
+// depth, special, broken link and the reasons of filters set with SetFilters
+func (m *Manager) IgnoreReport() (map[string]string, error) {
+	var runtime string
+	if r, err := m.GetRuntime(); err == nil {
+		runtime = r.Name
+	}
+
+	report := make(map[string]string)
+	// dirs that are not walked into
+	pruned := make(map[string]bool)
+	err := m.fs.Walk(m.rootDir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		slash, err := m.relPath(fullPath)
+		if err != nil || slash == "." {
+			return err
+		}
+		if parent := pathpkg.Dir(slash); pruned[parent] {
+			report[slash] = report[parent]
+			pruned[slash] = info.IsDir()
+			return nil
+		}
+		action, reason, err := m.applyFilters(runtime, filepath.FromSlash(slash), info)
+		if err != nil {
+			return err
+		}
+		report[slash] = reason
+		pruned[slash] = action == FilterSkipDir
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// OpenTracked opens the file in relPath relative to the root dir if it is tracked, so tools do not read files that are not uploaded
+// returns an error wrapping ErrNotTracked for paths outside of the root dir, ignored files and dirs
+// contents are transformed if a content transform is set
+func (m *Manager) OpenTracked(relPath string) (io.ReadCloser, error) {
+	clean := filepath.Clean(filepath.FromSlash(relPath))
+	if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%w: '%s' is not in the root dir", ErrNotTracked, relPath)
+	}
+	if m.IsIgnored(clean) {
+		return nil, fmt.Errorf("%w: '%s' is ignored", ErrNotTracked, relPath)
+	}
+	path := filepath.Join(m.rootDir, clean)
+	info, err := m.fs.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%w: '%s' is a dir", ErrNotTracked, relPath)
+	}
+
+	if m.transform != nil {
+		contents, err := m.readProgFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(contents)), nil
+	}
+	return m.fs.Open(path)
+}
+
+// sets the dirs of the files of the stored state sm
+func (m *Manager) setTrackedDirs(sm stateMap) {
+	dirs := make(map[string]bool)
+	for path := range sm {
+		for dir := pathpkg.Dir(path); dir != "." && !dirs[dir]; dir = pathpkg.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	m.trackedDirsMu.Lock()
+	m.trackedDirs = dirs
+	m.trackedDirsMu.Unlock()
+}
+
+// if files in the dir at the slash separated path are stored in the state
+func (m *Manager) isTrackedDir(path string) bool {
+	m.trackedDirsMu.Lock()
+	loaded := m.trackedDirs != nil
+	m.trackedDirsMu.Unlock()
+	if !loaded {
+		// sets the tracked dirs, no dirs are tracked without a stored state
+		if _, err := m.getStoredState(); err != nil {
+			m.setTrackedDirs(nil)
+		}
+	}
+	m.trackedDirsMu.Lock()
+	defer m.trackedDirsMu.Unlock()
+	return m.trackedDirs[path]
+}
@@ -0,0 +1,241 @@
+package runtime
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestIsIgnored(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		".deta/config.json": `{
+			"ignore": ["docs/**", "**/*.log"],
+			"prune": ["build"],
+			"include_hidden": [".env.example", ".secret"]
+		}`,
+		".detaignore":  "\\.secret\nnotes\n!keep\\.log\nvenv\n!venv\ntmp\n!\\.deta\n",
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	m.SetIncludeHidden(append(m.includeHidden, ".gitkeep"))
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"main.py", false},
+		{".detaignore", false},
+		// allowlist overrides ignores
+		{".secret", false},
+		{"keep.log", false},
+		// ignores override defaults
+		{"notes", true},
+		{"docs/index.md", true},
+		{"lib/debug.log", true},
+		{"build/out.py", true},
+		{"lib/build/out.py", true},
+		{"tmp/cache.py", true},
+		// later lines of .detaignore override earlier lines
+		{"venv/lib.py", false},
+		// defaults
+		{"__pycache__/a.pyc", true},
+		{".git/config", true},
+		{".env.example", false},
+		{"lib/.gitkeep", false},
+		// the deta dir is always ignored
+		{".deta/state", true},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, m.IsIgnored(tc.path), tc.ignored, tc.path)
+	}
+}
+
+func TestOutputDirs(t *testing.T) {
+	files := map[string]string{
+		"main.py":               "print('hello')",
+		"dist/bundle.js":        "",
+		"build/out.py":          "",
+		"target/app":            "",
+		"lib/__pycache__/x.pyc": "",
+		"lib/dist/nested.js":    "",
+		"lib/builder.py":        "",
+		"lib/target.py":         "",
+		"docs/build.md":         "",
+	}
+	m := newTestManager(t, files)
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"docs/build.md", "lib/builder.py", "lib/target.py", "main.py"})
+
+	// custom output dirs
+	m.SetOutputDirs([]string{"docs"})
+	sc, err = m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{
+		"build/out.py", "dist/bundle.js", "lib/builder.py", "lib/dist/nested.js", "lib/target.py", "main.py", "target/app",
+	})
+
+	// disabled
+	m.SetOutputDirs(nil)
+	sc, err = m.readAll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(changedPaths(sc)), 8)
+
+	// explicit rules of .detaignore win
+	files[ignoreFile] = "!^dist\nlib/target\\.py\n"
+	m = newTestManager(t, files)
+	sc, err = m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{ignoreFile, "dist/bundle.js", "docs/build.md", "lib/builder.py", "main.py"})
+}
+
+func TestOpenTracked(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		".env":         "SECRET=1",
+		"notes/a.txt":  "notes",
+		ignoreFile:     "notes",
+	})
+
+	r, err := m.OpenTracked("lib/utils.py")
+	assert.NilError(t, err)
+	contents, err := ioutil.ReadAll(r)
+	assert.NilError(t, err)
+	assert.NilError(t, r.Close())
+	assert.Equal(t, string(contents), "def f(): pass")
+
+	for _, path := range []string{".env", "notes/a.txt", "lib", "../main.py", "lib/../../main.py", "/etc/passwd", ".deta/state"} {
+		_, err := m.OpenTracked(path)
+		assert.Assert(t, errors.Is(err, ErrNotTracked), path)
+	}
+
+	_, err = m.OpenTracked("missing.py")
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestDockerignore(t *testing.T) {
+	files := map[string]string{
+		"Dockerfile": "FROM python:3.9\n",
+		".dockerignore": `# patterns are anchored to the root dir unlike gitignore
+*.log
+/tmp
+docs
+**/*.md
+!docs/keep.md
+Dockerfile
+.dockerignore
+`,
+		"app.py":              "",
+		"debug.log":           "",
+		"logs/app.log":        "",
+		"tmp/cache":           "",
+		"src/tmp/cache":       "",
+		"docs/guide.txt":      "",
+		"docs/keep.md":        "",
+		"src/docs/index.html": "",
+		"src/docs/readme.md":  "",
+		".env":                "",
+	}
+	m := newTestManager(t, files)
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Custom)
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sortedKeys(sc.Changes), []string{
+		".dockerignore",
+		"Dockerfile",
+		"app.py",
+		"docs/keep.md",
+		"logs/app.log",
+		"src/docs/index.html",
+		"src/tmp/cache",
+	})
+
+	// .dockerignore only applies to the custom runtime
+	files["main.py"] = ""
+	m = newTestManager(t, files)
+	sc, err = m.readAll()
+	assert.NilError(t, err)
+	_, ok := sc.Changes["debug.log"]
+	assert.Assert(t, ok)
+}
+
+func TestIgnoreReport(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":                  "",
+		"lib/utils.py":             "",
+		"lib/utils.pyc":            "",
+		".env":                     "",
+		".github/workflows/ci.yml": "",
+		"node_modules/x/index.js":  "",
+		"dist/app.js":              "",
+		"docs/index.md":            "",
+		"secrets.txt":              "",
+		ignoreFile:                 "docs\nsecrets\\.txt\n",
+	})
+	report, err := m.IgnoreReport()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report, map[string]string{
+		".deta":                    "prune:.deta",
+		".detaignore":              "included",
+		".env":                     "default",
+		".github":                  "hidden",
+		".github/workflows":        "hidden",
+		".github/workflows/ci.yml": "hidden",
+		"dist":                     "prune:dist",
+		"dist/app.js":              "prune:dist",
+		"docs":                     ".detaignore:docs",
+		"docs/index.md":            ".detaignore:docs",
+		"lib":                      "included",
+		"lib/utils.py":             "included",
+		"lib/utils.pyc":            "default",
+		"main.py":                  "included",
+		"node_modules":             "included",
+		"node_modules/x":           "included",
+		"node_modules/x/index.js":  "included",
+		"secrets.txt":              `.detaignore:secrets\.txt`,
+	})
+}
+
+func TestOutputDirsOfStoredFiles(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":    "print('hello')",
+		"build/x.py": "x = 1",
+		"dist/y.js":  "",
+	})
+	// stored before output dirs were skipped
+	m.SetOutputDirs(nil)
+	assert.NilError(t, m.StoreState())
+
+	m.SetOutputDirs(defaultOutputDirs)
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// stored files of output dirs are tracked, other output dirs are skipped
+	writeTestFiles(t, m.rootDir, map[string]string{"build/x.py": "x = 2", "target/app": ""})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"build/x.py"})
+	assert.Equal(t, len(sc.Deletions), 0)
+
+	// a new manager reads the tracked dirs from the stored state
+	m, err = NewManager(&m.rootDir, false)
+	assert.NilError(t, err)
+	assert.Assert(t, !m.IsIgnored("dist/y.js"))
+	assert.Assert(t, m.IsIgnored("target/app"))
+
+	// untracked with .detaignore
+	writeTestFiles(t, m.rootDir, map[string]string{ignoreFile: "^build$\n"})
+	m, err = NewManager(&m.rootDir, false)
+	assert.NilError(t, err)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Deletions, []string{"build/x.py"})
+}
@@ -1,47 +1,144 @@
 package runtime
 
-import "encoding/json"
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
 
 // DepChanges changes in dependencies
 type DepChanges struct {
-	Added   []string
-	Removed []string
+	Added      []string
+	Removed    []string
+	Editable   []string // editable installs eg: -e . which are not installed
+	LocalPaths []string // local path requirements eg: ./libs/foo which are not installed
+	Unpinned   []string // deps without an exact version pin, set if pin check is enabled
+	RemoteDeps []string // python deps installed from a url or version control eg: git+https://... instead of the package index
+	// dependency files of other runtimes which are present but ignored eg: a stray package.json of a python program
+	IgnoredDepFiles []string
+	// the dependency file was removed while deps were stored eg: to warn about an accidental removal
+	DepFileRemoved bool
+}
+
+// IsEmpty checks if there are no added or removed dependencies
+func (d *DepChanges) IsEmpty() bool {
+	return d == nil || (len(d.Added) == 0 && len(d.Removed) == 0)
+}
+
+// String renders added and removed deps in sorted order eg: +requests@2.28.0  -flask@1.1.4
+func (d *DepChanges) String() string {
+	if d.IsEmpty() {
+		return ""
+	}
+	added := append([]string{}, d.Added...)
+	sort.Strings(added)
+	removed := append([]string{}, d.Removed...)
+	sort.Strings(removed)
+
+	var parts []string
+	for _, a := range added {
+		parts = append(parts, "+"+a)
+	}
+	for _, r := range removed {
+		parts = append(parts, "-"+r)
+	}
+	return strings.Join(parts, "  ")
+}
+
+// DiffDeps returns the deps added in newDeps and the deps of oldDeps removed in newDeps
+// added and removed deps keep the order of newDeps and oldDeps
+func DiffDeps(oldDeps, newDeps []string) *DepChanges {
+	var dc DepChanges
+
+	// mark all old deps as removed deps
+	// mark them as unremoved later if seen them in the new deps
+	removedDeps := make(map[string]struct{}, len(oldDeps))
+	for _, d := range oldDeps {
+		removedDeps[d] = struct{}{}
+	}
+
+	for _, d := range newDeps {
+		if _, ok := removedDeps[d]; ok {
+			// remove from deleted if seen
+			delete(removedDeps, d)
+		} else {
+			// add as new dep if not seen
+			dc.Added = append(dc.Added, d)
+		}
+	}
+
+	for _, d := range oldDeps {
+		if _, ok := removedDeps[d]; ok {
+			dc.Removed = append(dc.Removed, d)
+			delete(removedDeps, d)
+		}
+	}
+	return &dc
 }
 
 // EnvChanges changes in env vars keys
 type EnvChanges struct {
 	Vars    map[string]string
+	Added   []string // keys not present in stored env
+	Changed []string // keys whose value differs from stored env
 	Removed []string
 }
 
 // ProgInfo program info
 type ProgInfo struct {
-	ID          string   `json:"id"`
-	Space       int64    `json:"space"`
-	Runtime     string   `json:"runtime"` // runtime version eg: nodejs12.x
-	RuntimeName string   `json:"-"`
-	Name        string   `json:"name"`
-	Path        string   `json:"path"`
-	Project     string   `json:"project"`
-	Account     string   `json:"account"`
-	Region      string   `json:"region"`
-	Deps        []string `json:"deps"`
-	Envs        []string `json:"envs"`
-	Public      bool     `json:"public"`
-	Visor       string   `json:"log_level"`
-	Cron        string   `json:"cron"`
-}
-
-// unmarshals data into a ProgInfo
+	ID            string            `json:"id"`
+	Space         int64             `json:"space"`
+	Runtime       string            `json:"runtime"` // runtime version eg: nodejs12.x
+	RuntimeName   string            `json:"-"`
+	Name          string            `json:"name"`
+	Path          string            `json:"path"`
+	Project       string            `json:"project"`
+	Account       string            `json:"account"`
+	Region        string            `json:"region"`
+	Deps          []string          `json:"deps"`
+	ResolvedDeps  []string          `json:"resolved_deps,omitempty"` // deps resolved by the lockfile including transitive deps
+	Envs          []string          `json:"envs"`
+	Env           map[string]string `json:"env,omitempty"`            // env keys to checksums of values
+	PythonVersion string            `json:"python_version,omitempty"` // detected python version eg: 3.9.7
+	NodeVersion   string            `json:"node_version,omitempty"`   // detected node version eg: 18.12.1
+	Public        bool              `json:"public"`
+	Visor         string            `json:"log_level"`
+	Cron          string            `json:"cron"`
+	// version of the fields of the stored program info, set by StoreProgInfo
+	SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+// schema version of program info written by this version
+const progInfoSchemaVersion = 1
+
+// HashEnvValue returns the checksum of an env value stored in ProgInfo.Env
+// values are stored as checksums so they can be compared without storing secrets
+func HashEnvValue(value string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(value)))
+}
+
+// unmarshals data into a ProgInfo upgrading program info of older schema versions
+// program info of newer schema versions is returned as is
 func progInfoFromBytes(data []byte) (*ProgInfo, error) {
 	var p ProgInfo
 	err := json.Unmarshal(data, &p)
 	if err != nil {
 		return nil, err
 	}
+	migrateProgInfo(&p)
 	return &p, nil
 }
 
+// upgrades program info of older schema versions
+func migrateProgInfo(p *ProgInfo) {
+	// program info before schema versions (version 0) has the same fields as version 1
+	if p.SchemaVersion < progInfoSchemaVersion {
+		p.SchemaVersion = progInfoSchemaVersion
+	}
+}
+
 // UserInfo user info
 type UserInfo struct {
 	DefaultSpace     int64  `json:"default_space"`
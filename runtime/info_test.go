@@ -0,0 +1,77 @@
+package runtime
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDepChangesString(t *testing.T) {
+	testCases := []struct {
+		dc       *DepChanges
+		isEmpty  bool
+		rendered string
+	}{
+		{nil, true, ""},
+		{&DepChanges{}, true, ""},
+		{&DepChanges{Added: []string{"requests@2.28.0"}}, false, "+requests@2.28.0"},
+		{
+			&DepChanges{
+				Added:   []string{"requests@2.28.0", "boto3@1.0.0"},
+				Removed: []string{"flask@1.1.4", "django@3.0"},
+			},
+			false,
+			"+boto3@1.0.0  +requests@2.28.0  -django@3.0  -flask@1.1.4",
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.dc.IsEmpty(), tc.isEmpty)
+		assert.Equal(t, tc.dc.String(), tc.rendered)
+	}
+}
+
+func TestDiffDeps(t *testing.T) {
+	dc := DiffDeps([]string{"flask==1.1.4", "requests==2.28.0"}, []string{"requests==2.28.0", "flask==2.0.1"})
+	assert.DeepEqual(t, dc.Added, []string{"flask==2.0.1"})
+	assert.DeepEqual(t, dc.Removed, []string{"flask==1.1.4"})
+
+	dc = DiffDeps(nil, []string{"requests==2.28.0", "flask==2.0.1"})
+	assert.DeepEqual(t, dc.Added, []string{"requests==2.28.0", "flask==2.0.1"})
+	assert.Assert(t, dc.Removed == nil)
+
+	dc = DiffDeps([]string{"requests==2.28.0", "flask==2.0.1"}, nil)
+	assert.Assert(t, dc.Added == nil)
+	assert.DeepEqual(t, dc.Removed, []string{"requests==2.28.0", "flask==2.0.1"})
+
+	assert.Assert(t, DiffDeps([]string{"requests==2.28.0"}, []string{"requests==2.28.0"}).IsEmpty())
+}
+
+func TestProgInfoSchemaVersion(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+
+	// program info before schema versions
+	assert.NilError(t, ioutil.WriteFile(m.progInfoPath, []byte(`{"id":"id","runtime":"python3.9","deps":["flask"]}`), filePermMode))
+	p, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, p.SchemaVersion, progInfoSchemaVersion)
+	assert.Equal(t, p.ID, "id")
+	assert.DeepEqual(t, p.Deps, []string{"flask"})
+	assert.Equal(t, len(m.Warnings()), 0)
+
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{ID: "id", Runtime: "python3.9"}))
+	contents, err := ioutil.ReadFile(m.progInfoPath)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(contents), `"schema_version":1`))
+
+	// program info of a newer version is warned about once
+	assert.NilError(t, ioutil.WriteFile(m.progInfoPath, []byte(`{"id":"id","runtime":"python3.9","schema_version":99,"new_field":true}`), filePermMode))
+	p, err = m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, p.SchemaVersion, 99)
+	_, err = m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, len(m.Warnings()), 1)
+	assert.Assert(t, strings.Contains(m.Warnings()[0], "schema version 99"))
+}
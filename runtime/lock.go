@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	lockFile = "lock"
+
+	// how long to wait for another process to release the lock
+	lockTimeout = 10 * time.Second
+	// how often to retry acquiring the lock
+	lockRetryInterval = 50 * time.Millisecond
+	// age after which a lock is stale even if its owner is running eg: a hung process or a reused pid
+	staleLockAge = 10 * time.Minute
+
+	// ErrLocked the lock is held by another process
+	ErrLocked = errors.New("another deta process is running in this directory, try again later")
+)
+
+// lock acquires an advisory lock on the deta dir, waiting up to lockTimeout
+// the lock file holds the pid of the owner, a lock of an owner that is not running or older than staleLockAge is broken
+// returns a func that releases the lock, which should be deferred so it's released on panic
+func (m *Manager) lock() (func(), error) {
+	lockPath := filepath.Join(m.detaPath, lockFile)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := m.fs.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePermMode)
+		if err == nil {
+			_, err = f.Write([]byte(strconv.Itoa(os.Getpid())))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				m.fs.Remove(lockPath)
+				return nil, err
+			}
+			return func() {
+				m.fs.Remove(lockPath)
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		broken, err := m.breakStaleLock(lockPath)
+		if err != nil {
+			return nil, err
+		}
+		if broken {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// removes the lock at lockPath if it's stale, returns true if the lock was removed
+func (m *Manager) breakStaleLock(lockPath string) (bool, error) {
+	info, err := m.fs.Stat(lockPath)
+	if err != nil {
+		// released meanwhile
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	contents, err := m.readFile(lockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	switch {
+	case time.Since(info.ModTime()) > staleLockAge:
+		m.debugf("breaking lock %s older than %s", lockPath, staleLockAge)
+	case err == nil && pid != os.Getpid() && !processRunning(pid):
+		m.debugf("breaking lock %s of process %d which is not running", lockPath, pid)
+	default:
+		// an empty lock is being written by its owner or is of an older version, it's broken once it's old
+		return false, nil
+	}
+	// the lock is checked again so a lock acquired meanwhile by another process is not removed
+	current, err := m.fs.Stat(lockPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if !current.ModTime().Equal(info.ModTime()) {
+		return true, nil
+	}
+	err = m.fs.Remove(lockPath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
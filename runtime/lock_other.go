@@ -0,0 +1,9 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package runtime
+
+// processes are not checked, locks are broken once they are stale by age
+func processRunning(pid int) bool {
+	return true
+}
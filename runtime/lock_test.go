@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLockConcurrentStore(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			errs <- m.StoreProgInfo(&ProgInfo{Runtime: "python3.9", Name: fmt.Sprintf("micro-%d", i)})
+		}(i)
+		go func() {
+			defer wg.Done()
+			errs <- m.StoreState()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NilError(t, err)
+	}
+
+	p, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, p.Runtime, "python3.9")
+	_, err = m.getStoredState()
+	assert.NilError(t, err)
+}
+
+func TestLockTimeout(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+
+	defer func(timeout time.Duration) {
+		lockTimeout = timeout
+	}(lockTimeout)
+	lockTimeout = 100 * time.Millisecond
+
+	unlock, err := m.lock()
+	assert.NilError(t, err)
+
+	err = m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"})
+	assert.Assert(t, errors.Is(err, ErrLocked))
+
+	unlock()
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	_, err = os.Stat(filepath.Join(m.detaPath, lockFile))
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestLockStale(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+
+	defer func(timeout time.Duration) {
+		lockTimeout = timeout
+	}(lockTimeout)
+	lockTimeout = 100 * time.Millisecond
+
+	// a lock of a running process is not broken
+	lockPath := filepath.Join(m.detaPath, lockFile)
+	assert.NilError(t, ioutil.WriteFile(lockPath, []byte(fmt.Sprint(os.Getppid())), filePermMode))
+	err := m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"})
+	assert.Assert(t, errors.Is(err, ErrLocked))
+
+	// an old lock is broken
+	old := time.Now().Add(-2 * staleLockAge)
+	assert.NilError(t, os.Chtimes(lockPath, old, old))
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	_, err = os.Stat(lockPath)
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestStoreStateAtomic(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	assert.NilError(t, m.StoreState())
+
+	unlock, err := m.lock()
+	assert.NilError(t, err)
+	contents, err := ioutil.ReadFile(filepath.Join(m.detaPath, lockFile))
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), fmt.Sprint(os.Getpid()))
+	unlock()
+
+	// no temp files are left in the deta dir
+	entries, err := ioutil.ReadDir(m.detaPath)
+	assert.NilError(t, err)
+	for _, e := range entries {
+		assert.Assert(t, !strings.HasSuffix(e.Name(), ".tmp"), e.Name())
+	}
+}
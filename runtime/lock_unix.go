@@ -0,0 +1,13 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package runtime
+
+import "syscall"
+
+// if a process with pid is running
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// the process exists but is owned by another user
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,35 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package runtime
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLockOfExitedProcess(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+
+	defer func(timeout time.Duration) {
+		lockTimeout = timeout
+	}(lockTimeout)
+	lockTimeout = 100 * time.Millisecond
+
+	// the pid of an exited process
+	cmd := exec.Command("true")
+	assert.NilError(t, cmd.Run())
+	lockPath := filepath.Join(m.detaPath, lockFile)
+	assert.NilError(t, ioutil.WriteFile(lockPath, []byte(fmt.Sprint(cmd.Process.Pid)), filePermMode))
+
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	_, err := os.Stat(lockPath)
+	assert.Assert(t, os.IsNotExist(err))
+}
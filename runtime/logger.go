@@ -0,0 +1,24 @@
+package runtime
+
+// Logger logs events of the runtime manager eg: skipped and hashed files
+type Logger interface {
+	Debugf(format string, a ...interface{})
+	Infof(format string, a ...interface{})
+}
+
+// SetLogger sets the logger of the manager, nothing is logged if not set
+func (m *Manager) SetLogger(l Logger) {
+	m.logger = l
+}
+
+func (m *Manager) debugf(format string, a ...interface{}) {
+	if m.logger != nil {
+		m.logger.Debugf(format, a...)
+	}
+}
+
+func (m *Manager) infof(format string, a ...interface{}) {
+	if m.logger != nil {
+		m.logger.Infof(format, a...)
+	}
+}
@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+type testLogger struct {
+	debug []string
+	info  []string
+}
+
+func (l *testLogger) Debugf(format string, a ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, a...))
+}
+
+func (l *testLogger) Infof(format string, a ...interface{}) {
+	l.info = append(l.info, fmt.Sprintf(format, a...))
+}
+
+func TestLogger(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":                "",
+		".env":                   "KEY=VALUE",
+		"__pycache__/main.pyc":   "",
+		".git/config":            "",
+		"lib/utils.py":           "",
+		"setup.py":               `setup(install_requires=get_deps())`,
+		"lib/__pycache__/x.pyc":  "",
+		"lib/.hidden/secret.txt": "",
+	})
+	l := &testLogger{}
+	m.SetLogger(l)
+
+	assert.NilError(t, m.StoreState())
+	assert.DeepEqual(t, l.debug, []string{
+		"skipping .deta: matches pattern " + PythonSkipPattern,
+		"pruning dir .deta",
+		"skipping .env: matches pattern " + PythonSkipPattern,
+		"skipping hidden .git",
+		"pruning dir .git",
+		"skipping __pycache__: matches pattern " + PythonSkipPattern,
+		"pruning dir __pycache__",
+		"skipping hidden lib/.hidden",
+		"pruning dir lib/.hidden",
+		"skipping lib/__pycache__: matches pattern " + PythonSkipPattern,
+		"pruning dir lib/__pycache__",
+		"hashing " + filepath.Join(m.rootDir, "lib", "utils.py"),
+		"hashing " + filepath.Join(m.rootDir, "main.py"),
+		"hashing " + filepath.Join(m.rootDir, "setup.py"),
+	})
+
+	_, err := m.readDeps(Python)
+	assert.NilError(t, err)
+	assert.Equal(t, len(l.info), 1)
+}
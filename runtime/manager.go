@@ -1,18 +1,26 @@
 package runtime
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
+	goruntime "runtime"
+	"sort"
 
 	"io"
 	"io/ioutil"
 	"os"
+	pathpkg "path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -23,12 +31,40 @@ const (
 
 	NodeSkipPattern = `(node_modules)|(.*~$)|(.*\.deta)`
 
+	JavaSkipPattern = `(^target$)|(.*\.class$)|(.*~$)|(.*\.deta)`
+
+	RubySkipPattern = `(^vendor/bundle$)|(.*~$)|(.*\.deta)`
+
+	PHPSkipPattern = `(^vendor$)|(.*~$)|(.*\.deta)`
+
+	ElixirSkipPattern = `(^_build$)|(^deps$)|(.*~$)|(.*\.deta)`
+
+	DotNetSkipPattern = `(^bin$)|(^obj$)|(.*~$)|(.*\.deta)`
+
+	RustSkipPattern = `(^target$)|(.*~$)|(.*\.deta)`
+
+	ScalaSkipPattern = `(^target$)|(^project/target$)|(.*~$)|(.*\.deta)`
+
+	CustomSkipPattern = `(.*~$)|(.*\.deta)`
+
 	Python = "python"
 	Node   = "node"
+	Java   = "java"
+	Ruby   = "ruby"
+	PHP    = "php"
+	Elixir = "elixir"
+	DotNet = "dotnet"
+	Rust   = "rust"
+	Scala  = "scala"
+	// Custom a runtime built from a Dockerfile in the root dir
+	Custom = "custom"
 
 	// DefaultProject default project slug
 	DefaultProject = "default"
 
+	// default age above which the stored state is stale
+	defaultStaleStateAge = 30 * 24 * time.Hour
+
 	// drwxrw----
 	dirPermMode = 0760
 	// -rw-rw---
@@ -45,18 +81,53 @@ var (
 	runtimes = map[string][]string{
 		Python: {"python3.9", "python3.8", "python3.7"},
 		Node:   {"nodejs14.x", "nodejs12.x"},
-	}
-
-	// maps entrypoint files to runtimes
-	entryPoints = map[string]string{
-		"main.py":  Python,
-		"index.js": Node,
-	}
+		Java:   {"java11"},
+		Ruby:   {"ruby2.7"},
+		PHP:    {"php8.0"},
+		Elixir: {"elixir1.14"},
+		DotNet: {"dotnet6"},
+		Rust:   {"rust1.70"},
+		Scala:  {"scala2.13"},
+		Custom: {"custom"},
+	}
+
+	// maps runtimes to entrypoint files in order of preference, the first is written by InitProject
+	entryPoints = map[string][]string{
+		Python: {"main.py", "__main__.py"},
+		Node:   {"index.js", "index.mjs"},
+		Java:   {"Main.java"},
+		Ruby:   {"main.rb"},
+		PHP:    {"index.php"},
+		Elixir: {"mix.exs"},
+		// only with a .csproj file in the root dir
+		DotNet: {"Program.cs"},
+		// only with a src/main.rs file
+		Rust: {"Cargo.toml"},
+		// only with a src/main/scala dir
+		Scala: {"build.sbt"},
+	}
+
+	// minimal entrypoint files written by InitProject
+	entryPointTemplates = map[string]string{
+		Python: "def app(event):\n    return \"Hello, world!\"\n",
+		Node:   "module.exports = (event) => \"Hello, world!\";\n",
+	}
+
+	// names of dirs of build outputs which are not walked into by default
+	defaultOutputDirs = []string{"dist", "build", "target", "__pycache__"}
 
 	// maps runtimes to dep files
 	depFiles = map[string]string{
 		Python: "requirements.txt",
 		Node:   "package.json",
+		Java:   "pom.xml",
+		Ruby:   "Gemfile",
+		PHP:    "composer.json",
+		Elixir: "mix.exs",
+		// the name of the project file is matched
+		DotNet: csprojPattern,
+		Rust:   cargoFile,
+		Scala:  sbtFile,
 	}
 
 	// maps lib entry files to runtimes
@@ -79,6 +150,65 @@ var (
 				Skip:  true,
 			},
 		},
+		Java: {
+			Pattern{
+				Value: regexp.MustCompilePOSIX(JavaSkipPattern),
+				Skip:  true,
+			},
+		},
+		Ruby: {
+			Pattern{
+				Value: regexp.MustCompilePOSIX(RubySkipPattern),
+				Skip:  true,
+			},
+		},
+		PHP: {
+			Pattern{
+				Value: regexp.MustCompilePOSIX(PHPSkipPattern),
+				Skip:  true,
+			},
+		},
+		Elixir: {
+			Pattern{
+				Value: regexp.MustCompilePOSIX(ElixirSkipPattern),
+				Skip:  true,
+			},
+		},
+		DotNet: {
+			Pattern{
+				Value: regexp.MustCompilePOSIX(DotNetSkipPattern),
+				Skip:  true,
+			},
+		},
+		Rust: {
+			Pattern{
+				Value: regexp.MustCompilePOSIX(RustSkipPattern),
+				Skip:  true,
+			},
+		},
+		Scala: {
+			Pattern{
+				Value: regexp.MustCompilePOSIX(ScalaSkipPattern),
+				Skip:  true,
+			},
+		},
+		Custom: {
+			Pattern{
+				Value: regexp.MustCompilePOSIX(CustomSkipPattern),
+				Skip:  true,
+			},
+		},
+	}
+
+	// entrypoint of the custom runtime, detected if no entrypoint of another runtime is present
+	dockerfile = "Dockerfile"
+
+	// maps manifest files of runtimes that are not supported to the names of the runtimes
+	unsupportedManifests = map[string]string{
+		"go.mod":        "Go",
+		"Package.swift": "Swift",
+		"pubspec.yaml":  "Dart",
+		"stack.yaml":    "Haskell",
 	}
 
 	// local paths to store information
@@ -86,29 +216,164 @@ var (
 	userInfoFile = "user_info"
 	progInfoFile = "prog_info"
 	stateFile    = "state"
+	stateSumFile = "state.sum"
+	modesFile    = "modes"
+	dirsFile     = "dirs"
+	digestsFile  = "digests"
+	secretsFile  = "secrets"
 	ignoreFile   = ".detaignore"
+	// default env file in the root dir
+	defaultEnvFile = ".env"
 
 	// DepCommands maps runtimes to the dependency managers
 	DepCommands = map[string]string{
 		Python: "pip",
 		Node:   "npm",
+		Java:   "mvn",
+		Ruby:   "gem",
+		PHP:    "composer",
+		Elixir: "mix",
+		DotNet: "dotnet",
+		Rust:   "cargo",
+		Scala:  "sbt",
 	}
 
 	// ErrNoEntrypoint noe entrypoint file present
 	ErrNoEntrypoint = errors.New("no entrypoint file present")
 	// ErrEntrypointConflict conflicting entrypoint files
 	ErrEntrypointConflict = errors.New("conflicting entrypoint files present")
+	// ErrUnpinnedDeps python deps without an exact version pin
+	ErrUnpinnedDeps = errors.New("dependencies without an exact version pin (==)")
+	// ErrRuntimeMismatch entrypoint file does not match the stored runtime
+	ErrRuntimeMismatch = errors.New("entrypoint file does not match the runtime of the micro")
+	// ErrAlreadyInitialized program info is already stored
+	ErrAlreadyInitialized = errors.New("program is already initialized")
+	// ErrMaxDepthExceeded a dir is deeper than the max walk depth
+	ErrMaxDepthExceeded = errors.New("max directory depth exceeded")
+	// ErrInvalidDepFile dependency file can not be parsed
+	ErrInvalidDepFile = errors.New("invalid dependency file")
+	// ErrDetaPathNotDir the path for storing program info and state is not a dir
+	ErrDetaPathNotDir = errors.New("deta dir is not a directory")
+	// ErrDepFileMismatch only dependency files of other runtimes are present
+	ErrDepFileMismatch = errors.New("dependency file does not match the runtime")
+	// ErrCorruptState the stored state does not match its checksum
+	ErrCorruptState = errors.New("stored state is corrupt")
+	// ErrNotTracked a path is not of a file tracked in the root dir
+	ErrNotTracked = errors.New("file is not tracked")
+	// ErrNoFiles no files present after skipping hidden and ignored files
+	ErrNoFiles = errors.New("no files present, all files are hidden or ignored")
+	// ErrNoDepFile the runtime has no dependency file eg: the custom runtime
+	ErrNoDepFile = errors.New("runtime has no dependency file")
+	// ErrCircularRequirements requirements files include each other in a cycle
+	ErrCircularRequirements = errors.New("circular requirements includes")
 )
 
+// UnsupportedRuntimeError no entrypoint file present but a manifest file of a runtime that is not supported is
+// it satisfies errors.Is(err, ErrNoEntrypoint)
+type UnsupportedRuntimeError struct {
+	Manifest string // eg: Cargo.toml
+	Runtime  string // eg: Rust
+}
+
+func (e *UnsupportedRuntimeError) Error() string {
+	return fmt.Sprintf("found %s but the %s runtime is not supported", e.Manifest, e.Runtime)
+}
+
+// Is reports if target is ErrNoEntrypoint
+func (e *UnsupportedRuntimeError) Is(target error) bool {
+	return target == ErrNoEntrypoint
+}
+
+// CorruptStateError the stored state does not match the checksum stored with it eg: after a manual edit
+// it satisfies errors.Is(err, ErrCorruptState) and errors.Is(err, os.ErrNotExist), so the state is read again like a missing state
+type CorruptStateError struct {
+	Path string
+}
+
+func (e *CorruptStateError) Error() string {
+	return fmt.Sprintf("%s: %s does not match its checksum", ErrCorruptState, e.Path)
+}
+
+// Is reports if target is ErrCorruptState or os.ErrNotExist
+func (e *CorruptStateError) Is(target error) bool {
+	return target == ErrCorruptState || target == os.ErrNotExist
+}
+
+// CircularRequirementsError requirements files include each other in a cycle eg: a.txt includes b.txt which includes a.txt
+// it satisfies errors.Is(err, ErrCircularRequirements)
+type CircularRequirementsError struct {
+	Files []string // slash separated paths of the files in the cycle relative to the root dir, starting and ending with the same file
+}
+
+func (e *CircularRequirementsError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCircularRequirements, strings.Join(e.Files, " -> "))
+}
+
+// Is reports if target is ErrCircularRequirements
+func (e *CircularRequirementsError) Is(target error) bool {
+	return target == ErrCircularRequirements
+}
+
 // Manager runtime manager handles files management and other services
+// a Manager is safe for concurrent use once configured, setters should not be called concurrently with other methods
 type Manager struct {
-	rootDir      string               // working directory for the program
-	detaPath     string               // dir for storing program info and state
-	userInfoPath string               // path to info file about the user
-	progInfoPath string               // path to info file about the program
-	statePath    string               // path to state file about the program
-	ignorePath   string               // path to .detaignore file
-	skipPaths    map[string][]Pattern // files that will be skipped
+	rootDir         string               // working directory for the program
+	detaPath        string               // dir for storing program info and state
+	userInfoPath    string               // path to info file about the user
+	progInfoPath    string               // path to info file about the program
+	statePath       string               // path to state file about the program
+	modesPath       string               // path to modes file about the program
+	ignorePath      string               // path to .detaignore file
+	skipPaths       map[string][]Pattern // files that will be skipped by default
+	ignorePatterns  []Pattern            // patterns of the .detaignore file, later lines first
+	dockerPatterns  []dockerPattern      // patterns of the .dockerignore file applied for the custom runtime
+	includeHidden   []string             // hidden files that will not be skipped
+	warnings        []string             // warnings collected while reading the program
+	pinCheck        PinCheck             // how unpinned python deps are handled
+	detectedRuntime *Runtime             // runtime detected from entrypoint file
+	logger          Logger               // logs events, nothing is logged if nil
+	depChecker      DepChecker           // checks deps before deploy, deps are not checked if nil
+	transform       ContentTransform     // rewrites contents of files before they are hashed or read, if not nil
+	config          Config               // settings from .deta/config.json
+	salt            string               // mixed into project checksums and deps fingerprints
+	maxDepth        int                  // max depth of dirs walked into, 0 for unlimited
+	strictDepth     bool                 // walks fail with ErrMaxDepthExceeded instead of skipping dirs deeper than maxDepth
+	readWorkers     int                  // max files read concurrently by readAll, set by SetConcurrency
+	readBudget      int64                // max bytes of files read concurrently by readAll
+	retries         int                  // retries of file reads failing with transient errors
+	retryBackoff    time.Duration        // wait before the first retry of a file read
+	fs              FileSystem           // files are read from and the state is written to
+	filesMu         sync.RWMutex         // guards reads and writes of the program info, state and modes files
+	mu              sync.Mutex           // guards detectedRuntime and warnings
+	checksums       map[string]fileSum   // checksums of files by path for the lifetime of the manager
+	checksumsMu     sync.Mutex           // guards checksums
+	schemaWarning   sync.Once            // warns once about program info of a newer schema version
+	preferPipfile   bool                 // read python deps from Pipfile even if requirements.txt is present
+	includeDevDeps  bool                 // read dev deps eg: devDependencies, require-dev
+	caseInsensitive bool                 // compare paths of the state case insensitively
+	trackModes      bool                 // store file modes with the state and report mode changes
+	trackEmptyDirs  bool                 // store empty dirs with the state and report created and deleted empty dirs
+	dirShortcut     bool                 // store modification times of dirs with the state and skip unchanged dirs
+	dirDigests      bool                 // store digests of dirs with the state and skip hashing unchanged subtrees
+	classifyBinary  bool                 // report if changed files look binary in BinaryPaths
+	normalizeEOL    bool                 // normalize line endings of text files before hashing
+	trimTrailing    bool                 // trim trailing whitespace of lines of text files before hashing
+	canonicalJSON   bool                 // canonicalize json dependency files before hashing
+	alwaysUploadExt []string             // extensions of files that are always uploaded without diffing
+	alwaysUploadMin int64                // size in bytes above which files are always uploaded without diffing, 0 to disable
+	maxFileSize     int64                // size in bytes above which changed files are reported as oversized, 0 for unlimited
+	outputDirs      []string             // names of dirs of build outputs which are not walked into
+	trackedDirs     map[string]bool      // dirs of stored files by slash separated path, nil until the state is read or stored
+	trackedDirsMu   sync.Mutex           // guards trackedDirs
+	dedupLinks      bool                 // read hard links to the same file once
+	followLinks     bool                 // walk the targets of symlinks to dirs
+	events          *eventStream         // writes events of walks, no events are written if nil
+	dedupContents   bool                 // report changed files with identical contents in Duplicates
+	watchInterval   time.Duration        // interval the dependency files are polled at by WatchDeps
+	staleAge        time.Duration        // age above which the stored state is stale, 0 to never consider it stale
+	progressFn      ProgressFunc         // called as files are processed, progress is not reported if nil
+	filters         []Filter             // decide which files and dirs are walked, the default filters if nil
+	defaultFilters  []Filter             // built-in filters bound to the manager
 }
 
 // Runtime holds name and version of current runtime used
@@ -117,9 +382,41 @@ type Runtime struct {
 	Version string
 }
 
+// Option configures optional settings of a Manager
+type Option func(*Manager)
+
+// WithDetaPath stores program info and state in detaPath instead of the .deta dir under the root dir
+// files are still tracked under the root dir
+func WithDetaPath(detaPath string) Option {
+	return func(m *Manager) {
+		m.detaPath = detaPath
+	}
+}
+
+// WithCaseInsensitive sets if paths are compared case insensitively when checking changes
+// so a rename that only changes the case of a path is not a change
+// defaults to true on all platforms except linux
+func WithCaseInsensitive(caseInsensitive bool) Option {
+	return func(m *Manager) {
+		m.caseInsensitive = caseInsensitive
+	}
+}
+
+// ExternalDetaPath returns a dir under base unique to rootDir to use with WithDetaPath
+// eg: $XDG_STATE_HOME/deta/<hash of root dir>
+func ExternalDetaPath(base, rootDir string) (string, error) {
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", err
+	}
+	hashSum := fmt.Sprintf("%x", sha256.Sum256([]byte(absRoot)))
+	return filepath.Join(base, "deta", hashSum[:16]), nil
+}
+
 // NewManager returns a new runtime manager for the root dir of the program
+// the root dir is made absolute and cleaned
 // if initDirs is true, it creates dirs under root
-func NewManager(root *string, initDirs bool) (*Manager, error) {
+func NewManager(root *string, initDirs bool, opts ...Option) (*Manager, error) {
 	var rootDir string
 	if root != nil {
 		rootDir = *root
@@ -130,14 +427,10 @@ func NewManager(root *string, initDirs bool) (*Manager, error) {
 		}
 		rootDir = wd
 	}
-
-	detaPath := filepath.Join(rootDir, detaDir)
-
-	if initDirs {
-		err := os.MkdirAll(detaPath, dirPermMode)
-		if err != nil {
-			return nil, err
-		}
+	// the same dir referenced in different forms eg: ./prog/, prog has the same root dir
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
 	}
 
 	// user info is stored in ~/.deta/userInfo as it's global
@@ -145,36 +438,92 @@ func NewManager(root *string, initDirs bool) (*Manager, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = os.MkdirAll(filepath.Join(home, detaDir), dirPermMode)
-	if err != nil {
-		return nil, err
-	}
 	userInfoPath := filepath.Join(home, detaDir, userInfoFile)
 
 	ignorePath := filepath.Join(rootDir, ignoreFile)
 
+	// copy skip paths so patterns from .detaignore do not leak between managers
+	managerSkipPaths := make(map[string][]Pattern, len(skipPaths))
+	for k, v := range skipPaths {
+		managerSkipPaths[k] = append([]Pattern{}, v...)
+	}
+
 	manager := &Manager{
-		rootDir:      rootDir,
-		detaPath:     detaPath,
-		userInfoPath: userInfoPath,
-		progInfoPath: filepath.Join(detaPath, progInfoFile),
-		statePath:    filepath.Join(detaPath, stateFile),
-		skipPaths:    skipPaths,
-		ignorePath:   ignorePath,
+		rootDir:         rootDir,
+		detaPath:        filepath.Join(rootDir, detaDir),
+		userInfoPath:    userInfoPath,
+		skipPaths:       managerSkipPaths,
+		ignorePath:      ignorePath,
+		caseInsensitive: goruntime.GOOS != "linux",
+		readWorkers:     goruntime.NumCPU(),
+		readBudget:      defaultReadBudget,
+		retries:         defaultRetries,
+		retryBackoff:    defaultRetryBackoff,
+		fs:              osFS{},
+		outputDirs:      defaultOutputDirs,
+		watchInterval:   defaultWatchInterval,
+		staleAge:        defaultStaleStateAge,
+	}
+	manager.defaultFilters = manager.DefaultFilters()
+	for _, opt := range opts {
+		opt(manager)
+	}
+	manager.progInfoPath = filepath.Join(manager.detaPath, progInfoFile)
+	manager.statePath = filepath.Join(manager.detaPath, stateFile)
+	manager.modesPath = filepath.Join(manager.detaPath, modesFile)
+
+	err = manager.fs.MkdirAll(filepath.Dir(userInfoPath), dirPermMode)
+	if err != nil {
+		return nil, err
+	}
+
+	// a file named .deta in the root dir makes MkdirAll fail with a cryptic error
+	info, err := manager.fs.Stat(manager.detaPath)
+	if err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("%w: '%s' is a file, rename or remove it, or store the state in another dir with WithDetaPath", ErrDetaPathNotDir, manager.detaPath)
+	}
+
+	if initDirs {
+		err := manager.fs.MkdirAll(manager.detaPath, dirPermMode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = manager.loadConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	// not handling error as we don't want cli to crash if .detaignore is not found
 	manager.handleIgnoreFile()
+	// .dockerignore is only present for the custom runtime
+	manager.readDockerignore()
 
 	return manager, nil
 }
 
-func (m *Manager) handleIgnoreFile() error {
-	runtime, err := m.GetRuntime()
-	if err != nil {
-		return err
-	}
+// RootDir returns the root dir of the program
+func (m *Manager) RootDir() string {
+	return m.rootDir
+}
+
+// DetaPath returns the dir where program info and state are stored
+func (m *Manager) DetaPath() string {
+	return m.detaPath
+}
+
+// ProgInfoPath returns the path of the program info file
+func (m *Manager) ProgInfoPath() string {
+	return m.progInfoPath
+}
+
+// StatePath returns the path of the state file
+func (m *Manager) StatePath() string {
+	return m.statePath
+}
 
+func (m *Manager) handleIgnoreFile() error {
 	contents, err := m.readFile(m.ignorePath)
 	if err != nil {
 		return err
@@ -216,7 +565,8 @@ func (m *Manager) handleIgnoreFile() error {
 				}
 			}
 
-			m.skipPaths[runtime.Name] = append([]Pattern{pattern}, m.skipPaths[runtime.Name]...)
+			// later lines take precedence
+			m.ignorePatterns = append([]Pattern{pattern}, m.ignorePatterns...)
 		}
 	}
 
@@ -224,17 +574,30 @@ func (m *Manager) handleIgnoreFile() error {
 }
 
 // StoreProgInfo stores program info to disk
+// the schema version of p is set to the current schema version
 func (m *Manager) StoreProgInfo(p *ProgInfo) error {
+	p.SchemaVersion = progInfoSchemaVersion
 	marshalled, err := json.Marshal(p)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(m.progInfoPath, marshalled, filePermMode)
+
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m.filesMu.Lock()
+	defer m.filesMu.Unlock()
+	return m.writeFileAtomic(m.progInfoPath, marshalled, filePermMode)
 }
 
 // GetProgInfo gets the program info stored
 func (m *Manager) GetProgInfo() (*ProgInfo, error) {
+	m.filesMu.RLock()
 	contents, err := m.readFile(m.progInfoPath)
+	m.filesMu.RUnlock()
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, nil
@@ -246,6 +609,17 @@ func (m *Manager) GetProgInfo() (*ProgInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	if progInfo.SchemaVersion > progInfoSchemaVersion {
+		m.schemaWarning.Do(func() {
+			m.warn("%s was written by a newer version of the cli (schema version %d), fields not known to this version are lost when it is stored, update the cli",
+				m.progInfoPath, progInfo.SchemaVersion)
+		})
+	}
+
+	// runtime is detected later by GetRuntime if not stored
+	if progInfo.Runtime == "" {
+		return progInfo, nil
+	}
 
 	runtime, err := CheckRuntime(progInfo.Runtime)
 	if err != nil {
@@ -264,7 +638,7 @@ func (m *Manager) StoreUserInfo(u *UserInfo) error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(m.userInfoPath, marshalled, filePermMode)
+	return m.fs.WriteFile(m.userInfoPath, marshalled, filePermMode)
 }
 
 // GetUserInfo gets the user info
@@ -281,7 +655,7 @@ func (m *Manager) GetUserInfo() (*UserInfo, error) {
 
 // IsInitialized checks if the root directory is initialized as a deta program
 func (m *Manager) IsInitialized() (bool, error) {
-	_, err := os.Stat(m.progInfoPath)
+	_, err := m.fs.Stat(m.progInfoPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -291,24 +665,69 @@ func (m *Manager) IsInitialized() (bool, error) {
 	return true, nil
 }
 
+// InitProject scaffolds a program in the root dir for runtime
+// runtime can be a runtime name eg: python or a runtime version eg: python3.9
+// it writes a minimal entrypoint file and an empty dependency file if absent and stores program info with the runtime
+// it does not overwrite an existing entrypoint file or program info
+func (m *Manager) InitProject(runtime string) error {
+	r, err := CheckRuntime(runtime)
+	if err != nil {
+		if _, ok := runtimes[runtime]; !ok {
+			return err
+		}
+		r = &Runtime{Name: runtime, Version: GetDefaultRuntimeVersion(runtime)}
+	}
+
+	// the image of the custom runtime is up to the Dockerfile
+	if r.Name == Custom {
+		return fmt.Errorf("a program of the %s runtime can not be initialized, add a %s", Custom, dockerfile)
+	}
+
+	initialized, err := m.IsInitialized()
+	if err != nil {
+		return err
+	}
+	if initialized {
+		return ErrAlreadyInitialized
+	}
+
+	err = m.createFile(filepath.Join(m.rootDir, entryPoints[r.Name][0]), []byte(entryPointTemplates[r.Name]))
+	if err != nil {
+		return err
+	}
+
+	depFile, depContents := depFiles[r.Name], []byte(nil)
+	if r.Name == DotNet {
+		depFile, depContents = filepath.Base(m.rootDir)+".csproj", []byte(csprojTemplate)
+	}
+	err = m.createFile(filepath.Join(m.rootDir, depFile), depContents)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	err = m.fs.MkdirAll(m.detaPath, dirPermMode)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.detectedRuntime = r
+	m.mu.Unlock()
+	return m.StoreProgInfo(&ProgInfo{
+		Runtime:     r.Version,
+		RuntimeName: r.Name,
+	})
+}
+
 // IsProgDirEmpty checks if dir contains any files/folders which are not hidden
 // if dir is nil, it sets the root dir
 func (m *Manager) IsProgDirEmpty() (bool, error) {
 	checkDir := m.rootDir
-	f, err := os.Open(checkDir)
-	if err != nil {
-		return false, err
-	}
-	defer f.Close()
-	names, err := f.Readdirnames(-1)
+	files, err := m.fs.ReadDir(checkDir)
 	if err != nil {
-		if err == io.EOF {
-			return true, nil
-		}
 		return false, err
 	}
-	for _, n := range names {
-		isHidden, err := m.isHidden(filepath.Join(checkDir, n))
+	for _, f := range files {
+		isHidden, err := m.isHidden(filepath.Join(checkDir, f.Name()))
 		if err != nil {
 			return false, err
 		}
@@ -334,364 +753,2089 @@ func GetDefaultRuntimeVersion(name string) string {
 	return runtimes[name][0] // index 0 is the default runtime
 }
 
+// RuntimeInfo capabilities of a supported runtime
+type RuntimeInfo struct {
+	Name string // eg: python
+	// names of entrypoint files in the root dir in order of preference eg: main.py, __main__.py
+	Entrypoints []string
+	// name of the dependency file in the root dir eg: requirements.txt, a pattern for dotnet: *.csproj, empty for custom
+	DepFile string
+}
+
+// SupportedRuntimes returns the supported runtimes sorted by name eg: for help text
+func SupportedRuntimes() []RuntimeInfo {
+	names := make([]string, 0, len(runtimes))
+	for name := range runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	infos := make([]RuntimeInfo, 0, len(names))
+	for _, name := range names {
+		entrypoints := append([]string{}, entryPoints[name]...)
+		if name == Custom {
+			entrypoints = []string{dockerfile}
+		}
+		infos = append(infos, RuntimeInfo{Name: name, Entrypoints: entrypoints, DepFile: depFiles[name]})
+	}
+	return infos
+}
+
 // GetRuntime gets runtime from proginfo or figures out the runtime of the program from entrypoint file if present in the root dir
+// a detected runtime is cached and stored in proginfo if the program is initialized without a runtime
+// so later calls, also of other processes, do not read the root dir
 func (m *Manager) GetRuntime() (*Runtime, error) {
 	progInfo, _ := m.GetProgInfo()
-	if progInfo != nil {
+	if progInfo != nil && progInfo.Runtime != "" {
 		return &Runtime{
 			Name:    progInfo.RuntimeName,
 			Version: progInfo.Runtime,
 		}, nil
 	}
-
-	var runtime *Runtime
-	var found bool
-	err := filepath.Walk(m.rootDir, func(path string, info os.FileInfo, err error) error {
-		if path == m.rootDir {
-			return nil
-		}
-		if info.IsDir() {
-			return filepath.SkipDir
-		}
-		_, filename := filepath.Split(path)
-		if r, ok := entryPoints[filename]; ok {
-			if !found {
-				found = true
-				runtime = &Runtime{
-					Name:    r,
-					Version: GetDefaultRuntimeVersion(r),
-				}
-			} else {
-				return errors.New("conflicting entrypoint files found")
-			}
+	m.mu.Lock()
+	detected := m.detectedRuntime
+	m.mu.Unlock()
+	if detected == nil {
+		runtime, err := m.detectRuntime()
+		if err != nil {
+			return nil, err
 		}
-		return nil
-	})
+		m.mu.Lock()
+		m.detectedRuntime = runtime
+		m.mu.Unlock()
+		detected = runtime
+	}
+	err := m.storeDetectedRuntime(progInfo, detected)
 	if err != nil {
 		return nil, err
 	}
-	if !found {
-		return nil, ErrNoEntrypoint
-	}
-	return runtime, nil
-}
-
-// if a file or dir is hidden
-func (m *Manager) isHidden(path string) (bool, error) {
-	_, filename := filepath.Split(path)
-	return strings.HasPrefix(filename, ".") && filename != ".", nil
+	return detected, nil
 }
 
-// should skip if the file or dir should be skipped
-func (m *Manager) shouldSkip(path string, runtime string) (bool, error) {
-	// do not skip .detaignore file
-	if regexp.MustCompile(ignoreFile).MatchString(path) {
-		return false, nil
+// SetRuntime stores runtime in the program info eg: for a program without an entrypoint file
+// runtime is a runtime version eg: python3.9 or the name of a runtime for its default version eg: python
+// GetRuntime returns the stored runtime without detecting it, until it is detected again with ForceDetectRuntime or Reinit
+func (m *Manager) SetRuntime(runtime string) error {
+	r, err := CheckRuntime(runtime)
+	if err != nil {
+		if _, ok := runtimes[runtime]; !ok {
+			return fmt.Errorf("unsupported runtime '%s'", runtime)
+		}
+		r = &Runtime{Name: runtime, Version: GetDefaultRuntimeVersion(runtime)}
 	}
 
-	for _, re := range m.skipPaths[runtime] {
-		if re.Value.MatchString(filepath.ToSlash(path)) {
-			return re.Skip, nil
-		}
+	progInfo, err := m.GetProgInfo()
+	if err != nil {
+		return err
 	}
+	if progInfo == nil {
+		progInfo = &ProgInfo{}
+	}
+	progInfo.Runtime = r.Version
+	progInfo.RuntimeName = r.Name
+	err = m.StoreProgInfo(progInfo)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.detectedRuntime = nil
+	m.mu.Unlock()
+	return nil
+}
 
-	hidden, err := m.isHidden(path)
+// ForceDetectRuntime detects the runtime from the entrypoint file in the root dir ignoring the stored and cached runtime
+// the detected runtime is cached and stored in proginfo if the program is initialized and the runtime changed
+func (m *Manager) ForceDetectRuntime() (*Runtime, error) {
+	runtime, err := m.detectRuntime()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	m.mu.Lock()
+	m.detectedRuntime = runtime
+	m.mu.Unlock()
 
-	return hidden, nil
+	progInfo, _ := m.GetProgInfo()
+	err = m.storeDetectedRuntime(progInfo, runtime)
+	if err != nil {
+		return nil, err
+	}
+	return runtime, nil
 }
 
-// reads the contents of a file, returns contents
-func (m *Manager) readFile(path string) ([]byte, error) {
-	f, err := os.Open(path)
+// Reinit detects the runtime again and rewrites the runtime and deps of the stored program info eg: after switching languages
+// other fields eg: name, id and endpoint are kept, the stored runtime version is kept if the runtime did not change
+// returns an error wrapping ErrNoEntrypoint if no runtime is detected
+func (m *Manager) Reinit() (*ProgInfo, error) {
+	progInfo, err := m.GetProgInfo()
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	return ioutil.ReadAll(f)
-}
+	if progInfo == nil {
+		return nil, fmt.Errorf("no program information found")
+	}
+	runtime, err := m.detectRuntime()
+	if err != nil {
+		return nil, fmt.Errorf("detecting runtime: %w", err)
+	}
+	deps, err := m.readDeps(runtime.Name)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.detectedRuntime = runtime
+	m.mu.Unlock()
 
-// reads the contents of a file, returns contents and if file is binary or not
-func (m *Manager) readFileIsBinary(path string) ([]byte, bool, error) {
-	contents, err := m.readFile(path)
+	if progInfo.RuntimeName != runtime.Name {
+		progInfo.Runtime = runtime.Version
+		progInfo.RuntimeName = runtime.Name
+	}
+	if runtime.Name != Python {
+		progInfo.PythonVersion = ""
+	}
+	if runtime.Name != Node {
+		progInfo.NodeVersion = ""
+	}
+	progInfo.Deps = deps
+	err = m.StoreProgInfo(progInfo)
 	if err != nil {
-		return nil, false, err
+		return nil, err
 	}
-	return contents, isBinary(contents), nil
+	return progInfo, nil
 }
 
-// calculates the sha256 sum of contents of file in path
-func (m *Manager) calcChecksum(path string) (string, error) {
-	contents, err := m.readFile(path)
-	if err != nil {
-		return "", err
+// stores the detected runtime in progInfo if it's a different runtime than the stored runtime
+// the stored version is kept if the runtime did not change eg: python3.8 is not rewritten to the default python version
+func (m *Manager) storeDetectedRuntime(progInfo *ProgInfo, detected *Runtime) error {
+	if progInfo == nil {
+		return nil
 	}
-	hashSum := fmt.Sprintf("%x", sha256.Sum256(contents))
-	return hashSum, nil
+	name := progInfo.RuntimeName
+	if name == "" {
+		if r, err := CheckRuntime(progInfo.Runtime); err == nil {
+			name = r.Name
+		}
+	}
+	if progInfo.Runtime != "" && name == detected.Name {
+		return nil
+	}
+	progInfo.Runtime = detected.Version
+	progInfo.RuntimeName = detected.Name
+	return m.StoreProgInfo(progInfo)
 }
 
-// StoreState stores hashes of the current state of all files(not hidden) in the root program directory
-func (m *Manager) StoreState() error {
-	r, err := m.GetRuntime()
+// ValidateRuntime checks if the entrypoint files in the root dir contradict the stored runtime
+// returns an error only if the entrypoint files are of a single runtime other than the stored runtime
+// so programs with entrypoint files of several runtimes eg: main.py and index.js keep deploying on the stored runtime
+// returns nil if the program is not initialized or no entrypoint file is present
+func (m *Manager) ValidateRuntime() error {
+	progInfo, err := m.GetProgInfo()
 	if err != nil {
 		return err
 	}
-
-	sm := make(stateMap)
-	err = filepath.Walk(m.rootDir, func(path string, info os.FileInfo, err error) error {
+	if progInfo == nil || progInfo.Runtime == "" {
+		return nil
+	}
+	name := progInfo.RuntimeName
+	if name == "" {
+		stored, err := CheckRuntime(progInfo.Runtime)
 		if err != nil {
 			return err
 		}
+		name = stored.Name
+	}
 
-		path, err = filepath.Rel(m.rootDir, path)
-		if err != nil {
-			return err
-		}
+	candidates, err := m.candidateRuntimes()
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 || contains(candidates, name) {
+		return nil
+	}
+	if len(candidates) > 1 {
+		m.warn("found entrypoints of the %s runtimes but micro runtime is %s", strings.Join(candidates, ", "), progInfo.Runtime)
+		return nil
+	}
+	return fmt.Errorf("%w: found %s entrypoint but micro runtime is %s, create a new micro for the %s runtime with `deta new`",
+		ErrRuntimeMismatch, candidates[0], progInfo.Runtime, candidates[0])
+}
 
-		shouldSkip, err := m.shouldSkip(path, r.Name)
+// candidateRuntimes returns the sorted names of the runtimes with an entrypoint file in the root dir
+// unlike detectRuntime, entrypoint files of several runtimes are not a conflict
+// and the custom runtime is a candidate if a Dockerfile is present along with other entrypoint files
+func (m *Manager) candidateRuntimes() ([]string, error) {
+	files, err := m.fs.ReadDir(m.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if f.Name() == dockerfile {
+			found[Custom] = true
+			continue
+		}
+		if r, _, ok := m.entrypointRuntime(f.Name()); ok && m.isEntrypointOf(r, files) {
+			found[r] = true
+		}
+	}
+	if m.packageMain() != "" {
+		found[Node] = true
+	}
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// checks the conditions of entrypoint files of runtime r other than their names, files are the files of the root dir
+func (m *Manager) isEntrypointOf(r string, files []os.FileInfo) bool {
+	switch r {
+	case DotNet:
+		// Program.cs is only an entrypoint of a .net project
+		return findCsproj(files) != ""
+	case Rust:
+		// Cargo.toml is only an entrypoint of a binary crate
+		_, err := m.fs.Stat(filepath.Join(m.rootDir, rustMainFile))
+		return err == nil
+	case Scala:
+		// build.sbt is only an entrypoint of a project with scala sources
+		info, err := m.fs.Stat(filepath.Join(m.rootDir, filepath.FromSlash(scalaMainDir)))
+		return err == nil && info.IsDir()
+	}
+	return true
+}
+
+// detects the runtime of the program from the entrypoint file in the root dir
+func (m *Manager) detectRuntime() (*Runtime, error) {
+	runtime, _, err := m.detectEntrypoint()
+	return runtime, err
+}
+
+// returns the runtime of an entrypoint file and the preference of the file among the entrypoints of the runtime, 0 is the most preferred
+func entrypointRuntime(name string) (string, int, bool) {
+	for runtime, files := range entryPoints {
+		for i, f := range files {
+			if f == name {
+				return runtime, i, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// returns the runtime of an entrypoint file like entrypointRuntime with the entrypoints of the config
+// entrypoints of the config are preferred over built in entrypoints of the runtime
+func (m *Manager) entrypointRuntime(name string) (string, int, bool) {
+	if runtime, ok := m.config.Entrypoints[name]; ok {
+		return runtime, -1, true
+	}
+	return entrypointRuntime(name)
+}
+
+// EffectiveEntrypoints returns the names of the entrypoint files mapped to their runtimes eg: main.py to python
+// built in entrypoints merged with the entrypoints of the config which override them, eg: for debugging runtime detection
+func (m *Manager) EffectiveEntrypoints() map[string]string {
+	effective := make(map[string]string)
+	for runtime, files := range entryPoints {
+		for _, f := range files {
+			effective[f] = runtime
+		}
+	}
+	for name, runtime := range m.config.Entrypoints {
+		effective[name] = runtime
+	}
+	return effective
+}
+
+// detects the runtime of the program and the name of the entrypoint file in the root dir
+// of several entrypoint files of a runtime the most preferred is used, the main file of package.json is preferred for node
+func (m *Manager) detectEntrypoint() (*Runtime, string, error) {
+	// only entrypoints in the root dir are considered
+	// entrypoints in sub dirs eg: bundled samples do not conflict
+	files, err := m.fs.ReadDir(m.rootDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var runtime *Runtime
+	var entrypoint string
+	var preference int
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		r, i, ok := m.entrypointRuntime(f.Name())
+		if !ok || !m.isEntrypointOf(r, files) {
+			continue
+		}
+		if runtime == nil {
+			entrypoint, preference = f.Name(), i
+			runtime = &Runtime{
+				Name:    r,
+				Version: GetDefaultRuntimeVersion(r),
+			}
+		} else if runtime.Name != r {
+			return nil, "", fmt.Errorf("%w: %s and %s", ErrEntrypointConflict, entrypoint, f.Name())
+		} else if i < preference {
+			entrypoint, preference = f.Name(), i
+		}
+	}
+	// a package.json of a tool in a program of another runtime does not make it a node program
+	if runtime == nil || runtime.Name == Node {
+		if main := m.packageMain(); main != "" {
+			return &Runtime{Name: Node, Version: GetDefaultRuntimeVersion(Node)}, main, nil
+		}
+	}
+	if runtime == nil {
+		for _, f := range files {
+			if f.Name() == dockerfile && !f.IsDir() {
+				return &Runtime{Name: Custom, Version: GetDefaultRuntimeVersion(Custom)}, dockerfile, nil
+			}
+		}
+		for _, f := range files {
+			if name, ok := unsupportedManifests[f.Name()]; ok && !f.IsDir() {
+				return nil, "", &UnsupportedRuntimeError{Manifest: f.Name(), Runtime: name}
+			}
+		}
+		return nil, "", ErrNoEntrypoint
+	}
+	return runtime, entrypoint, nil
+}
+
+// returns the path relative to the root dir of the main file of the package.json in the root dir
+// empty if there is no package.json, it has no main field or the main file is not present in the root dir
+func (m *Manager) packageMain() string {
+	contents, err := m.readDepFile(depFiles[Node])
+	if err != nil {
+		return ""
+	}
+	var pj struct {
+		Main string `json:"main"`
+	}
+	if err := json.Unmarshal(contents, &pj); err != nil || pj.Main == "" {
+		return ""
+	}
+	abs, err := m.absPath(pj.Main)
+	if err != nil {
+		return ""
+	}
+	main, err := m.relPath(abs)
+	if err != nil || main == "." {
+		return ""
+	}
+	info, err := m.fs.Stat(abs)
+	if err != nil || info.IsDir() {
+		m.debugf("skipping main file %s of %s: not present", pj.Main, depFiles[Node])
+		return ""
+	}
+	return main
+}
+
+// GetEntrypoint returns the path relative to the root dir of the entrypoint file of the program
+// eg: main.py, or the main file of package.json of a node program
+// returns an error wrapping ErrNoEntrypoint if no entrypoint file is present
+func (m *Manager) GetEntrypoint() (string, error) {
+	_, entrypoint, err := m.detectEntrypoint()
+	return entrypoint, err
+}
+
+// ReadEntrypoint returns the contents of the entrypoint file in the root dir and the name of the detected runtime
+// returns an error wrapping ErrNoEntrypoint if no entrypoint file is present
+func (m *Manager) ReadEntrypoint() ([]byte, string, error) {
+	runtime, entrypoint, err := m.detectEntrypoint()
+	if err != nil {
+		return nil, "", err
+	}
+	contents, err := m.readFile(filepath.Join(m.rootDir, filepath.FromSlash(entrypoint)))
+	if err != nil {
+		return nil, "", err
+	}
+	return contents, runtime.Name, nil
+}
+
+// Warnings returns the warnings collected while reading the program
+func (m *Manager) Warnings() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.warnings...)
+}
+
+// adds a warning
+func (m *Manager) warn(format string, a ...interface{}) {
+	m.infof(format, a...)
+	m.mu.Lock()
+	m.warnings = append(m.warnings, fmt.Sprintf(format, a...))
+	m.mu.Unlock()
+}
+
+// SetIncludeDevDeps sets if dev deps are read eg: devDependencies of package.json, require-dev of composer.json
+func (m *Manager) SetIncludeDevDeps(include bool) {
+	m.includeDevDeps = include
+}
+
+// SetTrackModes sets if file modes are stored with the state
+// so GetChanges reports files that changed only in permissions in ModeChanges
+func (m *Manager) SetTrackModes(track bool) {
+	m.trackModes = track
+}
+
+// SetTrackEmptyDirs sets if empty dirs are stored with the state
+// so GetChanges reports created and deleted empty dirs in EmptyDirs and DeletedEmptyDirs
+// dirs with files are implied by their files
+func (m *Manager) SetTrackEmptyDirs(track bool) {
+	m.trackEmptyDirs = track
+}
+
+// SetClassifyBinary sets if GetChanges reports if changed files look binary in BinaryPaths
+// by a null byte or invalid utf-8 in the first few KB of the file
+func (m *Manager) SetClassifyBinary(classify bool) {
+	m.classifyBinary = classify
+}
+
+// SetCanonicalJSON sets if json dependency files eg: package.json are canonicalized before they are hashed
+// so reformatting them eg: reordering keys, changing indentation is not reported as a change
+// files that are not valid json are hashed as is, other files are not affected
+// checksums of the state stored before are of the raw contents, so the files may be reported as changed once
+func (m *Manager) SetCanonicalJSON(canonical bool) {
+	m.canonicalJSON = canonical
+	// checksums cached before are of other contents
+	m.checksumsMu.Lock()
+	m.checksums = nil
+	m.checksumsMu.Unlock()
+}
+
+// SetMaxFileSize sets the size in bytes above which changed files are reported in OversizedFiles of the changes
+// oversized files are still read, so the cli can warn about files a backend rejects, 0 for unlimited
+func (m *Manager) SetMaxFileSize(size int64) {
+	m.maxFileSize = size
+}
+
+// SetNormalizeEOL sets if line endings of text files are normalized before files are hashed
+// so files that changed only in line endings eg: \n to \r\n are not reported as changed, binary files are hashed as is
+// if trimTrailing is set, trailing whitespace of lines is trimmed as well
+// checksums of the state stored before are of the raw contents, so files may be reported as changed once
+func (m *Manager) SetNormalizeEOL(normalize, trimTrailing bool) {
+	m.normalizeEOL = normalize
+	m.trimTrailing = normalize && trimTrailing
+	// checksums cached before are of other contents
+	m.checksumsMu.Lock()
+	m.checksums = nil
+	m.checksumsMu.Unlock()
+}
+
+// SetFollowSymlinks sets if symlinks are resolved when walking the root dir
+// so the files of a linked dir are read under the path of the link, links to dirs being walked are skipped to not loop forever
+// symlinks to files are always read from their targets, symlinks to dirs are skipped if not followed
+func (m *Manager) SetFollowSymlinks(follow bool) {
+	m.followLinks = follow
+}
+
+// SetOutputDirs sets the names of dirs of build outputs which are not walked into at any depth, nil to walk into all of them
+// defaults to dist, build, target and __pycache__, output dirs can be included with negated patterns of .detaignore eg: !build
+// output dirs with files stored in the state are walked into, so stored files are not reported as deleted, ignore them in .detaignore to untrack them
+func (m *Manager) SetOutputDirs(names []string) {
+	m.outputDirs = names
+}
+
+// if a file with contents of size is larger than the max file size
+func (m *Manager) isOversized(size int) bool {
+	return m.maxFileSize > 0 && int64(size) > m.maxFileSize
+}
+
+// SetSalt sets a salt mixed into ProjectChecksum and DepsFingerprint
+// so identical files in different projects have different digests eg: when digests of projects share a cache
+// use RootDir() for a salt derived from the root dir, checksums of files in the state are not salted
+func (m *Manager) SetSalt(salt string) {
+	m.salt = salt
+}
+
+// writes the salt to a hash if set
+func (m *Manager) writeSalt(w io.Writer) {
+	if m.salt != "" {
+		fmt.Fprintf(w, "salt\x00%s\x00", m.salt)
+	}
+}
+
+// SetMaxDepth sets the max depth of dirs walked into eg: 2 walks into lib/utils but not lib/utils/internal
+// dirs deeper than depth are skipped, or if strict walks fail with ErrMaxDepthExceeded
+// depth 0 is unlimited
+func (m *Manager) SetMaxDepth(depth int, strict bool) {
+	m.maxDepth = depth
+	m.strictDepth = strict
+}
+
+// SetAlwaysUpload sets files that are always uploaded without comparing checksums eg: frequently changing compiled assets
+// files with an extension in exts eg: .bin or with a size above size in bytes are always reported as changed
+// size 0 disables the size threshold
+func (m *Manager) SetAlwaysUpload(exts []string, size int64) {
+	m.alwaysUploadExt = nil
+	for _, e := range exts {
+		m.alwaysUploadExt = append(m.alwaysUploadExt, strings.ToLower("."+strings.TrimPrefix(e, ".")))
+	}
+	m.alwaysUploadMin = size
+}
+
+// if a file should always be uploaded without comparing checksums
+func (m *Manager) isAlwaysUpload(path string, info os.FileInfo) bool {
+	if m.alwaysUploadMin > 0 && info.Size() > m.alwaysUploadMin {
+		return true
+	}
+	return contains(m.alwaysUploadExt, strings.ToLower(filepath.Ext(path)))
+}
+
+// SetPreferPipfile sets if python deps are read from Pipfile when both Pipfile and requirements.txt are present
+func (m *Manager) SetPreferPipfile(prefer bool) {
+	m.preferPipfile = prefer
+}
+
+// SetPinCheck sets how python deps without an exact version pin are handled by GetDepChanges
+func (m *Manager) SetPinCheck(c PinCheck) {
+	m.pinCheck = c
+}
+
+// SetIncludeHidden sets hidden files or dirs that should not be skipped
+// patterns are matched against the file name and can be exact names or globs eg: .env.example, .*rc
+// the .deta dir is always skipped
+func (m *Manager) SetIncludeHidden(patterns []string) {
+	m.includeHidden = patterns
+}
+
+// if a file or dir is hidden
+func (m *Manager) isHidden(path string) (bool, error) {
+	_, filename := filepath.Split(path)
+	return strings.HasPrefix(filename, ".") && filename != ".", nil
+}
+
+// if a hidden file or dir is in the include hidden list
+func (m *Manager) isIncludedHidden(path string) bool {
+	_, filename := filepath.Split(path)
+	if filename == detaDir {
+		return false
+	}
+	for _, p := range m.includeHidden {
+		if p == filename {
+			return true
+		}
+		if ok, err := filepath.Match(p, filename); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// reads the contents of a file, returns contents
+// errors are wrapped with the path of the file
+func (m *Manager) readFile(path string) ([]byte, error) {
+	var contents []byte
+	err := m.retry(func() error {
+		f, err := m.fs.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		contents, err = ioutil.ReadAll(f)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return contents, nil
+}
+
+// reads the contents of a file, returns contents and if file is binary or not
+func (m *Manager) readFileIsBinary(path string) ([]byte, bool, error) {
+	contents, err := m.readProgFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	return contents, isBinary(contents), nil
+}
+
+// a checksum of a file valid while the size and modification time of the file are unchanged
+type fileSum struct {
+	size     int64
+	modTime  time.Time
+	checksum string
+}
+
+// calculates the checksum of contents of file in path with the configured hasher
+// checksums are cached by path, size and modification time so unchanged files are hashed once
+func (m *Manager) calcChecksum(path string) (string, error) {
+	checksum, _, err := m.hashFile(path)
+	return checksum, err
+}
+
+// ChecksumFile returns the checksum of the file in relPath relative to the root dir as stored in the state
+// eg: to compare against the checksum of the file on the server, returns an error if the path is not in the root dir
+func (m *Manager) ChecksumFile(relPath string) (string, error) {
+	abs, err := m.absPath(relPath)
+	if err != nil {
+		return "", err
+	}
+	return m.calcChecksum(abs)
+}
+
+// absPath returns the absolute path of relPath relative to the root dir
+// returns an error if relPath is absolute or not in the root dir eg: ../other
+func (m *Manager) absPath(relPath string) (string, error) {
+	if filepath.IsAbs(filepath.FromSlash(relPath)) {
+		return "", fmt.Errorf("'%s' is not relative to the root dir '%s'", relPath, m.rootDir)
+	}
+	abs := filepath.Join(m.rootDir, filepath.FromSlash(relPath))
+	if _, err := m.relPath(abs); err != nil {
+		return "", err
+	}
+	return abs, nil
+}
+
+// hashFile calculates the checksum of the file in path like calcChecksum
+// and returns the contents hashed, nil if the checksum was cached
+func (m *Manager) hashFile(path string) (string, []byte, error) {
+	rel, _ := m.relPath(path)
+	info, err := m.fs.Stat(path)
+	if err != nil {
+		m.emitError(rel, err)
+		return "", nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	m.checksumsMu.Lock()
+	cached, ok := m.checksums[path]
+	m.checksumsMu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.checksum, nil, nil
+	}
+
+	m.debugf("hashing %s", path)
+	start := time.Now()
+	contents, err := m.readProgFile(path)
+	if err != nil {
+		m.emitError(rel, err)
+		return "", nil, err
+	}
+	checksum := m.checksumOf(rel, contents)
+	m.emit(Event{Type: EventHashed, Path: rel, Size: int64(len(contents)), Duration: time.Since(start)})
+
+	m.checksumsMu.Lock()
+	if m.checksums == nil {
+		m.checksums = make(map[string]fileSum)
+	}
+	m.checksums[path] = fileSum{size: info.Size(), modTime: info.ModTime(), checksum: checksum}
+	m.checksumsMu.Unlock()
+	return checksum, contents, nil
+}
+
+// walk walks the root dir calling fn for every file that should not be skipped
+// path passed to fn is relative to the root dir
+// symlinks to missing targets are skipped
+func (m *Manager) walk(runtime string, fn func(path string, info os.FileInfo) error) error {
+	return m.walkFiles(runtime, fn, nil)
+}
+
+// walkFiles walks like walk and calls onSkipped if not nil with the slash separated path of every skipped broken symlink
+// and special file, special is true for special files
+// special files are named pipes, sockets and devices or links to them, opening them can block or fail
+func (m *Manager) walkFiles(runtime string, fn func(path string, info os.FileInfo) error, onSkipped func(path string, special bool)) error {
+	return m.walkFilesFrom(runtime, ".", fn, nil, onSkipped)
+}
+
+// walkFilesFrom walks the dir start relative to the root dir like walkFiles
+// and calls onDir if not nil for every dir walked into including start unless start is the root dir
+// onDir can return filepath.SkipDir to not walk into the dir
+func (m *Manager) walkFilesFrom(runtime, start string, fn, onDir func(path string, info os.FileInfo) error, onSkipped func(path string, special bool)) error {
+	return m.walkAllFrom(runtime, start, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
+			if onDir != nil {
+				return onDir(path, info)
+			}
+			return nil
+		}
+		return fn(path, info)
+	}, func(path string, info os.FileInfo, reason string) {
+		if onSkipped == nil || (reason != reasonSpecial && reason != reasonBrokenLink) {
+			return
+		}
+		if slash, err := m.relPath(filepath.Join(m.rootDir, path)); err == nil {
+			onSkipped(slash, reason == reasonSpecial)
+		}
+	})
+}
+
+// isSpecialFile checks if info is of a named pipe, socket or device
+func isSpecialFile(info os.FileInfo) bool {
+	return info.Mode()&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeCharDevice|os.ModeIrregular) != 0
+}
+
+// walkAll walks the root dir calling fn for every file and dir except the root dir that is included by the filters
+// and onSkip if not nil with the reason for every skipped file and dir, see SetFilters
+// path passed to fn and onSkip is relative to the root dir
+func (m *Manager) walkAll(runtime string, fn func(path string, info os.FileInfo) error, onSkip func(path string, info os.FileInfo, reason string)) error {
+	return m.walkAllFrom(runtime, ".", fn, onSkip)
+}
+
+// walkAllFrom walks the dir start relative to the root dir like walkAll
+func (m *Manager) walkAllFrom(runtime, start string, fn func(path string, info os.FileInfo) error, onSkip func(path string, info os.FileInfo, reason string)) error {
+	var visited map[string]bool
+	if m.followLinks {
+		real, err := m.fs.EvalSymlinks(m.rootDir)
+		if err != nil {
+			return err
+		}
+		visited = map[string]bool{real: true}
+	}
+	return m.walkTree(runtime, filepath.Join(m.rootDir, start), start, visited, fn, onSkip)
+}
+
+// walks dir whose path relative to the root dir is rel like walkAll
+// symlinks are followed if visited is not nil, which holds the real paths of the linked dirs being walked
+func (m *Manager) walkTree(runtime, dir, rel string, visited map[string]bool, fn func(path string, info os.FileInfo) error, onSkip func(path string, info os.FileInfo, reason string)) error {
+	return m.fs.Walk(dir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if rel, relErr := m.relPath(fullPath); relErr == nil {
+				m.emitError(rel, err)
+			}
+			return fmt.Errorf("walking %s: %w", fullPath, err)
+		}
+
+		// relative to dir, which is not in the root dir if it's a linked dir
+		path, err := relPathFrom(dir, fullPath)
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(rel, filepath.FromSlash(path))
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := m.fs.Stat(fullPath)
+			// broken links are passed on as links
+			if err == nil && target.IsDir() {
+				if visited == nil {
+					m.debugf("skipping %s: symlink to a dir", path)
+					return nil
+				}
+				return m.walkLinkedDir(runtime, fullPath, path, target, visited, fn, onSkip)
+			}
+			if err == nil && visited != nil {
+				info = target
+			}
+		}
+
+		if path == "." {
+			return nil
+		}
+		action, reason, err := m.applyFilters(runtime, path, info)
+		if err != nil {
+			return err
+		}
+		if action == FilterSkip || action == FilterSkipDir {
+			m.emit(Event{Type: EventSkipped, Path: path})
+			if onSkip != nil {
+				onSkip(path, info, reason)
+			}
+			if action == FilterSkipDir {
+				m.debugf("pruning dir %s", path)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			m.emit(Event{Type: EventDiscovered, Path: path, Size: info.Size()})
+		}
+		return fn(path, info)
+	})
+}
+
+// walks the target of the symlink in fullPath to a dir under path, links to dirs being walked are skipped to break cycles
+func (m *Manager) walkLinkedDir(runtime, fullPath, path string, target os.FileInfo, visited map[string]bool, fn func(path string, info os.FileInfo) error, onSkip func(path string, info os.FileInfo, reason string)) error {
+	action, reason, err := m.applyFilters(runtime, path, target)
+	if err != nil {
+		return err
+	}
+	if action == FilterSkipDir {
+		m.debugf("pruning dir %s", path)
+		m.emit(Event{Type: EventSkipped, Path: path})
+		if onSkip != nil {
+			onSkip(path, target, reason)
+		}
+		return nil
+	}
+
+	real, err := m.fs.EvalSymlinks(fullPath)
+	if err != nil {
+		return err
+	}
+	parent, err := m.fs.EvalSymlinks(filepath.Dir(fullPath))
+	if err != nil {
+		return err
+	}
+	// a link to a dir containing it eg: loop -> .. is a cycle
+	if visited[real] || parent == real || strings.HasPrefix(parent, real+string(os.PathSeparator)) {
+		m.debugf("skipping %s: symlink cycle", path)
+		return nil
+	}
+	visited[real] = true
+	defer delete(visited, real)
+	return m.walkTree(runtime, real, path, visited, fn, onSkip)
+}
+
+// emptyDirs returns sorted paths of dirs without files or dirs that are not skipped
+func (m *Manager) emptyDirs(runtime string) ([]string, error) {
+	var dirs []string
+	nonEmpty := make(map[string]struct{})
+	err := m.walkAll(runtime, func(path string, info os.FileInfo) error {
+		path, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		if parent := pathpkg.Dir(path); parent != "." {
+			nonEmpty[parent] = struct{}{}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var empty []string
+	for _, d := range dirs {
+		if _, ok := nonEmpty[d]; !ok {
+			empty = append(empty, d)
+		}
+	}
+	sort.Strings(empty)
+	return empty, nil
+}
+
+// state map keys of empty dirs end with a slash to not conflict with files
+func emptyDirKey(dir string) string {
+	return dir + "/"
+}
+
+func isEmptyDirKey(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// StoreState stores hashes of the current state of all files(not hidden) in the root program directory
+func (m *Manager) StoreState() error {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return err
+	}
+
+	sm := make(stateMap)
+	var dirs *dirsRecord
+	if m.dirShortcut {
+		dirs = &dirsRecord{Dirs: make(dirMap), Files: make(map[string]fileStamp)}
+	}
+	var tree *treeHasher
+	if m.dirDigests {
+		tree = newTreeHasher()
+	}
+	p, err := m.startProgress(r.Name)
+	if err != nil {
+		return err
+	}
+	err = m.walkFilesFrom(r.Name, ".", func(path string, info os.FileInfo) error {
+		defer p.step()
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		// the file is stat'ed before it is hashed, so a change in between changes the digest on the next walk
+		if tree != nil {
+			if err := m.addTreeFile(tree, path, info); err != nil {
+				return err
+			}
+		}
+		if dirs != nil {
+			dirs.Files[slash] = stampOf(info)
+		}
+		// always uploaded files are tracked without a checksum
+		if m.isAlwaysUpload(path, info) {
+			sm[slash] = ""
+			return nil
+		}
+		hashSum, err := m.calcChecksum(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		sm[slash] = hashSum
+		return nil
+	}, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if dirs != nil {
+			dirs.Dirs[slash] = info.ModTime().UnixNano()
+		}
+		if tree != nil {
+			tree.addDir(slash)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	p.finish()
+	if m.trackEmptyDirs {
+		dirs, err := m.emptyDirs(r.Name)
+		if err != nil {
+			return err
+		}
+		for _, d := range dirs {
+			sm[emptyDirKey(d)] = ""
+		}
+	}
+	err = m.storeStateMap(sm)
+	if err != nil {
+		return err
+	}
+	if tree != nil {
+		if err := m.storeDigests(tree.digests()); err != nil {
+			return err
+		}
+	}
+	if dirs != nil {
+		return m.storeDirs(dirs)
+	}
+	return nil
+}
+
+// TouchState accepts the current files as deployed eg: after a deploy outside of the cli made the stored state stale
+// files are only hashed, so subsequent GetChanges report no changes until files change
+func (m *Manager) TouchState() error {
+	return m.StoreState()
+}
+
+// TouchFile accepts the current contents of the file in relPath relative to the root dir as deployed
+// eg: after syncing a single file outside of the cli, other files of the stored state are untouched
+// the file is removed from the stored state if it does not exist anymore or is not tracked eg: ignored
+// if there is no stored state, a state of only the file is stored
+func (m *Manager) TouchFile(relPath string) error {
+	abs, err := m.absPath(relPath)
+	if err != nil {
+		return err
+	}
+	sm, err := m.getStoredState()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		sm = make(stateMap)
+	}
+
+	path, err := m.relPath(abs)
+	if err != nil {
+		return err
+	}
+	if stored, ok := m.stateKeys(sm)[m.stateKey(path)]; ok {
+		delete(sm, stored)
+	}
+	info, err := m.fs.Stat(abs)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil && info.IsDir() {
+		return fmt.Errorf("%w: '%s' is a dir", ErrNotTracked, relPath)
+	}
+	if err != nil || isSpecialFile(info) || m.IsIgnored(relPath) {
+		m.debugf("removing %s from the stored state", path)
+		return m.storeStateMap(sm)
+	}
+
+	if m.isAlwaysUpload(filepath.FromSlash(path), info) {
+		sm[path] = ""
+	} else {
+		checksum, err := m.calcChecksum(abs)
+		if err != nil {
+			return err
+		}
+		sm[path] = checksum
+	}
+	return m.storeStateMap(sm)
+}
+
+// UpdateState updates the stored state with changes from sc without rehashing unchanged files
+// sc should be the changes returned by GetChanges since the state was last stored
+// if there is no stored state, it stores the state of all files
+func (m *Manager) UpdateState(sc *StateChanges) error {
+	sm, err := m.getStoredState()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m.StoreState()
+		}
+		return err
+	}
+	if sc == nil {
+		return nil
+	}
+
+	// drops a stored path that differs from path only in case
+	keys := m.stateKeys(sm)
+	replace := func(path string) {
+		if stored, ok := keys[m.stateKey(path)]; ok && stored != path {
+			delete(sm, stored)
+		}
+	}
+	for path, content := range sc.Changes {
+		replace(path)
+		sm[path] = m.checksumOf(path, []byte(content))
+	}
+	for path, encoded := range sc.BinaryFiles {
+		content, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return err
+		}
+		replace(path)
+		sm[path] = m.checksumOf(path, content)
+	}
+	for _, path := range sc.AlwaysUpload {
+		replace(path)
+		sm[path] = ""
+	}
+	for _, path := range sc.Deletions {
+		delete(sm, path)
+	}
+	for _, dir := range sc.EmptyDirs {
+		sm[emptyDirKey(dir)] = ""
+	}
+	for _, dir := range sc.DeletedEmptyDirs {
+		delete(sm, emptyDirKey(dir))
+	}
+	// hard links have the checksum of the file they link to, which is updated above
+	for path, orig := range sc.Hardlinks {
+		if sum, ok := sm[orig]; ok {
+			replace(path)
+			sm[path] = sum
+		}
+	}
+	return m.storeStateMap(sm)
+}
+
+// PruneDeletions removes files that no longer exist from the stored state without updating checksums of other files
+// returns the removed paths in sorted order
+func (m *Manager) PruneDeletions() ([]string, error) {
+	sm, err := m.getStoredState()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var pruned []string
+	for path := range sm {
+		_, err := m.fs.Lstat(filepath.Join(m.rootDir, filepath.FromSlash(path)))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+			pruned = append(pruned, path)
+			delete(sm, path)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+	sort.Strings(pruned)
+	return pruned, m.storeStateMap(sm)
+}
+
+// stores the state map
+func (m *Manager) storeStateMap(sm stateMap) error {
+	marshalled, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m.filesMu.Lock()
+	defer m.filesMu.Unlock()
+	err = m.writeFileAtomic(m.statePath, marshalled, filePermMode)
+	if err != nil {
+		return err
+	}
+	// written after the state, so a state written partially does not match
+	err = m.writeFileAtomic(filepath.Join(m.detaPath, stateSumFile), []byte(stateSum(marshalled)), filePermMode)
+	if err != nil {
+		return err
+	}
+	m.setTrackedDirs(sm)
+	if m.trackModes {
+		return m.storeModes(sm)
+	}
+	return nil
+}
+
+// stores the current modes of the files in the state map
+func (m *Manager) storeModes(sm stateMap) error {
+	modes := make(modeMap, len(sm))
+	for path := range sm {
+		info, err := m.fs.Lstat(filepath.Join(m.rootDir, filepath.FromSlash(path)))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		modes[path] = info.Mode().Perm()
+	}
+	marshalled, err := json.Marshal(modes)
+	if err != nil {
+		return err
+	}
+	return m.writeFileAtomic(m.modesPath, marshalled, filePermMode)
+}
+
+// gets the stored modes, returns empty modes if modes are not tracked or not stored yet
+func (m *Manager) getStoredModes() (modeMap, error) {
+	if !m.trackModes {
+		return modeMap{}, nil
+	}
+	m.filesMu.RLock()
+	contents, err := m.readFile(m.modesPath)
+	m.filesMu.RUnlock()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return modeMap{}, nil
+		}
+		return nil, err
+	}
+	return modeMapFromBytes(contents)
+}
+
+// checks if the mode of a file differs from its stored mode
+func (m *Manager) modeChanged(modes modeMap, path string, info os.FileInfo) bool {
+	stored, ok := modes[path]
+	return ok && stored != info.Mode().Perm()
+}
+
+// gets the current stored state
+func (m *Manager) getStoredState() (stateMap, error) {
+	m.filesMu.RLock()
+	contents, err := m.readFile(m.statePath)
+	if err != nil {
+		m.filesMu.RUnlock()
+		return nil, err
+	}
+	sum, err := m.readFile(filepath.Join(m.detaPath, stateSumFile))
+	m.filesMu.RUnlock()
+	// states stored without a checksum are not verified
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil && strings.TrimSpace(string(sum)) != stateSum(contents) {
+		m.warn("%s does not match its checksum, all files are read again", m.statePath)
+		return nil, &CorruptStateError{Path: m.statePath}
+	}
+	s, err := stateMapFromBytes(contents)
+	if err != nil {
+		return nil, err
+	}
+	m.setTrackedDirs(s)
+	return s, nil
+}
+
+// StateAge returns how long ago the state was last stored
+// returns an error satisfying errors.Is(err, os.ErrNotExist) if no state is stored
+func (m *Manager) StateAge() (time.Duration, error) {
+	m.filesMu.RLock()
+	info, err := m.fs.Stat(m.statePath)
+	m.filesMu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(info.ModTime()), nil
+}
+
+// SetStaleStateAge sets the age above which the stored state is stale, 0 to never consider the state stale
+// changes against a stale state eg: of a long dormant checkout are likely to be a surprisingly large diff
+// defaults to 30 days
+func (m *Manager) SetStaleStateAge(age time.Duration) {
+	m.staleAge = age
+}
+
+// IsStateStale checks if the stored state is older than the stale state age and returns the age of the state
+// returns false if no state is stored
+func (m *Manager) IsStateStale() (bool, time.Duration, error) {
+	age, err := m.StateAge()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, 0, nil
+		}
+		return false, 0, err
+	}
+	return m.staleAge > 0 && age > m.staleAge, age, nil
+}
+
+// returns the checksum of the serialized state stored with it
+func stateSum(contents []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(contents))
+}
+
+// stateKey returns the key used to compare path with paths of the stored state
+func (m *Manager) stateKey(path string) string {
+	if m.caseInsensitive {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// maps state keys of the paths of the stored state to the stored paths
+func (m *Manager) stateKeys(sm stateMap) map[string]string {
+	keys := make(map[string]string, len(sm))
+	for path := range sm {
+		keys[m.stateKey(path)] = path
+	}
+	return keys
+}
+
+// readAll reads all the files and returns the contents as stateChanges
+// files are read concurrently bounded by readWorkers and readBudget
+// returns ErrNoFiles if there are no files to read
+func (m *Manager) readAll() (*StateChanges, error) {
+	return m.readAllFiles(nil)
+}
+
+// readAllFiles reads all the files like readAll and calls onRead if not nil concurrently with the contents of every file read
+// the path passed to onRead is relative to the root dir with forward slashes, see relPath
+func (m *Manager) readAllFiles(onRead func(path string, info os.FileInfo, contents []byte)) (*StateChanges, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &StateChanges{
+		Changes:     make(map[string]string),
+		BinaryFiles: make(map[string]string),
+		Sizes:       make(map[string]int64),
+		BinaryPaths: make(map[string]bool),
+	}
+
+	p, err := m.startProgress(r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []readJob
+	infos := make(map[string]os.FileInfo)
+	links := m.newHardlinks()
+	err = m.walkFiles(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if orig, ok := links.original(slash, info); ok {
+			sc.addHardlink(slash, orig)
+			p.step()
+			return nil
+		}
+		if onRead != nil {
+			infos[path] = info
+		}
+		jobs = append(jobs, readJob{path: path, key: slash, size: info.Size()})
+		return nil
+	}, sc.addSkipped)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	hashes := make(map[string]string)
+	err = m.readParallel(jobs, func(job readJob, contents []byte) {
+		if onRead != nil {
+			onRead(job.key, infos[job.path], contents)
+		}
+		var hash string
+		if m.dedupContents {
+			hash = contentHash(contents)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if m.dedupContents {
+			hashes[job.key] = hash
+		}
+		if isBinary(contents) {
+			sc.BinaryFiles[job.key] = base64.StdEncoding.EncodeToString(contents)
+		} else {
+			sc.Changes[job.key] = string(contents)
+		}
+		sc.Sizes[job.key] = int64(len(contents))
+		if m.isOversized(len(contents)) {
+			sc.OversizedFiles = append(sc.OversizedFiles, job.key)
+		}
+		if m.classifyBinary {
+			sc.BinaryPaths[job.key] = looksBinary(contents)
+		}
+		p.step()
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.finish()
+	if len(sc.Changes) == 0 && len(sc.BinaryFiles) == 0 {
+		return nil, ErrNoFiles
+	}
+	if m.dedupContents {
+		paths := make([]string, len(jobs))
+		for i, job := range jobs {
+			paths[i] = job.key
+		}
+		sc.setDuplicates(paths, hashes)
+	}
+	sort.Strings(sc.OversizedFiles)
+	return sc, nil
+}
+
+// WalkFiles calls fn with the path relative to the root dir and a reader of every file(not hidden) in the root program directory
+// the reader is closed after fn returns, so files can be streamed without reading all of them in memory
+// if a content transform is set, files are read in memory to be transformed
+func (m *Manager) WalkFiles(fn func(relPath string, r io.Reader) error) error {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return err
+	}
+
+	return m.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if m.transform != nil {
+			contents, err := m.readProgFile(filepath.Join(m.rootDir, path))
+			if err != nil {
+				return err
+			}
+			return fn(slash, bytes.NewReader(contents))
+		}
+		f, err := m.fs.Open(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		defer f.Close()
+		return fn(slash, f)
+	})
+}
+
+// WalkFiltered walks the files(not hidden) of the root program directory like WalkFiles
+// and calls fn with the path relative to the root dir of every file accept returns true for
+// accept is called with the path relative to the root dir using forward slashes and the info of every file that is not skipped
+func (m *Manager) WalkFiltered(accept func(relPath string, info os.FileInfo) bool, fn func(relPath string) error) error {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return err
+	}
+
+	return m.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if !accept(slash, info) {
+			m.debugf("skipping %s: not accepted by filter", path)
+			return nil
+		}
+		return fn(slash)
+	})
+}
+
+// ListFiles returns the sorted paths relative to the root dir using forward slashes of the files of the root dir
+// that are included by the filters, the files read by readAll and stored by StoreState
+func (m *Manager) ListFiles() ([]string, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err = m.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, slash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// GetChanges checks if the state has changed in the root directory
+func (m *Manager) GetChanges() (*StateChanges, error) {
+	return m.getChanges(nil)
+}
+
+// getChanges gets changes like GetChanges and calls onRead if not nil with the contents of every file read
+// the path passed to onRead is relative to the root dir with forward slashes, see relPath
+func (m *Manager) getChanges(onRead func(path string, info os.FileInfo, contents []byte)) (*StateChanges, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &StateChanges{
+		Changes:     make(map[string]string),
+		BinaryFiles: make(map[string]string),
+		Sizes:       make(map[string]int64),
+		ModeChanges: make(map[string]os.FileMode),
+		BinaryPaths: make(map[string]bool),
+	}
+
+	storedState, err := m.getStoredState()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m.readAllFiles(onRead)
+		}
+		return nil, err
+	}
+	storedModes, err := m.getStoredModes()
+	if err != nil {
+		return nil, err
+	}
+	if stale, age, err := m.IsStateStale(); err == nil && stale {
+		m.warn("the stored state is %d days old, consider syncing the program before deploying", int(age.Hours()/24))
+	}
+
+	// mark all paths in current state as deleted
+	// if seen later on walk, remove from deletions
+	deletions := m.stateKeys(storedState)
+
+	p, err := m.startProgress(r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	links := m.newHardlinks()
+	// changed paths in walk order and content hashes of changed files, if contents are deduplicated
+	var changed []string
+	hashes := make(map[string]string)
+	// checksums of the files hashed by the walk, hard links are unchanged if the file they link to is
+	sums := make(map[string]string)
+	err = m.walkChangedFiles(r.Name, storedState, func(path string, info os.FileInfo) error {
+		defer p.step()
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		// update deletions
+		key := m.stateKey(slash)
+		storedPath, ok := deletions[key]
+		if ok {
+			delete(deletions, key)
+		}
+		if orig, isLink := links.original(slash, info); isLink {
+			if sum, hashed := sums[orig]; !ok || (hashed && storedState[storedPath] != sum) {
+				sc.addHardlink(slash, orig)
+			}
+			return nil
+		}
+
+		alwaysUpload := m.isAlwaysUpload(path, info)
+		var checksum string
+		// contents read by hashFile, nil if the checksum is cached
+		var contents []byte
+		if alwaysUpload {
+			sc.AlwaysUpload = append(sc.AlwaysUpload, slash)
+		} else {
+			var err error
+			checksum, contents, err = m.hashFile(filepath.Join(m.rootDir, path))
+			if err != nil {
+				return err
+			}
+			sums[slash] = checksum
+		}
+
+		modified := alwaysUpload || !ok || storedState[storedPath] != checksum
+		if modified && contents == nil {
+			var err error
+			contents, err = m.readProgFile(filepath.Join(m.rootDir, path))
+			if err != nil {
+				return err
+			}
+		}
+		if onRead != nil && contents != nil {
+			onRead(slash, info, contents)
+		}
+
+		if modified {
+			if m.dedupContents {
+				changed = append(changed, slash)
+				hashes[slash] = contentHash(contents)
+			}
+			if isBinary(contents) {
+				sc.BinaryFiles[slash] = base64.StdEncoding.EncodeToString(contents)
+			} else {
+				sc.Changes[slash] = string(contents)
+			}
+			sc.Sizes[slash] = int64(len(contents))
+			if m.isOversized(len(contents)) {
+				sc.OversizedFiles = append(sc.OversizedFiles, slash)
+			}
+			if m.classifyBinary {
+				sc.BinaryPaths[slash] = looksBinary(contents)
+			}
+		} else if m.modeChanged(storedModes, storedPath, info) {
+			sc.ModeChanges[slash] = info.Mode().Perm()
+		}
+		return nil
+	}, func(storedPath string) {
+		delete(deletions, m.stateKey(storedPath))
+		p.step()
+	}, sc.addSkipped)
+
+	if err != nil {
+		return nil, err
+	}
+	p.finish()
+
+	if m.trackEmptyDirs {
+		dirs, err := m.emptyDirs(r.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dirs {
+			key := m.stateKey(emptyDirKey(d))
+			if _, ok := deletions[key]; ok {
+				delete(deletions, key)
+			} else {
+				sc.EmptyDirs = append(sc.EmptyDirs, d)
+			}
+		}
+	}
+
+	sc.setDuplicates(changed, hashes)
+	sort.Strings(sc.AlwaysUpload)
+	sort.Strings(sc.OversizedFiles)
+	sc.Deletions = []string{}
+	for _, storedPath := range deletions {
+		if isEmptyDirKey(storedPath) {
+			if m.trackEmptyDirs {
+				sc.DeletedEmptyDirs = append(sc.DeletedEmptyDirs, strings.TrimSuffix(storedPath, "/"))
+			}
+			continue
+		}
+		sc.Deletions = append(sc.Deletions, storedPath)
+	}
+	sort.Strings(sc.Deletions)
+	sort.Strings(sc.DeletedEmptyDirs)
+
+	if sc.isEmpty() {
+		return nil, nil
+	}
+	return sc, nil
+}
+
+// GetChangesMatching gets changes like GetChanges but only returns changes of files with paths matching glob
+// glob is matched against paths relative to the root dir, ** matches any number of dirs eg: api/**
+func (m *Manager) GetChangesMatching(glob string) (*StateChanges, error) {
+	// validate the pattern before walking
+	if _, err := matchGlob(glob, ""); err != nil {
+		return nil, err
+	}
+
+	sc, err := m.GetChanges()
+	if err != nil || sc == nil {
+		return nil, err
+	}
+
+	matched := &StateChanges{
+		Changes:     make(map[string]string),
+		BinaryFiles: make(map[string]string),
+		Sizes:       make(map[string]int64),
+		ModeChanges: make(map[string]os.FileMode),
+		BinaryPaths: make(map[string]bool),
+	}
+	for path, content := range sc.Changes {
+		if ok, _ := matchGlob(glob, path); ok {
+			matched.Changes[path] = content
+			matched.Sizes[path] = sc.Sizes[path]
+		}
+	}
+	for path, content := range sc.BinaryFiles {
+		if ok, _ := matchGlob(glob, path); ok {
+			matched.BinaryFiles[path] = content
+			matched.Sizes[path] = sc.Sizes[path]
+		}
+	}
+	for path, binary := range sc.BinaryPaths {
+		if ok, _ := matchGlob(glob, path); ok {
+			matched.BinaryPaths[path] = binary
+		}
+	}
+	for _, path := range sc.Deletions {
+		if ok, _ := matchGlob(glob, path); ok {
+			matched.Deletions = append(matched.Deletions, path)
+		}
+	}
+	for path, mode := range sc.ModeChanges {
+		if ok, _ := matchGlob(glob, path); ok {
+			matched.ModeChanges[path] = mode
+		}
+	}
+	for _, path := range sc.AlwaysUpload {
+		if ok, _ := matchGlob(glob, path); ok {
+			matched.AlwaysUpload = append(matched.AlwaysUpload, path)
+		}
+	}
+	for _, path := range sc.OversizedFiles {
+		if ok, _ := matchGlob(glob, path); ok {
+			matched.OversizedFiles = append(matched.OversizedFiles, path)
+		}
+	}
+	for path, orig := range sc.Hardlinks {
+		if ok, _ := matchGlob(glob, path); ok {
+			matched.addHardlink(path, orig)
+		}
+	}
+	for _, dir := range sc.EmptyDirs {
+		if ok, _ := matchGlob(glob, dir); ok {
+			matched.EmptyDirs = append(matched.EmptyDirs, dir)
+		}
+	}
+	for _, dir := range sc.DeletedEmptyDirs {
+		if ok, _ := matchGlob(glob, dir); ok {
+			matched.DeletedEmptyDirs = append(matched.DeletedEmptyDirs, dir)
+		}
+	}
+
+	if matched.isEmpty() {
+		return nil, nil
+	}
+	return matched, nil
+}
+
+// errChangeFound stops the walk when a change is found
+var errChangeFound = errors.New("change found")
+
+// HasChanges checks if any file has changed since the state was last stored without reading the changes
+// the walk stops at the first change found
+func (m *Manager) HasChanges() (bool, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return false, err
+	}
+
+	storedState, err := m.getStoredState()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
+	storedModes, err := m.getStoredModes()
+	if err != nil {
+		return false, err
+	}
+
+	keys := m.stateKeys(storedState)
+	seen := 0
+	err = m.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
 		if err != nil {
 			return err
 		}
-
-		if info.IsDir() {
-			if shouldSkip {
-				return filepath.SkipDir
-			}
-			return nil
+		storedPath, ok := keys[m.stateKey(slash)]
+		if !ok {
+			return errChangeFound
 		}
-		if shouldSkip {
-			return nil
+		storedChecksum := storedState[storedPath]
+		seen++
+		if m.isAlwaysUpload(path, info) {
+			return errChangeFound
 		}
 
-		hashSum, err := m.calcChecksum(filepath.Join(m.rootDir, path))
+		checksum, err := m.calcChecksum(filepath.Join(m.rootDir, path))
 		if err != nil {
 			return err
 		}
-		sm[filepath.ToSlash(path)] = hashSum
+		if checksum != storedChecksum || m.modeChanged(storedModes, storedPath, info) {
+			return errChangeFound
+		}
 		return nil
 	})
 	if err != nil {
-		return err
+		if errors.Is(err, errChangeFound) {
+			return true, nil
+		}
+		return false, err
 	}
 
-	marshalled, err := json.Marshal(sm)
-	if err != nil {
-		return err
+	storedFiles := 0
+	storedDirs := 0
+	for k := range storedState {
+		if isEmptyDirKey(k) {
+			storedDirs++
+		} else {
+			storedFiles++
+		}
 	}
-
-	err = ioutil.WriteFile(m.statePath, marshalled, filePermMode)
-	if err != nil {
-		return err
+	// files in stored state not seen on walk have been deleted
+	if seen != storedFiles {
+		return true, nil
+	}
+	if !m.trackEmptyDirs {
+		return false, nil
 	}
-	return nil
-}
 
-// gets the current stored state
-func (m *Manager) getStoredState() (stateMap, error) {
-	contents, err := m.readFile(m.statePath)
+	dirs, err := m.emptyDirs(r.Name)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	s, err := stateMapFromBytes(contents)
-	if err != nil {
-		return nil, err
+	if len(dirs) != storedDirs {
+		return true, nil
 	}
-	return s, nil
+	for _, d := range dirs {
+		if _, ok := keys[m.stateKey(emptyDirKey(d))]; !ok {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
-// readAll reads all the files and returns the contents as stateChanges
-func (m *Manager) readAll() (*StateChanges, error) {
+// ChangedSince returns the sorted paths relative to the root dir of files(not hidden) modified after t
+// only modification times are compared, contents are not read eg: for a quick check in watch setups
+func (m *Manager) ChangedSince(t time.Time) ([]string, error) {
 	r, err := m.GetRuntime()
 	if err != nil {
 		return nil, err
 	}
 
-	sc := &StateChanges{
-		Changes:     make(map[string]string),
-		BinaryFiles: make(map[string]string),
-	}
-
-	err = filepath.Walk(m.rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	changed := []string{}
+	err = m.walk(r.Name, func(path string, info os.FileInfo) error {
+		if !info.ModTime().After(t) {
+			return nil
 		}
-		path, err = filepath.Rel(m.rootDir, path)
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
 		if err != nil {
 			return err
 		}
+		changed = append(changed, slash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
 
-		shouldSkip, err := m.shouldSkip(path, r.Name)
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			if shouldSkip {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if shouldSkip {
-			return nil
-		}
+// ProjectChecksum returns a single sha256 digest of all files(not hidden) in the root program directory
+// the digest is computed from the relative paths and checksums of the files in sorted order
+// so it is stable across runs and machines
+func (m *Manager) ProjectChecksum() (string, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return "", err
+	}
 
-		contents, isBinary, err := m.readFileIsBinary(filepath.Join(m.rootDir, path))
+	var paths []string
+	err = m.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
 		if err != nil {
 			return err
 		}
-
-		if isBinary {
-			sc.BinaryFiles[filepath.ToSlash(path)] = base64.StdEncoding.EncodeToString(contents)
-		} else {
-			sc.Changes[filepath.ToSlash(path)] = string(contents)
-		}
+		paths = append(paths, slash)
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return sc, nil
+	sort.Strings(paths)
+
+	hash := sha256.New()
+	m.writeSalt(hash)
+	for _, p := range paths {
+		checksum, err := m.calcChecksum(filepath.Join(m.rootDir, filepath.FromSlash(p)))
+		if err != nil {
+			return "", err
+		}
+		// null separated so path and checksum boundaries are unambiguous
+		fmt.Fprintf(hash, "%s\x00%s\x00", p, checksum)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-// GetChanges checks if the state has changed in the root directory
-func (m *Manager) GetChanges() (*StateChanges, error) {
+// CopyTo copies all files(not hidden) in the root program directory to dest
+// preserving their paths relative to the root dir
+func (m *Manager) CopyTo(dest string) error {
 	r, err := m.GetRuntime()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	sc := &StateChanges{
-		Changes:     make(map[string]string),
-		BinaryFiles: make(map[string]string),
+	absRoot, err := filepath.Abs(m.rootDir)
+	if err != nil {
+		return err
 	}
-
-	storedState, err := m.getStoredState()
+	absDest, err := filepath.Abs(dest)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return m.readAll()
-		}
-		return nil, err
+		return err
+	}
+	if absDest == absRoot || strings.HasPrefix(absDest, absRoot+string(os.PathSeparator)) {
+		return fmt.Errorf("destination '%s' is inside the root dir", dest)
 	}
 
-	// mark all paths in current state as deleted
-	// if seen later on walk, remove from deletions
-	deletions := make(map[string]struct{}, len(storedState))
-	for k := range storedState {
-		deletions[k] = struct{}{}
+	return m.walk(r.Name, func(path string, info os.FileInfo) error {
+		return m.copyFile(filepath.Join(m.rootDir, path), filepath.Join(dest, path), info.Mode())
+	})
+}
+
+// ArchiveTo writes all files(not hidden) in the root program directory to w as a gzip compressed tar
+// entries are named by paths relative to the root dir and keep the file modes
+// files are streamed to w one by one without buffering the archive in memory, with the content transform applied if set
+func (m *Manager) ArchiveTo(w io.Writer) error {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return err
 	}
 
-	err = filepath.Walk(m.rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err = m.walk(r.Name, func(path string, info os.FileInfo) error {
+		if !info.Mode().IsRegular() {
+			return nil
 		}
-		path, err = filepath.Rel(m.rootDir, path)
+		hdr, err := tar.FileInfoHeader(info, "")
 		if err != nil {
 			return err
 		}
-		shouldSkip, err := m.shouldSkip(path, r.Name)
+		hdr.Name, err = m.relPath(filepath.Join(m.rootDir, path))
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			if shouldSkip {
-				return filepath.SkipDir
+
+		if m.transform != nil {
+			contents, err := m.readProgFile(filepath.Join(m.rootDir, path))
+			if err != nil {
+				return err
 			}
-			return nil
-		}
-		if shouldSkip {
-			return nil
+			hdr.Size = int64(len(contents))
+			err = tw.WriteHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(contents)
+			return err
 		}
 
-		// update deletions
-		if _, ok := deletions[filepath.ToSlash(path)]; ok {
-			delete(deletions, filepath.ToSlash(path))
+		f, err := m.fs.Open(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
 		}
+		defer f.Close()
 
-		checksum, err := m.calcChecksum(filepath.Join(m.rootDir, path))
+		err = tw.WriteHeader(hdr)
 		if err != nil {
 			return err
 		}
-
-		if storedState[filepath.ToSlash(path)] != checksum {
-			contents, isBinary, err := m.readFileIsBinary(filepath.Join(m.rootDir, path))
-			if err != nil {
-				return err
-			}
-			if isBinary {
-				sc.BinaryFiles[filepath.ToSlash(path)] = base64.StdEncoding.EncodeToString(contents)
-			} else {
-				sc.Changes[filepath.ToSlash(path)] = string(contents)
-			}
+		_, err = io.Copy(tw, f)
+		if err != nil {
+			return fmt.Errorf("archiving %s: %w", path, err)
 		}
 		return nil
 	})
-
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	sc.Deletions = make([]string, len(deletions))
-	i := 0
-	for k := range deletions {
-		sc.Deletions[i] = k
-		i++
+	err = tw.Close()
+	if err != nil {
+		return err
 	}
+	return gw.Close()
+}
 
-	if len(sc.Changes) == 0 && len(sc.Deletions) == 0 && len(sc.BinaryFiles) == 0 {
-		return nil, nil
+type pkgJSON struct {
+	Name       string            `json:"name"`
+	Deps       map[string]string `json:"dependencies"`
+	DevDeps    map[string]string `json:"devDependencies"`
+	PeerDeps   map[string]string `json:"peerDependencies"`
+	Workspaces json.RawMessage   `json:"workspaces"`
+}
+
+// ReadDeps reads the deps of runtime from the dependency files in the root dir
+// runtime is the name of a supported runtime eg: python, node
+func (m *Manager) ReadDeps(runtime string) ([]string, error) {
+	if _, ok := runtimes[runtime]; !ok {
+		return nil, fmt.Errorf("unsupported runtime '%s'", runtime)
 	}
-	return sc, nil
+	return m.readDeps(runtime)
 }
 
-type pkgJSON struct {
-	Deps map[string]string `json:"dependencies"`
+// ReadDepsGrouped reads the deps of runtime from the dependency files in the root dir by the group of the deps
+// eg: dependencies, devDependencies and peerDependencies of package.json, dependencies and the optional dependencies of pyproject.toml
+// deps of dependency files without groups are in the dependencies group, all groups are read regardless of SetIncludeDevDeps
+func (m *Manager) ReadDepsGrouped(runtime string) (map[string][]string, error) {
+	if _, ok := runtimes[runtime]; !ok {
+		return nil, fmt.Errorf("unsupported runtime '%s'", runtime)
+	}
+	pd, err := m.readProgDeps(runtime)
+	if err != nil {
+		return nil, err
+	}
+	if pd.groups != nil {
+		return pd.groups, nil
+	}
+	groups := make(map[string][]string)
+	if len(pd.deps) > 0 {
+		groups[defaultDepGroup] = pd.deps
+	}
+	return groups, nil
 }
 
 // readDeps from the dependecy files based on runtime
 func (m *Manager) readDeps(runtime string) ([]string, error) {
+	pd, err := m.readProgDeps(runtime)
+	if err != nil {
+		return nil, err
+	}
+	return pd.deps, nil
+}
+
+// readProgDeps reads deps and deps that can not be installed from the dependency files based on runtime
+func (m *Manager) readProgDeps(runtime string) (*progDeps, error) {
+	return depReader{Manager: m}.readProgDeps(runtime)
+}
+
+// readProgDeps reads deps like Manager.readProgDeps, dependency files in scanned are not read again
+func (m depReader) readProgDeps(runtime string) (*progDeps, error) {
+	// deps of the custom runtime are installed by its Dockerfile
+	if runtime == Custom {
+		return &progDeps{}, nil
+	}
 	depFile, ok := depFiles[runtime]
 	if !ok {
 		return nil, fmt.Errorf("unsupported runtime '%s'", runtime)
 	}
-	contents, err := m.readFile(filepath.Join(m.rootDir, depFile))
+	if runtime == DotNet {
+		depFile, err := m.csprojFile()
+		if err != nil || depFile == "" {
+			return &progDeps{}, err
+		}
+		contents, err := m.readDepFile(depFile)
+		if err != nil {
+			return nil, err
+		}
+		if isBlank(contents) {
+			return &progDeps{}, nil
+		}
+		deps, err := parseCsproj(contents)
+		if err != nil {
+			return nil, invalidDepFile(depFile, contents, err)
+		}
+		return &progDeps{deps: deps}, nil
+	}
+	if runtime == Python && m.preferPipfile {
+		deps, err := m.readPipfileDeps()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			return &progDeps{deps: deps}, nil
+		}
+	}
+	contents, err := m.readDepFile(depFile)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, nil
+			if runtime == Python {
+				return m.readAltPythonDeps()
+			}
+			return &progDeps{}, nil
 		}
 		return nil, err
 	}
+	// an empty dependency file has no deps, even if it is not valid eg: an empty package.json
+	if isBlank(contents) {
+		m.debugf("%s is empty", depFile)
+		return &progDeps{}, nil
+	}
 	switch runtime {
 	case Python:
-		var deps []string
-
-		lines, err := readLines(contents)
+		return m.readRequirements(depFile, contents)
+	case Node:
+		var pj pkgJSON
+		err = json.Unmarshal(contents, &pj)
+		if err != nil {
+			return nil, invalidDepFile(depFile, contents, err)
+		}
+		err = m.mergeWorkspaceDeps(&pj)
 		if err != nil {
 			return nil, err
 		}
-
-		for _, l := range lines {
-			l = strings.ReplaceAll(l, " ", "")
-			// skip empty lines and commentes #
-			if l != "" && !strings.HasPrefix(l, "#") {
-				deps = append(deps, l)
+		if len(pj.Deps) == 0 && len(pj.DevDeps) == 0 && len(pj.PeerDeps) == 0 {
+			return &progDeps{}, nil
+		}
+		resolved, err := m.readYarnLock()
+		if err != nil {
+			return nil, err
+		}
+		nodeDeps := func(deps map[string]string) []string {
+			var nd []string
+			for _, k := range sortedKeys(deps) {
+				v := deps[k]
+				// pin to the exact version resolved by yarn
+				if version, ok := resolved[k+"@"+v]; ok {
+					v = version
+				}
+				nd = append(nd, fmt.Sprintf("%s@%s", k, v))
 			}
+			return nd
 		}
-		return deps, nil
-	case Node:
-		var nodeDeps []string
-		var pj pkgJSON
-		err = json.Unmarshal(contents, &pj)
+		pd := &progDeps{groups: make(map[string][]string)}
+		for group, deps := range map[string]map[string]string{
+			defaultDepGroup:    pj.Deps,
+			"devDependencies":  pj.DevDeps,
+			"peerDependencies": pj.PeerDeps,
+		} {
+			if len(deps) > 0 {
+				pd.groups[group] = nodeDeps(deps)
+			}
+		}
+		pd.deps = pd.groups[defaultDepGroup]
+		if m.includeDevDeps {
+			pd.deps = append(pd.deps, pd.groups["devDependencies"]...)
+		}
+		return pd, nil
+	case Java:
+		deps, err := parsePomXML(contents)
+		if err != nil {
+			return nil, invalidDepFile(depFile, contents, err)
+		}
+		return &progDeps{deps: deps}, nil
+	case Ruby:
+		lines, err := readLines(contents)
 		if err != nil {
 			return nil, err
 		}
-		if len(pj.Deps) == 0 {
-			return nil, nil
+		return &progDeps{deps: parseGemfile(lines)}, nil
+	case PHP:
+		deps, err := parseComposerJSON(contents, m.includeDevDeps)
+		if err != nil {
+			return nil, invalidDepFile(depFile, contents, err)
 		}
-		for k, v := range pj.Deps {
-			nodeDeps = append(nodeDeps, fmt.Sprintf("%s@%s", k, v))
+		return &progDeps{deps: deps}, nil
+	case Elixir:
+		return &progDeps{deps: parseMixExs(string(contents))}, nil
+	case Rust:
+		tables, err := parseTOML(contents)
+		if err != nil {
+			return nil, invalidDepFile(depFile, contents, err)
 		}
-		return nodeDeps, nil
+		return parseCargoDeps(tables), nil
+	case Scala:
+		return &progDeps{deps: parseBuildSbt(string(contents), m.includeDevDeps)}, nil
 	default:
 		return nil, fmt.Errorf("unsupported runtime '%s'", runtime)
 	}
@@ -699,6 +2843,11 @@ func (m *Manager) readDeps(runtime string) ([]string, error) {
 
 // GetDepChanges gets dependencies from program
 func (m *Manager) GetDepChanges() (*DepChanges, error) {
+	return m.getDepChanges(depReader{Manager: m})
+}
+
+// gets the dependency changes reading the dependency files with r
+func (m *Manager) getDepChanges(r depReader) (*DepChanges, error) {
 	progInfo, err := m.GetProgInfo()
 	if progInfo == nil || err != nil {
 		return nil, fmt.Errorf("no program information found")
@@ -712,49 +2861,47 @@ func (m *Manager) GetDepChanges() (*DepChanges, error) {
 		progInfo.RuntimeName = rtime.Name
 		progInfo.Runtime = rtime.Version
 	}
-	deps, err := m.readDeps(progInfo.RuntimeName)
+	pd, err := r.readProgDeps(progInfo.RuntimeName)
 	if err != nil {
 		return nil, err
 	}
+	deps := pd.deps
 
-	// no previous deps so return all new local deps as added
-	if len(progInfo.Deps) == 0 {
-		if len(deps) == 0 {
-			return nil, nil
+	var unpinned []string
+	if progInfo.RuntimeName == Python && m.pinCheck != PinCheckOff {
+		unpinned = unpinnedDeps(deps)
+		if len(unpinned) > 0 && m.pinCheck == PinCheckStrict {
+			return nil, fmt.Errorf("%w: %s", ErrUnpinnedDeps, strings.Join(unpinned, ", "))
 		}
-		return &DepChanges{
-			Added: deps,
-		}, nil
 	}
 
-	var dc DepChanges
-
-	// mark all stored deps as removed deps
-	// mark them as unremoved later if seen them in the deps file
-	removedDeps := make(map[string]struct{}, len(progInfo.Deps))
-	for _, d := range progInfo.Deps {
-		removedDeps[d] = struct{}{}
+	dc := DiffDeps(progInfo.Deps, deps)
+	dc.Editable = pd.editable
+	dc.LocalPaths = pd.localPaths
+	dc.Unpinned = unpinned
+	if progInfo.RuntimeName == Python {
+		dc.RemoteDeps = remoteDeps(deps)
 	}
-
-	for _, d := range deps {
-		if _, ok := removedDeps[d]; ok {
-			// remove from deleted if seen
-			delete(removedDeps, d)
-		} else {
-			// add as new dep if not seen
-			dc.Added = append(dc.Added, d)
-		}
+	dc.IgnoredDepFiles, err = m.ignoredDepFiles(progInfo.RuntimeName)
+	if err != nil {
+		return nil, err
 	}
-
-	for d := range removedDeps {
-		dc.Removed = append(dc.Removed, d)
+	for _, name := range dc.IgnoredDepFiles {
+		m.warn("%s is ignored, it is not a dependency file of the %s runtime", name, progInfo.RuntimeName)
+	}
+	if len(progInfo.Deps) > 0 {
+		exists, err := m.depFileExists(progInfo.RuntimeName)
+		if err != nil {
+			return nil, err
+		}
+		dc.DepFileRemoved = !exists
 	}
 
-	if len(dc.Added) == 0 && len(dc.Removed) == 0 {
+	if dc.IsEmpty() {
 		return nil, nil
 	}
 
-	return &dc, nil
+	return dc, nil
 }
 
 // readEnvs read env variables from the env file
@@ -766,31 +2913,19 @@ func (m *Manager) readEnvs(envFile string) (map[string]string, error) {
 	if len(contents) == 0 {
 		return nil, nil
 	}
-	envs := make(map[string]string)
-
 	lines, err := readLines(contents)
 	if err != nil {
 		return nil, err
 	}
-
-	for n, l := range lines {
-		// skip empty lines and commentes #
-		if l != "" && !strings.HasPrefix(l, "#") {
-			sepIndex := strings.Index(l, "=")
-			// expect format KEY=VALUE
-			if sepIndex <= 0 {
-				return nil, fmt.Errorf("unexpected format in line %d, expected KEY=VALUE", n+1)
-			}
-			key := l[0:sepIndex]
-			value := l[sepIndex+1:]
-			envs[key] = strings.Trim(value, "\"")
-		}
-	}
-	return envs, nil
+	return parseEnvFile(lines)
 }
 
 // GetEnvChanges gets changes in stored env keys and keys of the envFile
+// the .env file in the root dir is used if envFile is empty
 func (m *Manager) GetEnvChanges(envFile string) (*EnvChanges, error) {
+	if envFile == "" {
+		envFile = defaultEnvFile
+	}
 	vars, err := m.readEnvs(envFile)
 	if err != nil {
 		return nil, err
@@ -799,13 +2934,15 @@ func (m *Manager) GetEnvChanges(envFile string) (*EnvChanges, error) {
 	progInfo, err := m.GetProgInfo()
 	if progInfo == nil {
 		return &EnvChanges{
-			Vars: vars,
+			Vars:  vars,
+			Added: sortedKeys(vars),
 		}, nil
 	}
 
-	if len(progInfo.Envs) == 0 {
+	if len(progInfo.Envs) == 0 && len(progInfo.Env) == 0 {
 		return &EnvChanges{
-			Vars: vars,
+			Vars:  vars,
+			Added: sortedKeys(vars),
 		}, nil
 	}
 
@@ -819,11 +2956,21 @@ func (m *Manager) GetEnvChanges(envFile string) (*EnvChanges, error) {
 	for _, e := range progInfo.Envs {
 		removedEnvs[e] = struct{}{}
 	}
+	for e := range progInfo.Env {
+		removedEnvs[e] = struct{}{}
+	}
 
-	for k, v := range vars {
+	for _, k := range sortedKeys(vars) {
+		v := vars[k]
 		if _, ok := removedEnvs[k]; ok {
 			// delete from removed if seen
 			delete(removedEnvs, k)
+			// only compare values if a checksum was stored
+			if hash, ok := progInfo.Env[k]; ok && hash != HashEnvValue(v) {
+				ec.Changed = append(ec.Changed, k)
+			}
+		} else {
+			ec.Added = append(ec.Added, k)
 		}
 		ec.Vars[k] = v
 	}
@@ -831,6 +2978,7 @@ func (m *Manager) GetEnvChanges(envFile string) (*EnvChanges, error) {
 	for e := range removedEnvs {
 		ec.Removed = append(ec.Removed, e)
 	}
+	sort.Strings(ec.Removed)
 
 	if len(ec.Vars) == 0 && len(ec.Removed) == 0 {
 		return nil, nil
@@ -847,7 +2995,7 @@ func (m *Manager) WriteProgramFiles(zipFile []byte, targetDir *string, relative
 		// use root dir as dir to store if targetDir is not provided
 		if targetDir != nil && *targetDir != writeDir {
 			writeDir = filepath.Join(m.rootDir, *targetDir)
-			err := os.MkdirAll(writeDir, dirPermMode)
+			err := m.fs.MkdirAll(writeDir, dirPermMode)
 			if err != nil {
 				return err
 			}
@@ -865,12 +3013,12 @@ func (m *Manager) WriteProgramFiles(zipFile []byte, targetDir *string, relative
 	}
 
 	// unzip zip file into wrtie dir skipping lib entry file for runtime
-	return unzip(zipFile, writeDir, libEntryFiles[runtime.Name])
+	return unzip(m.fs, zipFile, writeDir, libEntryFiles[runtime.Name])
 }
 
 // Clean removes `.deta` folder created by the runtime manager if it's empty
 func (m *Manager) Clean() error {
-	isEmpty, err := isDirEmpty(m.detaPath)
+	isEmpty, err := m.isDirEmpty(m.detaPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil
@@ -879,7 +3027,7 @@ func (m *Manager) Clean() error {
 	}
 	// only delete `m.detaPath` if it's empty
 	if isEmpty {
-		return os.RemoveAll(m.detaPath)
+		return m.fs.RemoveAll(m.detaPath)
 	}
 	return nil
 }
@@ -0,0 +1,1722 @@
+package runtime
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// writes files to a program dir under testdata/tmp and returns a manager for it
+func newTestManager(t testing.TB, files map[string]string) *Manager {
+	tmpDir := filepath.Join("testdata", "tmp")
+	err := os.MkdirAll(tmpDir, dirPermMode)
+	if err != nil {
+		t.Fatalf("failed to create dir %s: %v", tmpDir, err)
+	}
+	rootDir, err := ioutil.TempDir(tmpDir, "prog")
+	if err != nil {
+		t.Fatalf("failed to create program dir: %v", err)
+	}
+	writeTestFiles(t, rootDir, files)
+
+	m, err := NewManager(&rootDir, true)
+	if err != nil {
+		t.Fatalf("failed to create manager for %s: %v", rootDir, err)
+	}
+	return m
+}
+
+// writes files relative to dir
+func writeTestFiles(t testing.TB, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), dirPermMode)
+		if err != nil {
+			t.Fatalf("failed to create dir for %s: %v", path, err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), filePermMode)
+		if err != nil {
+			t.Fatalf("failed to write file %s: %v", path, err)
+		}
+	}
+}
+
+// returns sorted paths of all files in state changes
+func changedPaths(sc *StateChanges) []string {
+	var paths []string
+	if sc == nil {
+		return paths
+	}
+	for p := range sc.Changes {
+		paths = append(paths, p)
+	}
+	for p := range sc.BinaryFiles {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestIncludeHidden(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		".env.example":     "KEY=VALUE",
+		".dockerignore":    "*.pyc",
+		".secret":          "secret",
+		".git/config":      "[core]",
+		".github/ci.yml":   "on: push",
+		"lib/.hidden.json": "{}",
+	})
+	m.SetIncludeHidden([]string{".env.example", ".docker*", ".deta"})
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{
+		".dockerignore",
+		".env.example",
+		"main.py",
+	})
+}
+
+func TestGetEnvChanges(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py": "print('hello')",
+		".env":    "# comment\nKEPT=same\nCHANGED=\"new\"\nADDED=value\n",
+	})
+	err := m.StoreProgInfo(&ProgInfo{
+		Runtime: "python3.9",
+		Envs:    []string{"KEPT", "CHANGED", "REMOVED"},
+		Env: map[string]string{
+			"KEPT":    HashEnvValue("same"),
+			"CHANGED": HashEnvValue("old"),
+			"REMOVED": HashEnvValue("gone"),
+		},
+	})
+	assert.NilError(t, err)
+
+	ec, err := m.GetEnvChanges("")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, ec.Added, []string{"ADDED"})
+	assert.DeepEqual(t, ec.Changed, []string{"CHANGED"})
+	assert.DeepEqual(t, ec.Removed, []string{"REMOVED"})
+	assert.Equal(t, ec.Vars["CHANGED"], "new")
+}
+
+func TestProjectChecksum(t *testing.T) {
+	files := map[string]string{
+		"main.py":        "print('hello')",
+		"lib/utils.py":   "def f(): pass",
+		"lib/data.json":  "{}",
+		"static/a.txt":   "a",
+		".hidden/ignore": "not tracked",
+	}
+	m := newTestManager(t, files)
+
+	checksum, err := m.ProjectChecksum()
+	assert.NilError(t, err)
+
+	again, err := m.ProjectChecksum()
+	assert.NilError(t, err)
+	assert.Equal(t, checksum, again)
+
+	// same files written in a different dir give the same digest
+	other := newTestManager(t, nil)
+	writeTestFiles(t, other.rootDir, files)
+	otherChecksum, err := other.ProjectChecksum()
+	assert.NilError(t, err)
+	assert.Equal(t, checksum, otherChecksum)
+
+	// hidden files do not change the digest
+	writeTestFiles(t, m.rootDir, map[string]string{".hidden/ignore": "changed"})
+	hiddenChecksum, err := m.ProjectChecksum()
+	assert.NilError(t, err)
+	assert.Equal(t, checksum, hiddenChecksum)
+
+	for name := range files {
+		if name == ".hidden/ignore" {
+			continue
+		}
+		writeTestFiles(t, m.rootDir, map[string]string{name: files[name] + "edited"})
+		edited, err := m.ProjectChecksum()
+		assert.NilError(t, err)
+		assert.Assert(t, edited != checksum, "editing %s did not change the checksum", name)
+		writeTestFiles(t, m.rootDir, map[string]string{name: files[name]})
+	}
+}
+
+func TestReadAllNoFiles(t *testing.T) {
+	// empty dir with a stored runtime
+	m := newTestManager(t, nil)
+	err := m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"})
+	assert.NilError(t, err)
+	_, err = m.readAll()
+	assert.Assert(t, errors.Is(err, ErrNoFiles))
+
+	// entrypoint only
+	m = newTestManager(t, map[string]string{"main.py": ""})
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"main.py"})
+}
+
+func TestCopyTo(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":              "print('hello')",
+		"lib/utils.py":         "def f(): pass",
+		"lib/__pycache__/x.py": "cached",
+		".git/config":          "[core]",
+		".detaignore":          "secret.txt",
+		"secret.txt":           "secret",
+	})
+	// write prog info so .deta is not empty
+	err := m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"})
+	assert.NilError(t, err)
+
+	dest := filepath.Join("testdata", "tmp", "copy-dest")
+	assert.NilError(t, os.RemoveAll(dest))
+	assert.NilError(t, m.CopyTo(dest))
+
+	var copied []string
+	err = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dest, path)
+		if err != nil {
+			return err
+		}
+		copied = append(copied, filepath.ToSlash(rel))
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, copied, []string{".detaignore", "lib/utils.py", "main.py"})
+
+	contents, err := ioutil.ReadFile(filepath.Join(dest, "lib", "utils.py"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), "def f(): pass")
+
+	assert.Assert(t, m.CopyTo(filepath.Join(m.rootDir, "out")) != nil)
+}
+
+func TestWithDetaPath(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": "print('hello')"})
+
+	stateBase := filepath.Join("testdata", "tmp", "state")
+	detaPath, err := ExternalDetaPath(stateBase, m.rootDir)
+	assert.NilError(t, err)
+
+	m, err = NewManager(&m.rootDir, true, WithDetaPath(detaPath))
+	assert.NilError(t, err)
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	assert.NilError(t, m.StoreState())
+
+	for _, f := range []string{progInfoFile, stateFile} {
+		_, err = os.Stat(filepath.Join(detaPath, f))
+		assert.NilError(t, err)
+		_, err = os.Stat(filepath.Join(m.rootDir, detaDir, f))
+		assert.Assert(t, os.IsNotExist(err))
+	}
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+}
+
+func TestUpdateState(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"old.txt":      "old",
+		"data.bin":     "\x00\x01\x02",
+	})
+	assert.NilError(t, m.StoreState())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":  "print('updated')",
+		"new.txt":  "new",
+		"data.bin": "\x00\x01\x03",
+	})
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "old.txt")))
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.NilError(t, m.UpdateState(sc))
+
+	updated, err := m.getStoredState()
+	assert.NilError(t, err)
+	assert.NilError(t, m.StoreState())
+	stored, err := m.getStoredState()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, updated, stored)
+
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+}
+
+// writes a program with n files and stores its state with one modified file
+func setupStateBenchmark(b *testing.B, n int) (*Manager, *StateChanges) {
+	files := map[string]string{"main.py": "print('hello')"}
+	for i := 0; i < n; i++ {
+		files[filepath.Join("lib", fmt.Sprintf("file_%d.py", i))] = strings.Repeat("x = 1\n", 1000)
+	}
+	m := newTestManager(b, files)
+	if err := m.StoreState(); err != nil {
+		b.Fatal(err)
+	}
+	writeTestFiles(b, m.rootDir, map[string]string{"main.py": "print('updated')"})
+	sc, err := m.GetChanges()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return m, sc
+}
+
+func BenchmarkStoreState(b *testing.B) {
+	m, _ := setupStateBenchmark(b, 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := m.StoreState(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateState(b *testing.B) {
+	m, sc := setupStateBenchmark(b, 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := m.UpdateState(sc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	files := map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	}
+	m := newTestManager(t, files)
+	writeTestFiles(t, m.rootDir, map[string]string{".git/config": "[core]"})
+
+	seen := make(map[string]string)
+	var readers []io.Reader
+	err := m.WalkFiles(func(relPath string, r io.Reader) error {
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		seen[relPath] = string(contents)
+		readers = append(readers, r)
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, seen, files)
+
+	// readers are closed after the callback returns
+	for _, r := range readers {
+		_, err := r.Read(make([]byte, 1))
+		assert.Assert(t, errors.Is(err, os.ErrClosed))
+	}
+}
+
+func TestWalkFiltered(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":        "print('hello')",
+		"lib/utils.py":   "def f(): pass",
+		"lib/data.json":  "{}",
+		"README.md":      "# micro",
+		".venv/site.py":  "",
+		"notes/draft.py": "",
+		ignoreFile:       "notes",
+	})
+
+	var seen []string
+	err := m.WalkFiltered(func(relPath string, info os.FileInfo) bool {
+		return strings.HasSuffix(relPath, ".py") && !info.IsDir()
+	}, func(relPath string) error {
+		seen = append(seen, relPath)
+		return nil
+	})
+	assert.NilError(t, err)
+	// hidden and ignored files are still skipped
+	assert.DeepEqual(t, seen, []string{"lib/utils.py", "main.py"})
+
+	errStop := errors.New("stop")
+	err = m.WalkFiltered(func(string, os.FileInfo) bool { return true }, func(string) error { return errStop })
+	assert.Assert(t, errors.Is(err, errStop))
+}
+
+func TestGetRuntimeConflicts(t *testing.T) {
+	testCases := []struct {
+		files   map[string]string
+		runtime string
+		err     error
+	}{
+		{map[string]string{"main.py": ""}, Python, nil},
+		{map[string]string{"index.js": ""}, Node, nil},
+		{map[string]string{"main.py": "", "examples/node/index.js": ""}, Python, nil},
+		{map[string]string{"index.js": "", "samples/main.py": "", "samples/index.js": ""}, Node, nil},
+		{map[string]string{"main.py": "", "index.js": ""}, "", ErrEntrypointConflict},
+		{map[string]string{"lib/main.py": ""}, "", ErrNoEntrypoint},
+	}
+	for _, tc := range testCases {
+		m := newTestManager(t, tc.files)
+		r, err := m.GetRuntime()
+		if tc.err != nil {
+			assert.Assert(t, errors.Is(err, tc.err), "files %v: %v", tc.files, err)
+			continue
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, r.Name, tc.runtime)
+	}
+}
+
+func TestGetRuntimeCached(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"index.js":     "",
+		"package.json": `{"main": "index.js"}`,
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Name: "micro"}))
+	fs := &countFS{FileSystem: osFS{}}
+	m.fs = fs
+
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Node)
+	assert.Assert(t, fs.count() > 0)
+
+	// detected runtime is stored in prog info
+	p, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, p.Runtime, GetDefaultRuntimeVersion(Node))
+	assert.Equal(t, p.Name, "micro")
+
+	// a new manager does not detect the runtime again
+	m, err = NewManager(&m.rootDir, false)
+	assert.NilError(t, err)
+	fs = &countFS{FileSystem: osFS{}}
+	m.fs = fs
+	r, err = m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Node)
+	assert.Equal(t, fs.count(), 1) // prog info only
+
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "index.js")))
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "package.json")))
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": ""})
+	r, err = m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Node)
+
+	r, err = m.ForceDetectRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Python)
+	p, err = m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, p.Runtime, GetDefaultRuntimeVersion(Python))
+	assert.Equal(t, p.Name, "micro")
+}
+
+func TestForceDetectRuntimeKeepsVersion(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Name: "micro", Runtime: "python3.7", RuntimeName: Python}))
+
+	r, err := m.ForceDetectRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Python)
+	p, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, p.Runtime, "python3.7")
+
+	// a stored runtime is returned without reading the root dir
+	fs := &countFS{FileSystem: osFS{}}
+	m.fs = fs
+	r, err = m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Version, "python3.7")
+	assert.Equal(t, fs.count(), 1) // prog info only
+}
+
+func TestValidateRuntime(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	assert.NilError(t, m.ValidateRuntime())
+
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	assert.NilError(t, m.ValidateRuntime())
+
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "main.py")))
+	writeTestFiles(t, m.rootDir, map[string]string{"index.js": ""})
+	err := m.ValidateRuntime()
+	assert.Assert(t, errors.Is(err, ErrRuntimeMismatch))
+	assert.ErrorContains(t, err, "found node entrypoint but micro runtime is python3.9")
+
+	// entrypoints of several runtimes including the stored runtime
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": ""})
+	assert.NilError(t, m.ValidateRuntime())
+	assert.Equal(t, len(m.Warnings()), 0)
+
+	// a package.json main in a python program
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "index.js")))
+	writeTestFiles(t, m.rootDir, map[string]string{"package.json": `{"main": "tool.js"}`, "tool.js": ""})
+	assert.NilError(t, m.ValidateRuntime())
+
+	// ambiguous entrypoints of other runtimes are warned about
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "java11", RuntimeName: Java}))
+	assert.NilError(t, m.ValidateRuntime())
+	assert.DeepEqual(t, m.Warnings(), []string{"found entrypoints of the node, python runtimes but micro runtime is java11"})
+}
+
+func TestSupportedRuntimes(t *testing.T) {
+	infos := SupportedRuntimes()
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+		_, ok := runtimes[info.Name]
+		assert.Assert(t, ok, info.Name)
+		assert.Equal(t, info.DepFile, depFiles[info.Name])
+		if info.Name != Custom {
+			assert.DeepEqual(t, info.Entrypoints, entryPoints[info.Name])
+		}
+	}
+	assert.DeepEqual(t, names, []string{Custom, DotNet, Elixir, Java, Node, PHP, Python, Ruby, Rust, Scala})
+	assert.Equal(t, len(infos), len(runtimes))
+	assert.DeepEqual(t, infos[0], RuntimeInfo{Name: Custom, Entrypoints: []string{"Dockerfile"}})
+	assert.DeepEqual(t, infos[6], RuntimeInfo{Name: Python, Entrypoints: []string{"main.py", "__main__.py"}, DepFile: "requirements.txt"})
+
+	// the registered entrypoints are not modified through the returned infos
+	infos[6].Entrypoints[0] = "app.py"
+	assert.Equal(t, entryPoints[Python][0], "main.py")
+}
+
+func TestStateChangesSizes(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":  "print('hello')",
+		"data.bin": "\x00\x01\x02\x03",
+	})
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Sizes, map[string]int64{"main.py": 14, "data.bin": 4})
+
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "print('hello world')"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Sizes, map[string]int64{"main.py": 20})
+}
+
+func TestHasChanges(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"a.py":    "a",
+		"b.py":    "b",
+		"c.py":    "c",
+		"main.py": "print('hello')",
+	})
+	changed, err := m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+
+	assert.NilError(t, m.StoreState())
+	changed, err = m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+
+	// stops at the first modified file
+	writeTestFiles(t, m.rootDir, map[string]string{"a.py": "edited"})
+	l := &testLogger{}
+	m.SetLogger(l)
+	changed, err = m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	var hashed int
+	for _, e := range l.debug {
+		if strings.HasPrefix(e, "hashing") {
+			hashed++
+		}
+	}
+	assert.Equal(t, hashed, 1)
+	m.SetLogger(nil)
+
+	// new file
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{"d.py": "d"})
+	changed, err = m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+
+	// deleted file
+	assert.NilError(t, m.StoreState())
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "c.py")))
+	changed, err = m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+}
+
+func TestReadErrorsContainPath(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	missing := filepath.Join(m.rootDir, "missing.py")
+
+	_, err := m.readFile(missing)
+	assert.ErrorContains(t, err, "reading "+missing)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	_, err = m.calcChecksum(missing)
+	assert.ErrorContains(t, err, missing)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	// a dir can not be read as a file
+	dir := filepath.Join(m.rootDir, "lib")
+	assert.NilError(t, os.MkdirAll(dir, dirPermMode))
+	_, err = m.readFile(dir)
+	assert.ErrorContains(t, err, "reading "+dir)
+}
+
+func TestPruneDeletions(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"a.py":         "a",
+		"lib/b.py":     "b",
+		"lib/utils.py": "def f(): pass",
+	})
+	assert.NilError(t, m.StoreState())
+	before, err := m.getStoredState()
+	assert.NilError(t, err)
+
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "a.py")))
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "lib", "b.py")))
+	// modified files keep their stored checksum
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "print('edited')"})
+
+	pruned, err := m.PruneDeletions()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, pruned, []string{"a.py", "lib/b.py"})
+
+	after, err := m.getStoredState()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, after, stateMap{
+		"main.py":      before["main.py"],
+		"lib/utils.py": before["lib/utils.py"],
+	})
+
+	pruned, err = m.PruneDeletions()
+	assert.NilError(t, err)
+	assert.Equal(t, len(pruned), 0)
+}
+
+func TestGetChangesMatching(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":        "print('hello')",
+		"api/users.py":   "users",
+		"api/v1/old.py":  "old",
+		"static/app.css": "body {}",
+	})
+	assert.NilError(t, m.StoreState())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":         "print('edited')",
+		"api/users.py":    "edited users",
+		"api/v1/items.py": "items",
+	})
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "api", "v1", "old.py")))
+
+	sc, err := m.GetChangesMatching("api/**")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"api/users.py", "api/v1/items.py"})
+	assert.DeepEqual(t, sc.Deletions, []string{"api/v1/old.py"})
+
+	sc, err = m.GetChangesMatching("static/**")
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// full change set is still available
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"api/users.py", "api/v1/items.py", "main.py"})
+}
+
+func TestCaseInsensitiveRename(t *testing.T) {
+	files := map[string]string{
+		"main.py":  "print('hello')",
+		"Utils.py": "def f(): pass",
+	}
+
+	// case sensitive, the rename is a new file and a deletion
+	m := newTestManager(t, files)
+	m.caseInsensitive = false
+	assert.NilError(t, m.StoreState())
+	assert.NilError(t, os.Rename(filepath.Join(m.rootDir, "Utils.py"), filepath.Join(m.rootDir, "utils.py")))
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"utils.py"})
+	assert.DeepEqual(t, sc.Deletions, []string{"Utils.py"})
+
+	// case insensitive, the rename is not a change
+	m = newTestManager(t, files)
+	m, err = NewManager(&m.rootDir, true, WithCaseInsensitive(true))
+	assert.NilError(t, err)
+	assert.NilError(t, m.StoreState())
+	assert.NilError(t, os.Rename(filepath.Join(m.rootDir, "Utils.py"), filepath.Join(m.rootDir, "utils.py")))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+	changed, err := m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+
+	// a changed file keeps the new path and replaces the old path in the state
+	writeTestFiles(t, m.rootDir, map[string]string{"utils.py": "def g(): pass"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"utils.py"})
+	assert.Equal(t, len(sc.Deletions), 0)
+	assert.NilError(t, m.UpdateState(sc))
+	stored, err := m.getStoredState()
+	assert.NilError(t, err)
+	_, ok := stored["Utils.py"]
+	assert.Assert(t, !ok)
+	assert.Assert(t, stored["utils.py"] != "")
+
+	// an always uploaded file replaces the old path in the state too
+	assert.NilError(t, m.UpdateState(&StateChanges{AlwaysUpload: []string{"Main.py"}}))
+	stored, err = m.getStoredState()
+	assert.NilError(t, err)
+	_, ok = stored["main.py"]
+	assert.Assert(t, !ok)
+	_, ok = stored["Main.py"]
+	assert.Assert(t, ok)
+}
+
+func TestArchiveTo(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":            "print('hello')",
+		"lib/utils.py":       "def f(): pass",
+		"data.bin":           "\x00\x01\x02",
+		".hidden":            "secret",
+		"__pycache__/a.pyc":  "cache",
+		"requirements.txt":   "requests==2.28.0",
+		"lib/__init__.py":    "",
+		"lib/nested/run.txt": "run",
+	})
+	assert.NilError(t, os.Chmod(filepath.Join(m.rootDir, "lib", "nested", "run.txt"), 0750))
+
+	var buf bytes.Buffer
+	assert.NilError(t, m.ArchiveTo(&buf))
+
+	gr, err := gzip.NewReader(&buf)
+	assert.NilError(t, err)
+	tr := tar.NewReader(gr)
+	entries := make(map[string]string)
+	modes := make(map[string]os.FileMode)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		contents, err := ioutil.ReadAll(tr)
+		assert.NilError(t, err)
+		entries[hdr.Name] = string(contents)
+		modes[hdr.Name] = os.FileMode(hdr.Mode).Perm()
+	}
+
+	assert.DeepEqual(t, entries, map[string]string{
+		"main.py":            "print('hello')",
+		"lib/utils.py":       "def f(): pass",
+		"data.bin":           "\x00\x01\x02",
+		"requirements.txt":   "requests==2.28.0",
+		"lib/__init__.py":    "",
+		"lib/nested/run.txt": "run",
+	})
+	assert.Equal(t, modes["lib/nested/run.txt"], os.FileMode(0750))
+}
+
+func TestModeChanges(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":   "print('hello')",
+		"deploy.sh": "echo deploy",
+	})
+	m.SetTrackModes(true)
+	assert.NilError(t, m.StoreState())
+
+	script := filepath.Join(m.rootDir, "deploy.sh")
+	assert.NilError(t, os.Chmod(script, 0770))
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc != nil)
+	assert.DeepEqual(t, changedPaths(sc), []string(nil))
+	assert.DeepEqual(t, sc.ModeChanges, map[string]os.FileMode{"deploy.sh": 0770})
+	changed, err := m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+
+	assert.NilError(t, m.UpdateState(sc))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// modes are not reported if not tracked
+	assert.NilError(t, os.Chmod(script, 0660))
+	m.SetTrackModes(false)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+}
+
+func TestInitProject(t *testing.T) {
+	m := newTestManager(t, nil)
+	assert.NilError(t, m.InitProject(Python))
+	for _, f := range []string{"main.py", "requirements.txt"} {
+		_, err := os.Stat(filepath.Join(m.rootDir, f))
+		assert.NilError(t, err)
+	}
+	progInfo, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, progInfo.Runtime, GetDefaultRuntimeVersion(Python))
+	r, err := m.ForceDetectRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Python)
+
+	// existing dep file is kept
+	m = newTestManager(t, map[string]string{"package.json": `{"dependencies": {"express": "^4.17.1"}}`})
+	assert.NilError(t, m.InitProject("nodejs12.x"))
+	contents, err := ioutil.ReadFile(filepath.Join(m.rootDir, "package.json"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), `{"dependencies": {"express": "^4.17.1"}}`)
+	progInfo, err = m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, progInfo.Runtime, "nodejs12.x")
+	assert.Assert(t, errors.Is(m.InitProject(Node), ErrAlreadyInitialized))
+
+	// existing entrypoint is not overwritten
+	m = newTestManager(t, map[string]string{"main.py": "print('hello')"})
+	assert.Assert(t, errors.Is(m.InitProject(Python), os.ErrExist))
+	contents, err = ioutil.ReadFile(filepath.Join(m.rootDir, "main.py"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), "print('hello')")
+	initialized, err := m.IsInitialized()
+	assert.NilError(t, err)
+	assert.Assert(t, !initialized)
+
+	assert.ErrorContains(t, newTestManager(t, nil).InitProject("cobol"), "unsupported runtime")
+}
+
+func TestAlwaysUpload(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		"assets/app.bin":   strings.Repeat("\x00\x01", 64),
+		"assets/small.bin": "\x00",
+		"assets/logo.png":  "\x89PNG\x00",
+	})
+	m.SetAlwaysUpload([]string{"png"}, 100)
+	assert.NilError(t, m.StoreState())
+
+	// unchanged files over the threshold or with an always uploaded extension are changes
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.AlwaysUpload, []string{"assets/app.bin", "assets/logo.png"})
+	assert.DeepEqual(t, changedPaths(sc), []string{"assets/app.bin", "assets/logo.png"})
+	assert.Equal(t, sc.BinaryFiles["assets/app.bin"], base64.StdEncoding.EncodeToString([]byte(strings.Repeat("\x00\x01", 64))))
+	changed, err := m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+
+	// always uploaded files are not hashed
+	stored, err := m.getStoredState()
+	assert.NilError(t, err)
+	assert.Equal(t, stored["assets/app.bin"], "")
+	assert.Assert(t, stored["assets/small.bin"] != "")
+
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "assets", "app.bin")))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.AlwaysUpload, []string{"assets/logo.png"})
+	assert.DeepEqual(t, sc.Deletions, []string{"assets/app.bin"})
+}
+
+func TestStateChangesRelativePaths(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":              "print('hello')",
+		"lib/utils.py":         "def f(): pass",
+		"lib/nested/deep.py":   "x = 1",
+		"lib/nested/data.bin":  "\x00\x01",
+		"lib/nested/remove.py": "y = 2",
+	})
+	absRoot, err := filepath.Abs(m.rootDir)
+	assert.NilError(t, err)
+	m, err = NewManager(&absRoot, true)
+	assert.NilError(t, err)
+
+	assertRelative := func(sc *StateChanges) {
+		var paths []string
+		paths = append(paths, changedPaths(sc)...)
+		paths = append(paths, sc.Deletions...)
+		for p := range sc.Sizes {
+			paths = append(paths, p)
+		}
+		for _, p := range paths {
+			assert.Assert(t, !filepath.IsAbs(p) && !strings.HasPrefix(p, "/"), "absolute path %s", p)
+			assert.Assert(t, !strings.Contains(p, absRoot), "path %s contains root dir", p)
+			assert.Assert(t, !strings.Contains(p, "\\"), "path %s is not slash separated", p)
+		}
+	}
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assertRelative(sc)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/nested/data.bin", "lib/nested/deep.py", "lib/nested/remove.py", "lib/utils.py", "main.py"})
+
+	assert.NilError(t, m.StoreState())
+	stored, err := m.getStoredState()
+	assert.NilError(t, err)
+	for p := range stored {
+		assert.Assert(t, !filepath.IsAbs(p), "absolute path %s in stored state", p)
+	}
+
+	writeTestFiles(t, absRoot, map[string]string{"lib/nested/deep.py": "x = 2"})
+	assert.NilError(t, os.Remove(filepath.Join(absRoot, "lib", "nested", "remove.py")))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assertRelative(sc)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/nested/deep.py"})
+	assert.DeepEqual(t, sc.Deletions, []string{"lib/nested/remove.py"})
+}
+
+func TestDetaPathIsFile(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	assert.NilError(t, os.RemoveAll(m.detaPath))
+	assert.NilError(t, ioutil.WriteFile(m.detaPath, []byte("notes"), filePermMode))
+
+	for _, initDirs := range []bool{true, false} {
+		_, err := NewManager(&m.rootDir, initDirs)
+		assert.Assert(t, errors.Is(err, ErrDetaPathNotDir))
+		assert.ErrorContains(t, err, "is a file, rename or remove it")
+	}
+
+	// state can be stored elsewhere
+	external, err := ExternalDetaPath(filepath.Join("testdata", "tmp", "external"), m.rootDir)
+	assert.NilError(t, err)
+	_, err = NewManager(&m.rootDir, true, WithDetaPath(external))
+	assert.NilError(t, err)
+}
+
+func TestDeletionsSorted(t *testing.T) {
+	files := map[string]string{"main.py": "print('hello')"}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("lib/file_%02d.py", i)] = "x = 1"
+	}
+	m := newTestManager(t, files)
+	assert.NilError(t, m.StoreState())
+	assert.NilError(t, os.RemoveAll(filepath.Join(m.rootDir, "lib")))
+
+	var expected []string
+	for i := 0; i < 20; i++ {
+		expected = append(expected, fmt.Sprintf("lib/file_%02d.py", i))
+	}
+	for i := 0; i < 5; i++ {
+		sc, err := m.GetChanges()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, sc.Deletions, expected)
+	}
+}
+
+func TestPathAccessors(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	rootDir := m.rootDir
+	m, err := NewManager(&rootDir, true)
+	assert.NilError(t, err)
+	assert.Equal(t, m.RootDir(), rootDir)
+	assert.Equal(t, m.DetaPath(), filepath.Join(rootDir, ".deta"))
+	assert.Equal(t, m.ProgInfoPath(), filepath.Join(rootDir, ".deta", "prog_info"))
+	assert.Equal(t, m.StatePath(), filepath.Join(rootDir, ".deta", "state"))
+
+	external := filepath.Join("testdata", "tmp", "external-accessors")
+	m, err = NewManager(&rootDir, true, WithDetaPath(external))
+	assert.NilError(t, err)
+	assert.Equal(t, m.RootDir(), rootDir)
+	assert.Equal(t, m.DetaPath(), external)
+	assert.Equal(t, m.ProgInfoPath(), filepath.Join(external, "prog_info"))
+	assert.Equal(t, m.StatePath(), filepath.Join(external, "state"))
+}
+
+func TestEmptyDirs(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	m.SetTrackEmptyDirs(true)
+	assert.NilError(t, os.MkdirAll(filepath.Join(m.rootDir, "tmp"), dirPermMode))
+	assert.NilError(t, os.MkdirAll(filepath.Join(m.rootDir, "data", "cache"), dirPermMode))
+	assert.NilError(t, os.MkdirAll(filepath.Join(m.rootDir, ".hidden"), dirPermMode))
+
+	assert.NilError(t, m.StoreState())
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+	changed, err := m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+
+	// a created empty dir and a dir that is no longer empty
+	assert.NilError(t, os.MkdirAll(filepath.Join(m.rootDir, "uploads"), dirPermMode))
+	writeTestFiles(t, m.rootDir, map[string]string{"tmp/file.txt": "tmp"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.EmptyDirs, []string{"uploads"})
+	assert.DeepEqual(t, sc.DeletedEmptyDirs, []string{"tmp"})
+	assert.DeepEqual(t, changedPaths(sc), []string{"tmp/file.txt"})
+	changed, err = m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+
+	// a removed empty dir leaves its parent empty
+	assert.NilError(t, m.UpdateState(sc))
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "data", "cache")))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.EmptyDirs, []string{"data"})
+	assert.DeepEqual(t, sc.DeletedEmptyDirs, []string{"data/cache"})
+	assert.Equal(t, len(sc.Deletions), 0)
+
+	assert.NilError(t, m.UpdateState(sc))
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "data")))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc.EmptyDirs == nil)
+	assert.DeepEqual(t, sc.DeletedEmptyDirs, []string{"data"})
+	assert.NilError(t, m.UpdateState(sc))
+
+	// empty dirs in the state are not deletions if not tracked
+	m.SetTrackEmptyDirs(false)
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "uploads")))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+	changed, err = m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+}
+
+func TestEmptyFile(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":         "print('hello')",
+		"lib/__init__.py": "",
+	})
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/__init__.py", "main.py"})
+	assert.Equal(t, sc.Changes["lib/__init__.py"], "")
+	assert.Equal(t, sc.Sizes["lib/__init__.py"], int64(0))
+
+	checksum, err := m.ChecksumFile(filepath.Join("lib", "__init__.py"))
+	assert.NilError(t, err)
+	assert.Equal(t, checksum, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+
+	assert.NilError(t, m.StoreState())
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+}
+
+func TestBrokenLinks(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	assert.NilError(t, os.Symlink("missing.py", filepath.Join(m.rootDir, "lib", "broken.py")))
+	assert.NilError(t, os.Symlink("utils.py", filepath.Join(m.rootDir, "lib", "link.py")))
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.BrokenLinks, []string{"lib/broken.py"})
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/link.py", "lib/utils.py", "main.py"})
+
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "print('updated')"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.BrokenLinks, []string{"lib/broken.py"})
+	assert.DeepEqual(t, changedPaths(sc), []string{"main.py"})
+
+	// a missing regular file still fails
+	err = m.readParallel([]readJob{{path: "missing.py"}}, func(readJob, []byte) {})
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestRootDirForms(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{"lib/utils.py": "def g(): pass"})
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	rel, err := filepath.Rel(wd, m.rootDir)
+	assert.NilError(t, err)
+	forms := []string{
+		rel,
+		"." + string(filepath.Separator) + rel + string(filepath.Separator),
+		filepath.Join(rel, "lib", ".."),
+		m.rootDir,
+	}
+	for _, form := range forms {
+		fm, err := NewManager(&form, false)
+		assert.NilError(t, err)
+		assert.Equal(t, fm.RootDir(), m.rootDir)
+		assert.Equal(t, fm.StatePath(), filepath.Join(m.rootDir, ".deta", "state"))
+
+		sc, err := fm.GetChanges()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, changedPaths(sc), []string{"lib/utils.py"})
+		assert.Equal(t, len(sc.Deletions), 0)
+	}
+}
+
+func TestTouchState(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	assert.NilError(t, m.StoreState())
+
+	// changed outside of the cli
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "print('web')", "new.py": "x = 1"})
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "lib", "utils.py")))
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc != nil)
+
+	assert.NilError(t, m.TouchState())
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+	changed, err := m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+}
+
+func TestMaxDepth(t *testing.T) {
+	deep := strings.Repeat("d/", 50) + "deep.py"
+	m := newTestManager(t, map[string]string{
+		"main.py":        "print('hello')",
+		"a/one.py":       "1",
+		"a/b/two.py":     "2",
+		"a/b/c/three.py": "3",
+		deep:             "deep",
+	})
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(changedPaths(sc)), 5)
+
+	m.SetMaxDepth(2, false)
+	sc, err = m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"a/b/two.py", "a/one.py", "main.py"})
+
+	m.SetMaxDepth(2, true)
+	_, err = m.readAll()
+	assert.Assert(t, errors.Is(err, ErrMaxDepthExceeded))
+
+	m.SetMaxDepth(0, true)
+	sc, err = m.readAll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(changedPaths(sc)), 5)
+}
+
+func TestConcurrentUse(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		"lib/utils.py":     "def f(): pass",
+		"requirements.txt": "requests==2.28.0",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{ID: "id", Runtime: "python3.9"}))
+	assert.NilError(t, m.StoreState())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := m.GetChanges()
+			errs <- err
+		}()
+		go func(i int) {
+			defer wg.Done()
+			errs <- m.StoreProgInfo(&ProgInfo{ID: "id", Runtime: "python3.9", Name: fmt.Sprintf("micro-%d", i)})
+		}(i)
+		go func() {
+			defer wg.Done()
+			errs <- m.StoreState()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NilError(t, err)
+	}
+
+	progInfo, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(progInfo.Name, "micro-"))
+}
+
+func TestSalt(t *testing.T) {
+	files := map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "requests==2.28.0",
+	}
+	m1 := newTestManager(t, files)
+	m2 := newTestManager(t, files)
+
+	checksum := func(m *Manager) (string, string) {
+		c, err := m.ProjectChecksum()
+		assert.NilError(t, err)
+		f, err := m.DepsFingerprint()
+		assert.NilError(t, err)
+		return c, f
+	}
+
+	c1, f1 := checksum(m1)
+	c2, f2 := checksum(m2)
+	assert.Equal(t, c1, c2)
+	assert.Equal(t, f1, f2)
+
+	m1.SetSalt(m1.RootDir())
+	m2.SetSalt(m2.RootDir())
+	s1, sf1 := checksum(m1)
+	s2, sf2 := checksum(m2)
+	assert.Assert(t, s1 != s2)
+	assert.Assert(t, sf1 != sf2)
+	assert.Assert(t, s1 != c1)
+
+	// file checksums in the state are not salted
+	assert.NilError(t, m1.StoreState())
+	assert.NilError(t, m2.StoreState())
+	st1, err := m1.getStoredState()
+	assert.NilError(t, err)
+	st2, err := m2.getStoredState()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, st1, st2)
+}
+
+func TestUnsupportedRuntime(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"go.mod":  "module micro\n",
+		"main.go": "package main",
+	})
+	_, err := m.GetRuntime()
+	assert.Error(t, err, "found go.mod but the Go runtime is not supported")
+	assert.Assert(t, errors.Is(err, ErrNoEntrypoint))
+	var unsupported *UnsupportedRuntimeError
+	assert.Assert(t, errors.As(err, &unsupported))
+	assert.Equal(t, unsupported.Runtime, "Go")
+
+	// a supported entrypoint is used
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": ""})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Python)
+}
+
+func TestChecksumCache(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": "print('hello')"})
+	l := &testLogger{}
+	m.SetLogger(l)
+	path := filepath.Join(m.rootDir, "main.py")
+
+	hashed := func() int {
+		n := 0
+		for _, d := range l.debug {
+			if d == "hashing "+path {
+				n++
+			}
+		}
+		return n
+	}
+
+	first, err := m.calcChecksum(path)
+	assert.NilError(t, err)
+	second, err := m.calcChecksum(path)
+	assert.NilError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, hashed(), 1)
+
+	// a changed file is hashed again
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "print('changed')"})
+	future := time.Now().Add(time.Minute)
+	assert.NilError(t, os.Chtimes(path, future, future))
+	third, err := m.calcChecksum(path)
+	assert.NilError(t, err)
+	assert.Assert(t, third != first)
+	assert.Equal(t, hashed(), 2)
+}
+
+func TestChecksumFile(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	m.config.Hasher = hasherSHA512
+	assert.NilError(t, m.StoreState())
+	state, err := m.getStoredState()
+	assert.NilError(t, err)
+
+	for _, path := range []string{"main.py", "lib/utils.py"} {
+		checksum, err := m.ChecksumFile(path)
+		assert.NilError(t, err)
+		assert.Equal(t, checksum, state[path])
+	}
+	checksum, err := m.ChecksumFile("lib/../main.py")
+	assert.NilError(t, err)
+	assert.Equal(t, checksum, state["main.py"])
+
+	_, err = m.ChecksumFile("../main.py")
+	assert.ErrorContains(t, err, "is not in the root dir")
+	_, err = m.ChecksumFile(filepath.Join(m.rootDir, "main.py"))
+	assert.ErrorContains(t, err, "is not relative to the root dir")
+	_, err = m.ChecksumFile("missing.py")
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestTouchFile(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"lib/data.txt": "data",
+	})
+	assert.NilError(t, m.StoreState())
+	before, err := m.getStoredState()
+	assert.NilError(t, err)
+
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "print('synced')", "lib/utils.py": "def g(): pass"})
+	assert.NilError(t, m.TouchFile("main.py"))
+	after, err := m.getStoredState()
+	assert.NilError(t, err)
+	checksum, err := m.ChecksumFile("main.py")
+	assert.NilError(t, err)
+	assert.Equal(t, after["main.py"], checksum)
+	assert.Assert(t, after["main.py"] != before["main.py"])
+	// other entries are unchanged
+	assert.Equal(t, after["lib/utils.py"], before["lib/utils.py"])
+	assert.Equal(t, after["lib/data.txt"], before["lib/data.txt"])
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/utils.py"})
+
+	// deleted files are removed from the state
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "lib", "data.txt")))
+	assert.NilError(t, m.TouchFile("lib/data.txt"))
+	after, err = m.getStoredState()
+	assert.NilError(t, err)
+	_, ok := after["lib/data.txt"]
+	assert.Assert(t, !ok)
+	assert.Equal(t, after["lib/utils.py"], before["lib/utils.py"])
+
+	assert.ErrorContains(t, m.TouchFile("../main.py"), "is not in the root dir")
+	assert.ErrorContains(t, m.TouchFile(filepath.Join(m.rootDir, "main.py")), "is not relative to the root dir")
+	assert.Assert(t, errors.Is(m.TouchFile("lib"), ErrNotTracked))
+}
+
+func TestBinaryPaths(t *testing.T) {
+	files := map[string]string{
+		"main.py":    "print('hello')",
+		"utf8.txt":   "héllo wörld ✓",
+		"data.bin":   "abc\x00def",
+		"latin1.txt": "caf\xe9",
+	}
+	m := newTestManager(t, files)
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Equal(t, len(sc.BinaryPaths), 0)
+
+	m.SetClassifyBinary(true)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.BinaryPaths, map[string]bool{
+		"main.py":    false,
+		"utf8.txt":   false,
+		"data.bin":   true,
+		"latin1.txt": true,
+	})
+
+	// only changed files are classified
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{"data.bin": "abc\x00xyz"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.BinaryPaths, map[string]bool{"data.bin": true})
+}
+
+func TestChangedSince(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":        "print('hello')",
+		"lib/utils.py":   "def f(): pass",
+		"lib/helpers.py": "def g(): pass",
+		".env":           "KEY=value",
+	})
+	past := time.Now().Add(-time.Hour)
+	for _, f := range []string{"main.py", "lib/utils.py", "lib/helpers.py", ".env"} {
+		assert.NilError(t, os.Chtimes(filepath.Join(m.rootDir, filepath.FromSlash(f)), past, past))
+	}
+
+	since := time.Now().Add(-time.Minute)
+	changed, err := m.ChangedSince(since)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changed, []string{})
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":        "print('changed')",
+		"lib/helpers.py": "def g(): return 1",
+		".env":           "KEY=changed",
+	})
+	changed, err = m.ChangedSince(since)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changed, []string{"lib/helpers.py", "main.py"})
+}
+
+func TestReadEntrypoint(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "def app(event):\n    return 'hello'\n",
+		"lib/utils.py": "",
+	})
+	contents, runtime, err := m.ReadEntrypoint()
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), "def app(event):\n    return 'hello'\n")
+	assert.Equal(t, runtime, Python)
+
+	m = newTestManager(t, map[string]string{"index.js": "module.exports = app;\n"})
+	contents, runtime, err = m.ReadEntrypoint()
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), "module.exports = app;\n")
+	assert.Equal(t, runtime, Node)
+
+	m = newTestManager(t, map[string]string{"lib/main.py": ""})
+	_, _, err = m.ReadEntrypoint()
+	assert.Assert(t, errors.Is(err, ErrNoEntrypoint))
+}
+
+func TestEntrypointConventions(t *testing.T) {
+	tests := []struct {
+		files      map[string]string
+		runtime    string
+		entrypoint string
+	}{
+		{map[string]string{"__main__.py": ""}, Python, "__main__.py"},
+		{map[string]string{"__main__.py": "", "main.py": ""}, Python, "main.py"},
+		{map[string]string{"index.mjs": ""}, Node, "index.mjs"},
+		{map[string]string{"index.mjs": "", "index.js": ""}, Node, "index.js"},
+		// the main file of package.json is preferred
+		{map[string]string{"index.js": "", "index.mjs": "", "package.json": `{"main": "index.mjs"}`}, Node, "index.mjs"},
+		{map[string]string{"src/server.js": "", "package.json": `{"main": "./src/server.js"}`}, Node, "src/server.js"},
+		// a main file that is not present is skipped
+		{map[string]string{"index.js": "", "package.json": `{"main": "dist/index.js"}`}, Node, "index.js"},
+		// package.json of a tool of a python program
+		{map[string]string{"main.py": "", "package.json": `{"main": "tool.js"}`, "tool.js": ""}, Python, "main.py"},
+	}
+	for _, tc := range tests {
+		m := newTestManager(t, tc.files)
+		r, err := m.GetRuntime()
+		assert.NilError(t, err)
+		assert.Equal(t, r.Name, tc.runtime)
+		entrypoint, err := m.GetEntrypoint()
+		assert.NilError(t, err)
+		assert.Equal(t, entrypoint, tc.entrypoint)
+	}
+
+	m := newTestManager(t, map[string]string{"main.py": "", "index.mjs": ""})
+	_, err := m.GetEntrypoint()
+	assert.Assert(t, errors.Is(err, ErrEntrypointConflict))
+}
+
+func TestOversizedFiles(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"data/big.csv": strings.Repeat("a,b\n", 100),
+		"data/ok.csv":  "a,b\n",
+	})
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc.OversizedFiles == nil)
+
+	m.SetMaxFileSize(100)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.OversizedFiles, []string{"data/big.csv"})
+	_, ok := sc.Changes["data/big.csv"]
+	assert.Assert(t, ok)
+
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":     strings.Repeat("print('hello')\n", 10),
+		"data/ok.csv": "a,b\nc,d\n",
+	})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.OversizedFiles, []string{"main.py"})
+}
+
+func TestNormalizeEOL(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":  "import os\nprint('hello')\n",
+		"lib.py":   "x = 1\r\ny = 2\r\n",
+		"data.bin": "abc\x00\r\ndef",
+	})
+	m.SetNormalizeEOL(true, false)
+	assert.NilError(t, m.StoreState())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":  "import os\r\nprint('hello')\r\n",
+		"lib.py":   "x = 1\ny = 2\n",
+		"data.bin": "abc\x00\ndef",
+	})
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	// binary files are not normalized
+	assert.DeepEqual(t, changedPaths(sc), []string{"data.bin"})
+
+	// trailing whitespace is a change unless trimmed
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "import os  \r\nprint('hello')\t\r\n"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"data.bin", "main.py"})
+
+	m.SetNormalizeEOL(true, true)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"data.bin"})
+
+	// raw contents are hashed if disabled, lib.py was stored normalized to \n
+	m.SetNormalizeEOL(false, false)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"data.bin", "main.py"})
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"index.js":     "",
+		"package.json": `{"name": "app", "dependencies": {"express": "^4.17.1", "lodash": "4.17.21"}, "version": 1.0}`,
+		"config.json":  `{"a": 1, "b": 2}`,
+	})
+	m.SetCanonicalJSON(true)
+	assert.NilError(t, m.StoreState())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"package.json": "{\n  \"version\": 1.0,\n  \"dependencies\": {\n    \"lodash\": \"4.17.21\",\n    \"express\": \"^4.17.1\"\n  },\n  \"name\": \"app\"\n}\n",
+		// json files that are not dependency files are hashed as is
+		"config.json": `{"b": 2, "a": 1}`,
+	})
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"config.json"})
+
+	// numbers are compared as written
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"package.json": `{"name": "app", "dependencies": {"express": "^4.17.1", "lodash": "4.17.21"}, "version": 1}`,
+	})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"config.json", "package.json"})
+
+	// invalid json is hashed as is
+	writeTestFiles(t, m.rootDir, map[string]string{"package.json": `{"name": "app",`})
+	checksum, err := m.ChecksumFile("package.json")
+	assert.NilError(t, err)
+	assert.Equal(t, checksum, m.checksum([]byte(`{"name": "app",`)))
+	_, err = canonicalizeJSON([]byte(`{"a": 1} {"b": 2}`))
+	assert.ErrorContains(t, err, "data after the top level value")
+
+	// raw contents are hashed if disabled
+	m.SetCanonicalJSON(false)
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"package.json": `{"dependencies": {"express": "^4.17.1", "lodash": "4.17.21"}, "name": "app", "version": 1.0}`,
+	})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"config.json", "package.json"})
+}
+
+func TestReinit(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "flask==2.0.1\n",
+	})
+	_, err := m.Reinit()
+	assert.ErrorContains(t, err, "no program information found")
+
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{
+		ID:            "id",
+		Name:          "micro",
+		Path:          "micro-path",
+		Runtime:       "python3.8",
+		Deps:          []string{"flask==2.0.1"},
+		PythonVersion: "3.8.10",
+	}))
+	// the stored runtime version is kept
+	progInfo, err := m.Reinit()
+	assert.NilError(t, err)
+	assert.Equal(t, progInfo.Runtime, "python3.8")
+
+	// switch to node
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "main.py")))
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "requirements.txt")))
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"index.js":     "module.exports = () => 'hello'",
+		"package.json": `{"dependencies": {"express": "^4.17.1"}}`,
+	})
+	progInfo, err = m.Reinit()
+	assert.NilError(t, err)
+	assert.Equal(t, progInfo.RuntimeName, Node)
+	assert.Equal(t, progInfo.Runtime, "nodejs14.x")
+	assert.DeepEqual(t, progInfo.Deps, []string{"express@^4.17.1"})
+	assert.Equal(t, progInfo.PythonVersion, "")
+
+	stored, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, stored, progInfo)
+	assert.Equal(t, stored.ID, "id")
+	assert.Equal(t, stored.Name, "micro")
+	assert.Equal(t, stored.Path, "micro-path")
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Node)
+
+	// no entrypoint
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "index.js")))
+	_, err = m.Reinit()
+	assert.Assert(t, errors.Is(err, ErrNoEntrypoint))
+}
+
+func TestSetRuntime(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"bootstrap.sh":     "python -m app",
+		"app/__init__.py":  "",
+		"requirements.txt": "flask==2.0.1\n",
+		"package.json":     `{"dependencies": {"express": "^4.17.1"}}`,
+	})
+	_, err := m.GetRuntime()
+	assert.Assert(t, errors.Is(err, ErrNoEntrypoint))
+
+	assert.ErrorContains(t, m.SetRuntime("cobol"), "unsupported runtime 'cobol'")
+	assert.NilError(t, m.SetRuntime("python3.8"))
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, r, &Runtime{Name: Python, Version: "python3.8"})
+
+	dc, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dc.Added, []string{"flask==2.0.1"})
+
+	// the name of a runtime sets its default version
+	assert.NilError(t, m.SetRuntime(Node))
+	r, err = m.GetRuntime()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, r, &Runtime{Name: Node, Version: "nodejs14.x"})
+	dc, err = m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, dc.Added, []string{"express@^4.17.1"})
+
+	// detection overrides the runtime only when run again
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": ""})
+	r, err = m.GetRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Node)
+	r, err = m.ForceDetectRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Python)
+}
+
+func TestCustomRuntime(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"Dockerfile":       "FROM python:3.9\nCOPY . .\nRUN pip install -r requirements.txt\n",
+		"app/server.py":    "",
+		"requirements.txt": "flask==2.0.1\n",
+		"go.mod":           "module micro\n",
+	})
+	r, err := m.GetRuntime()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, r, &Runtime{Name: Custom, Version: "custom"})
+	_, entrypoint, err := m.detectEntrypoint()
+	assert.NilError(t, err)
+	assert.Equal(t, entrypoint, "Dockerfile")
+
+	// deps are installed by the Dockerfile
+	deps, err := m.ReadDeps(Custom)
+	assert.NilError(t, err)
+	assert.Assert(t, deps == nil)
+	assert.Assert(t, !m.IsDepFile("requirements.txt"))
+	assert.Assert(t, m.Validate() == nil)
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"Dockerfile", "app/server.py", "go.mod", "requirements.txt"})
+
+	// standard entrypoints take precedence
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": ""})
+	r, err = m.ForceDetectRuntime()
+	assert.NilError(t, err)
+	assert.Equal(t, r.Name, Python)
+
+	assert.ErrorContains(t, newTestManager(t, nil).InitProject(Custom), "can not be initialized")
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	if goruntime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	shared := newTestManager(t, map[string]string{
+		"utils.py":        "def f(): pass",
+		"helpers/http.py": "import requests",
+	})
+	sharedDir, err := filepath.Abs(shared.rootDir)
+	assert.NilError(t, err)
+	m := newTestManager(t, map[string]string{
+		"main.py":   "print('hello')",
+		"lib/db.py": "db = None",
+	})
+	assert.NilError(t, os.Symlink(filepath.Join(sharedDir, "utils.py"), filepath.Join(m.rootDir, "utils.py")))
+	assert.NilError(t, os.Symlink(filepath.Join(sharedDir, "helpers"), filepath.Join(m.rootDir, "helpers")))
+	// cycles
+	assert.NilError(t, os.Symlink("..", filepath.Join(m.rootDir, "lib", "loop")))
+	assert.NilError(t, os.Symlink(".", filepath.Join(m.rootDir, "self")))
+
+	// linked dirs are skipped if links are not followed
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/db.py", "main.py", "utils.py"})
+
+	m.SetFollowSymlinks(true)
+	sc, err = m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"helpers/http.py", "lib/db.py", "main.py", "utils.py"})
+	assert.Equal(t, sc.Changes["helpers/http.py"], "import requests")
+	assert.Equal(t, sc.Changes["utils.py"], "def f(): pass")
+
+	// checksums are of the targets
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, sharedDir, map[string]string{"helpers/http.py": "import httpx"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"helpers/http.py"})
+}
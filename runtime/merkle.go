@@ -0,0 +1,186 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// map dir path to the digest of the tree of the dir, the root dir is .
+type digestMap map[string]string
+
+// SetDirDigests sets if digests of dirs are stored with the state so GetChanges does not hash files of unchanged subtrees
+// eg: to speed up huge trees where hashing every file is slow
+// the digest of a dir is derived bottom up from the names, sizes, modification times and modes of the files directly
+// in it and the digests of the dirs directly in it, so a change anywhere below a dir changes the digest of the dir
+// unlike SetSkipUnchangedDirs files modified in place are detected, but every dir is still walked and every file stat'ed
+// to derive the digests, only reading and hashing of files in unchanged subtrees is skipped
+// files of the state in unchanged subtrees are assumed unchanged, so contents changed without changing the size or
+// modification time eg: by restoring the modification time are not reported, neither are settings that change
+// checksums of files eg: SetNormalizeLineEndings until the state is stored again
+func (m *Manager) SetDirDigests(enabled bool) {
+	m.dirDigests = enabled
+}
+
+// treeHasher derives digests of dirs bottom up from the files walked
+type treeHasher struct {
+	entries map[string][]string // entries of files and dirs directly in a dir by slash separated path of the dir
+}
+
+func newTreeHasher() *treeHasher {
+	return &treeHasher{entries: map[string][]string{".": nil}}
+}
+
+// adds the dir in the slash separated path
+func (h *treeHasher) addDir(path string) {
+	if _, ok := h.entries[path]; !ok {
+		h.entries[path] = nil
+	}
+}
+
+// adds the file in the slash separated path, info of symlinks should be of the targets
+func (h *treeHasher) addFile(path string, info os.FileInfo) {
+	dir := pathpkg.Dir(path)
+	h.entries[dir] = append(h.entries[dir], fmt.Sprintf("f %q %d %d %o",
+		pathpkg.Base(path), info.Size(), info.ModTime().UnixNano(), info.Mode()))
+}
+
+// returns the digests of all dirs added
+func (h *treeHasher) digests() digestMap {
+	dirs := make([]string, 0, len(h.entries))
+	for dir := range h.entries {
+		dirs = append(dirs, dir)
+	}
+	// dirs deeper down first so digests of dirs are added to their parents before the parents are hashed
+	depth := func(dir string) int {
+		if dir == "." {
+			return 0
+		}
+		return strings.Count(dir, "/") + 1
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if depth(dirs[i]) != depth(dirs[j]) {
+			return depth(dirs[i]) > depth(dirs[j])
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	digests := make(digestMap, len(dirs))
+	for _, dir := range dirs {
+		entries := h.entries[dir]
+		sort.Strings(entries)
+		sum := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+		digests[dir] = hex.EncodeToString(sum[:])
+		if dir != "." {
+			parent := pathpkg.Dir(dir)
+			h.entries[parent] = append(h.entries[parent], fmt.Sprintf("d %q %s", pathpkg.Base(dir), digests[dir]))
+		}
+	}
+	return digests
+}
+
+// adds the file in path relative to the root dir to h, symlinks are added with the info of their targets
+func (m *Manager) addTreeFile(h *treeHasher, path string, info os.FileInfo) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := m.fs.Stat(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		info = target
+	}
+	slash, err := m.relPath(filepath.Join(m.rootDir, path))
+	if err != nil {
+		return err
+	}
+	h.addFile(slash, info)
+	return nil
+}
+
+// derives the digests of the dirs of the root dir from the files currently present
+func (m *Manager) currentDigests(runtime string) (digestMap, error) {
+	h := newTreeHasher()
+	err := m.walkFilesFrom(runtime, ".", func(path string, info os.FileInfo) error {
+		return m.addTreeFile(h, path, info)
+	}, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		h.addDir(slash)
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return h.digests(), nil
+}
+
+// returns the dirs with the same digest as stored, returns nil if digests are not used or not stored yet
+func (m *Manager) unchangedTrees(runtime string) (map[string]bool, error) {
+	if !m.dirDigests {
+		return nil, nil
+	}
+	stored, err := m.getStoredDigests()
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	current, err := m.currentDigests(runtime)
+	if err != nil {
+		return nil, err
+	}
+	unchanged := make(map[string]bool)
+	for dir, digest := range current {
+		if stored[dir] == digest {
+			unchanged[dir] = true
+		}
+	}
+	return unchanged, nil
+}
+
+// checks if the slash separated path is in one of the dirs
+func inTrees(path string, dirs map[string]bool) bool {
+	for dir := pathpkg.Dir(path); ; dir = pathpkg.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+		if dir == "." {
+			return false
+		}
+	}
+}
+
+// gets the stored digests of dirs, returns nil if not stored yet
+func (m *Manager) getStoredDigests() (digestMap, error) {
+	m.filesMu.RLock()
+	contents, err := m.readFile(filepath.Join(m.detaPath, digestsFile))
+	m.filesMu.RUnlock()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var digests digestMap
+	err = json.Unmarshal(contents, &digests)
+	if err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+func (m *Manager) storeDigests(digests digestMap) error {
+	marshalled, err := json.Marshal(digests)
+	if err != nil {
+		return err
+	}
+	m.filesMu.Lock()
+	defer m.filesMu.Unlock()
+	return m.writeFileAtomic(filepath.Join(m.detaPath, digestsFile), marshalled, filePermMode)
+}
@@ -0,0 +1,98 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDirDigests(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":           "print('hello')",
+		"a/x.py":            "x = 1",
+		"a/c/z.py":          "z = 1",
+		"b/y.py":            "y = 1",
+		"b/w.py":            "w = 1",
+		"a/assets/logo.png": "png",
+	})
+	m.SetDirDigests(true)
+	m.SetAlwaysUpload([]string{".png"}, 0)
+	assert.NilError(t, m.StoreState())
+
+	// a new manager does not have checksums of the files cached
+	newManager := func() (*Manager, map[string]int, *testLogger) {
+		m, err := NewManager(&m.rootDir, true)
+		assert.NilError(t, err)
+		m.SetDirDigests(true)
+		m.SetAlwaysUpload([]string{".png"}, 0)
+		l := &testLogger{}
+		m.SetLogger(l)
+		return m, countOpens(m), l
+	}
+
+	m, opens, l := newManager()
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.AlwaysUpload, []string{"a/assets/logo.png"})
+	assert.DeepEqual(t, sortedKeys(sc.Changes), []string{"a/assets/logo.png"})
+	assert.Assert(t, contains(l.debug, "skipping unchanged tree ."))
+	for _, path := range []string{"main.py", "a/x.py", "a/c/z.py", "b/y.py", "b/w.py"} {
+		assert.Equal(t, opens[path], 0)
+	}
+
+	writeTestFiles(t, m.rootDir, map[string]string{"b/y.py": "y = 22"})
+	m, opens, l = newManager()
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sortedKeys(sc.Changes), []string{"a/assets/logo.png", "b/y.py"})
+	assert.Equal(t, len(sc.Deletions), 0)
+	assert.Assert(t, contains(l.debug, "skipping unchanged tree a"))
+	// files of the untouched subtree are not hashed, files of the touched one are
+	assert.Equal(t, opens["a/x.py"], 0)
+	assert.Equal(t, opens["a/c/z.py"], 0)
+	assert.Assert(t, opens["b/w.py"] > 0)
+	assert.Assert(t, opens["b/y.py"] > 0)
+	assert.Assert(t, opens["main.py"] > 0)
+
+	// a deletion deep down changes the digests of all dirs above
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "a", "c", "z.py")))
+	m, opens, l = newManager()
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Deletions, []string{"a/c/z.py"})
+	assert.DeepEqual(t, sortedKeys(sc.Changes), []string{"a/assets/logo.png", "b/y.py"})
+	assert.Assert(t, !contains(l.debug, "skipping unchanged tree a"))
+	assert.Assert(t, contains(l.debug, "skipping unchanged tree a/assets"))
+	assert.Assert(t, opens["a/x.py"] > 0)
+
+	// without digests every file is hashed
+	m.SetDirDigests(false)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Deletions, []string{"a/c/z.py"})
+	assert.DeepEqual(t, sortedKeys(sc.Changes), []string{"a/assets/logo.png", "b/y.py"})
+}
+
+func TestTreeHasher(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": "", "a/b/c.py": "c", "d/e.py": "e"})
+	past := time.Now().Add(-time.Hour)
+	for _, path := range []string{"main.py", "a/b/c.py", "d/e.py"} {
+		assert.NilError(t, os.Chtimes(filepath.Join(m.rootDir, filepath.FromSlash(path)), past, past))
+	}
+	d1, err := m.currentDigests(Python)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sortedKeys(d1), []string{".", "a", "a/b", "d"})
+
+	// a different size below a changes the digests of a, a/b and the root dir only
+	writeTestFiles(t, m.rootDir, map[string]string{"a/b/c.py": "cc"})
+	assert.NilError(t, os.Chtimes(filepath.Join(m.rootDir, "a", "b", "c.py"), past, past))
+	d2, err := m.currentDigests(Python)
+	assert.NilError(t, err)
+	assert.Assert(t, d1["."] != d2["."])
+	assert.Assert(t, d1["a"] != d2["a"])
+	assert.Assert(t, d1["a/b"] != d2["a/b"])
+	assert.Equal(t, d1["d"], d2["d"])
+}
@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrMissingFiles files of the stored state are not present in the new root dir
+var ErrMissingFiles = errors.New("files of the stored state are missing")
+
+// Move relocates the stored program info and state to the .deta dir of newRoot eg: after the project dir was moved
+// paths of the state that are absolute paths under the old root dir are rewritten relative to newRoot
+// if the .deta dir was moved with the project dir, the state is read from the .deta dir of newRoot
+// every file of the state must be present in newRoot, the old .deta dir is left as is
+// the manager uses newRoot as its root dir afterwards
+func (m *Manager) Move(newRoot string) error {
+	newRoot, err := filepath.Abs(newRoot)
+	if err != nil {
+		return err
+	}
+	info, err := m.fs.Stat(newRoot)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", newRoot)
+	}
+
+	oldRoot := m.rootDir
+	newDetaPath := filepath.Join(newRoot, detaDir)
+	// the .deta dir was moved with the project dir
+	if _, err := m.fs.Stat(m.detaPath); os.IsNotExist(err) {
+		m.setRoot(newRoot)
+	}
+
+	storedState, err := m.getStoredState()
+	if err != nil {
+		return err
+	}
+	storedModes, err := m.getStoredModes()
+	if err != nil {
+		return err
+	}
+
+	sm := make(stateMap, len(storedState))
+	var missing []string
+	for path, checksum := range storedState {
+		path = relToRoot(oldRoot, path)
+		sm[path] = checksum
+
+		info, err := m.fs.Stat(filepath.Join(newRoot, filepath.FromSlash(strings.TrimSuffix(path, "/"))))
+		if err != nil || (isEmptyDirKey(path) && !info.IsDir()) {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w in '%s': %s", ErrMissingFiles, newRoot, strings.Join(missing, ", "))
+	}
+	modes := make(modeMap, len(storedModes))
+	for path, mode := range storedModes {
+		modes[relToRoot(oldRoot, path)] = mode
+	}
+
+	if newDetaPath != m.detaPath {
+		err = m.copyDetaDir(newDetaPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.setRoot(newRoot)
+
+	err = m.storeStateMap(sm)
+	if err != nil {
+		return err
+	}
+	if m.trackModes {
+		marshalled, err := json.Marshal(modes)
+		if err != nil {
+			return err
+		}
+		// keep the stored modes instead of the current modes stored with the state
+		m.filesMu.Lock()
+		defer m.filesMu.Unlock()
+		return m.writeFileAtomic(m.modesPath, marshalled, filePermMode)
+	}
+	return nil
+}
+
+// sets the root dir and the paths of the files under it
+func (m *Manager) setRoot(root string) {
+	m.rootDir = root
+	m.detaPath = filepath.Join(root, detaDir)
+	m.progInfoPath = filepath.Join(m.detaPath, progInfoFile)
+	m.statePath = filepath.Join(m.detaPath, stateFile)
+	m.modesPath = filepath.Join(m.detaPath, modesFile)
+	m.ignorePath = filepath.Join(root, ignoreFile)
+}
+
+// relToRoot rewrites a path of the state that is an absolute path under root relative to root
+// other paths are returned as is
+func relToRoot(root, path string) string {
+	native := filepath.FromSlash(strings.TrimSuffix(path, "/"))
+	if !filepath.IsAbs(native) {
+		return path
+	}
+	rel, err := relPathFrom(root, native)
+	if err != nil {
+		return path
+	}
+	if isEmptyDirKey(path) {
+		return emptyDirKey(rel)
+	}
+	return rel
+}
+
+// copies the files of the deta dir except the lock file to dest
+func (m *Manager) copyDetaDir(dest string) error {
+	err := m.fs.MkdirAll(dest, dirPermMode)
+	if err != nil {
+		return err
+	}
+	entries, err := m.fs.ReadDir(m.detaPath)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || e.Name() == lockFile {
+			continue
+		}
+		err = m.copyFile(filepath.Join(m.detaPath, e.Name()), filepath.Join(dest, e.Name()), e.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMove(t *testing.T) {
+	files := map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "requests==2.25.1",
+		"lib/utils.py":     "def f(): pass",
+	}
+	m := newTestManager(t, files)
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{ID: "id", Runtime: "python3.9"}))
+	assert.NilError(t, m.StoreState())
+
+	oldRoot := m.rootDir
+	newRoot := oldRoot + "-moved"
+	assert.NilError(t, os.Rename(oldRoot, newRoot))
+	defer os.RemoveAll(newRoot)
+
+	assert.NilError(t, m.Move(newRoot))
+	assert.Equal(t, m.RootDir(), newRoot)
+	assert.Equal(t, m.DetaPath(), filepath.Join(newRoot, detaDir))
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil, "unexpected changes after move: %+v", sc)
+
+	info, err := m.GetProgInfo()
+	assert.NilError(t, err)
+	assert.Equal(t, info.ID, "id")
+}
+
+func TestMoveAbsolutePaths(t *testing.T) {
+	files := map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	}
+	m := newTestManager(t, files)
+	assert.NilError(t, m.StoreState())
+
+	// rewrite the state with absolute paths under the old root dir
+	sm, err := m.getStoredState()
+	assert.NilError(t, err)
+	abs := make(stateMap)
+	for path, checksum := range sm {
+		abs[filepath.ToSlash(filepath.Join(m.rootDir, path))] = checksum
+	}
+	assert.NilError(t, m.storeStateMap(abs))
+
+	newRoot := newTestManager(t, files).RootDir()
+	assert.NilError(t, m.Move(newRoot))
+
+	moved, err := m.getStoredState()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, moved, sm)
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil, "unexpected changes after move: %+v", sc)
+}
+
+func TestMoveMissingFiles(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	assert.NilError(t, m.StoreState())
+	oldRoot := m.RootDir()
+
+	newRoot := newTestManager(t, map[string]string{"main.py": "print('hello')"}).RootDir()
+	err := m.Move(newRoot)
+	assert.Assert(t, errors.Is(err, ErrMissingFiles))
+	assert.ErrorContains(t, err, "lib/utils.py")
+	assert.Equal(t, m.RootDir(), oldRoot)
+}
@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+const nvmrcFile = ".nvmrc"
+
+// DetectNodeVersion detects the node version of the program from .nvmrc or the engines.node field of package.json
+// ranges are recorded as their version number eg: 18 of >=18, v prefixes are dropped eg: 18.12.1 of v18.12.1
+// .nvmrc is preferred if both are present, a warning is recorded if they disagree
+// the version is stored in program info if present, returns an empty string if no source is present
+func (m *Manager) DetectNodeVersion() (string, error) {
+	nvmrc, err := m.readNvmrcVersion()
+	if err != nil {
+		return "", err
+	}
+	engines, err := m.readEnginesNodeVersion()
+	if err != nil {
+		return "", err
+	}
+
+	version := nvmrc
+	if version == "" {
+		version = engines
+	} else if engines != "" && !versionPrefix(engines, nvmrc) && !versionPrefix(nvmrc, engines) {
+		m.warn("node version of %s %s and engines.node of %s %s disagree, using %s", nvmrcFile, nvmrc, depFiles[Node], engines, nvmrc)
+	}
+	if version == "" {
+		return "", nil
+	}
+
+	progInfo, err := m.GetProgInfo()
+	if err != nil {
+		return "", err
+	}
+	if progInfo != nil && progInfo.NodeVersion != version {
+		progInfo.NodeVersion = version
+		err = m.StoreProgInfo(progInfo)
+		if err != nil {
+			return "", err
+		}
+	}
+	return version, nil
+}
+
+// reads the node version of .nvmrc, aliases eg: lts/* are not versions and are ignored
+func (m *Manager) readNvmrcVersion() (string, error) {
+	contents, err := m.readDepFile(nvmrcFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	lines, err := readLines(contents)
+	if err != nil {
+		return "", err
+	}
+	for _, l := range lines {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+			return versionNumberRegexp.FindString(l), nil
+		}
+	}
+	return "", nil
+}
+
+// reads the node version of the engines.node field of package.json eg: >=18
+func (m *Manager) readEnginesNodeVersion() (string, error) {
+	contents, err := m.readDepFile(depFiles[Node])
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	var pj struct {
+		Engines map[string]string `json:"engines"`
+	}
+	err = json.Unmarshal(contents, &pj)
+	if err != nil {
+		return "", invalidDepFile(depFiles[Node], contents, err)
+	}
+	return versionNumberRegexp.FindString(pj.Engines["node"]), nil
+}
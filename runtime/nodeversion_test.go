@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDetectNodeVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{"none", map[string]string{}, ""},
+		{"nvmrc", map[string]string{".nvmrc": "v18.12.1\n"}, "18.12.1"},
+		{"nvmrc alias", map[string]string{".nvmrc": "lts/hydrogen\n"}, ""},
+		{"engines", map[string]string{"package.json": `{"engines": {"node": ">=18"}}`}, "18"},
+		{"engines x range", map[string]string{"package.json": `{"engines": {"node": "14.x"}}`}, "14"},
+		{"agreeing sources", map[string]string{".nvmrc": "16.14.2", "package.json": `{"engines": {"node": "^16"}}`}, "16.14.2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{"index.js": ""}
+			for k, v := range tc.files {
+				files[k] = v
+			}
+			m := newTestManager(t, files)
+			assert.NilError(t, m.StoreProgInfo(&ProgInfo{ID: "id"}))
+
+			version, err := m.DetectNodeVersion()
+			assert.NilError(t, err)
+			assert.Equal(t, version, tc.expected)
+			assert.Equal(t, len(m.Warnings()), 0)
+
+			progInfo, err := m.GetProgInfo()
+			assert.NilError(t, err)
+			assert.Equal(t, progInfo.NodeVersion, tc.expected)
+		})
+	}
+}
+
+func TestDetectNodeVersionConflict(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"index.js":     "",
+		".nvmrc":       "18",
+		"package.json": `{"engines": {"node": ">=14 <17"}}`,
+	})
+	version, err := m.DetectNodeVersion()
+	assert.NilError(t, err)
+	assert.Equal(t, version, "18")
+	assert.DeepEqual(t, m.Warnings(), []string{"node version of .nvmrc 18 and engines.node of package.json 14 disagree, using 18"})
+}
@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"path/filepath"
+	goruntime "runtime"
+	"sync"
+)
+
+// default max bytes of files read concurrently so large files do not run out of memory
+const defaultReadBudget = 64 << 20
+
+// SetConcurrency sets the max files read concurrently when walking the root dir, 0 for the number of cpus
+// values below 1 other than 0 are treated as 1, which reads the files one by one in walk order as before files were read concurrently
+func (m *Manager) SetConcurrency(n int) {
+	if n == 0 {
+		n = goruntime.NumCPU()
+	}
+	if n < 1 {
+		n = 1
+	}
+	m.readWorkers = n
+}
+
+// Concurrency returns the max files read concurrently when walking the root dir
+func (m *Manager) Concurrency() int {
+	return m.readWorkers
+}
+
+// a file to read relative to the root dir
+type readJob struct {
+	path string // relative to the root dir
+	key  string // path with forward slashes as paths are stored, see relPath
+	size int64
+}
+
+// byteBudget limits the bytes in use at once
+// a single acquire larger than the budget is allowed if nothing else is in use
+type byteBudget struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	max  int64
+	used int64
+}
+
+func newByteBudget(max int64) *byteBudget {
+	b := &byteBudget{max: max}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n bytes are available
+func (b *byteBudget) acquire(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used > 0 && b.used+n > b.max {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+func (b *byteBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// readParallel reads the files of jobs with at most readWorkers concurrent reads and readBudget bytes read at once
+// fn is called concurrently with the contents of every file, in the order of jobs if reads are not concurrent
+// the first error stops the remaining reads and is returned
+func (m *Manager) readParallel(jobs []readJob, fn func(job readJob, contents []byte)) error {
+	workers := m.readWorkers
+	if workers <= 1 {
+		for _, job := range jobs {
+			contents, err := m.readProgFile(filepath.Join(m.rootDir, job.path))
+			if err != nil {
+				m.emitError(job.path, err)
+				return err
+			}
+			fn(job, contents)
+		}
+		return nil
+	}
+	budget := newByteBudget(m.readBudget)
+
+	var (
+		firstErr error
+		once     sync.Once
+		done     = make(chan struct{})
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			close(done)
+		})
+	}
+
+	jobCh := make(chan readJob)
+	go func() {
+		defer close(jobCh)
+		for _, job := range jobs {
+			budget.acquire(job.size)
+			select {
+			case jobCh <- job:
+			case <-done:
+				budget.release(job.size)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				select {
+				case <-done:
+					budget.release(job.size)
+					continue
+				default:
+				}
+
+				contents, err := m.readProgFile(filepath.Join(m.rootDir, job.path))
+				if err != nil {
+					m.emitError(job.path, err)
+					fail(err)
+				} else {
+					fn(job, contents)
+				}
+				budget.release(job.size)
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReadAllParallel(t *testing.T) {
+	files := map[string]string{"main.py": "print('hello')", "data.bin": "\x00\x01\x02"}
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("lib/file_%d.py", i)] = strings.Repeat(fmt.Sprintf("x = %d\n", i), i+1)
+	}
+	m := newTestManager(t, files)
+	// a budget smaller than most files still reads every file
+	m.readWorkers = 8
+	m.readBudget = 64
+
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(sc.Changes), 101)
+	for path, content := range files {
+		if path == "data.bin" {
+			continue
+		}
+		assert.Equal(t, sc.Changes[path], content)
+		assert.Equal(t, sc.Sizes[path], int64(len(content)))
+	}
+	assert.Equal(t, len(sc.BinaryFiles), 1)
+}
+
+func TestReadAllParallelError(t *testing.T) {
+	files := map[string]string{"main.py": "print('hello')"}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("lib/file_%d.py", i)] = "x = 1"
+	}
+	m := newTestManager(t, files)
+	m.readWorkers = 4
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "lib", "file_25.py")))
+
+	var mu sync.Mutex
+	read := 0
+	err := m.readParallel([]readJob{
+		{path: "main.py"},
+		{path: filepath.Join("lib", "file_25.py")},
+		{path: filepath.Join("lib", "file_1.py")},
+	}, func(job readJob, contents []byte) {
+		mu.Lock()
+		read++
+		mu.Unlock()
+	})
+	assert.ErrorContains(t, err, "file_25.py")
+	assert.Assert(t, os.IsNotExist(errors.Unwrap(err)))
+	assert.Assert(t, read <= 2)
+}
+
+func TestSetConcurrency(t *testing.T) {
+	files := map[string]string{"main.py": "print('hello')"}
+	var jobs []readJob
+	for i := 0; i < 50; i++ {
+		path := filepath.Join("lib", fmt.Sprintf("file_%d.py", i))
+		files[filepath.ToSlash(path)] = fmt.Sprintf("x = %d", i)
+		jobs = append(jobs, readJob{path: path})
+	}
+	m := newTestManager(t, files)
+
+	m.SetConcurrency(0)
+	assert.Equal(t, m.Concurrency(), goruntime.NumCPU())
+	m.SetConcurrency(-2)
+	assert.Equal(t, m.Concurrency(), 1)
+
+	// a single worker reads the files in order
+	m.SetConcurrency(1)
+	for run := 0; run < 3; run++ {
+		var order []string
+		err := m.readParallel(jobs, func(job readJob, contents []byte) {
+			order = append(order, job.path)
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(order), len(jobs))
+		for i, job := range jobs {
+			assert.Equal(t, order[i], job.path)
+		}
+	}
+
+	serial, err := m.readAll()
+	assert.NilError(t, err)
+	for _, n := range []int{2, 16} {
+		m.SetConcurrency(n)
+		sc, err := m.readAll()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, sc.Changes, serial.Changes)
+		assert.DeepEqual(t, sc.Sizes, serial.Sizes)
+	}
+}
+
+func TestByteBudget(t *testing.T) {
+	b := newByteBudget(10)
+	b.acquire(6)
+	acquired := make(chan struct{})
+	go func() {
+		b.acquire(6)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired more than the budget")
+	default:
+	}
+	b.release(6)
+	<-acquired
+
+	// larger than the budget is allowed when nothing else is in use
+	b.release(6)
+	b.acquire(100)
+	b.release(100)
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	files := map[string]string{"main.py": "print('hello')"}
+	for i := 0; i < 200; i++ {
+		files[filepath.Join("lib", fmt.Sprintf("file_%d.py", i))] = strings.Repeat("x = 1\n", 1000)
+	}
+	m := newTestManager(b, files)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.readAll(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
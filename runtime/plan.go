@@ -0,0 +1,91 @@
+package runtime
+
+import (
+	"errors"
+	"os"
+	"sort"
+)
+
+// actions of upload operations
+const (
+	// UploadCreate uploads a file that is not deployed
+	UploadCreate = "create"
+	// UploadUpdate uploads a file replacing the deployed file
+	UploadUpdate = "update"
+	// UploadDelete deletes a deployed file
+	UploadDelete = "delete"
+)
+
+// UploadOperation an operation on a file of the program performed by a deploy
+type UploadOperation struct {
+	Action string // UploadCreate, UploadUpdate or UploadDelete
+	Path   string // slash separated path relative to the root dir
+	Bytes  int64  // bytes of the contents sent, base64 encoded for binary files, 0 for deletions
+}
+
+// UploadPlan the operations a deploy of the changes of the files performs
+type UploadPlan struct {
+	Creates    int
+	Updates    int
+	Deletes    int
+	Bytes      int64             // total bytes of the contents sent
+	Operations []UploadOperation // creates, updates then deletes, each sorted by path
+}
+
+// IsEmpty checks if a deploy performs no operations
+func (p *UploadPlan) IsEmpty() bool {
+	return len(p.Operations) == 0
+}
+
+// PredictUploadActions gets the changes of the files like GetChanges and returns the operations of deploying them
+// changed files in the stored state are updates, others are creates, every file is a create if no state is stored
+// the state is not stored, returns an empty plan if nothing changed
+func (m *Manager) PredictUploadActions() (*UploadPlan, error) {
+	sc, err := m.GetChanges()
+	if err != nil {
+		return nil, err
+	}
+	plan := &UploadPlan{}
+	if sc == nil {
+		return plan, nil
+	}
+	storedState, err := m.getStoredState()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		storedState = make(stateMap)
+	}
+	keys := m.stateKeys(storedState)
+
+	var creates, updates []UploadOperation
+	add := func(path string, bytes int64) {
+		op := UploadOperation{Path: path, Bytes: bytes}
+		if _, ok := keys[m.stateKey(path)]; ok {
+			op.Action = UploadUpdate
+			updates = append(updates, op)
+		} else {
+			op.Action = UploadCreate
+			creates = append(creates, op)
+		}
+		plan.Bytes += bytes
+	}
+	for path, contents := range sc.Changes {
+		add(path, int64(len(contents)))
+	}
+	for path, encoded := range sc.BinaryFiles {
+		add(path, int64(len(encoded)))
+	}
+	for _, ops := range [][]UploadOperation{creates, updates} {
+		sort.Slice(ops, func(i, j int) bool {
+			return ops[i].Path < ops[j].Path
+		})
+	}
+
+	plan.Operations = append(creates, updates...)
+	for _, path := range sc.Deletions {
+		plan.Operations = append(plan.Operations, UploadOperation{Action: UploadDelete, Path: path})
+	}
+	plan.Creates, plan.Updates, plan.Deletes = len(creates), len(updates), len(sc.Deletions)
+	return plan, nil
+}
@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPredictUploadActions(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"old.py":       "x = 1",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+
+	// every file is a create without a stored state
+	plan, err := m.PredictUploadActions()
+	assert.NilError(t, err)
+	assert.Equal(t, plan.Creates, 3)
+	assert.Equal(t, plan.Updates+plan.Deletes, 0)
+	assert.Equal(t, plan.Bytes, int64(len("print('hello')")+len("def f(): pass")+len("x = 1")))
+
+	assert.NilError(t, m.StoreState())
+	plan, err = m.PredictUploadActions()
+	assert.NilError(t, err)
+	assert.Assert(t, plan.IsEmpty())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":   "print('updated')",
+		"new.py":    "y = 2",
+		"image.bin": "\x00\x01\x02",
+	})
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "old.py")))
+	plan, err = m.PredictUploadActions()
+	assert.NilError(t, err)
+	binary := int64(len(base64.StdEncoding.EncodeToString([]byte("\x00\x01\x02"))))
+	assert.DeepEqual(t, plan, &UploadPlan{
+		Creates: 2,
+		Updates: 1,
+		Deletes: 1,
+		Bytes:   binary + int64(len("y = 2")+len("print('updated')")),
+		Operations: []UploadOperation{
+			{Action: UploadCreate, Path: "image.bin", Bytes: binary},
+			{Action: UploadCreate, Path: "new.py", Bytes: int64(len("y = 2"))},
+			{Action: UploadUpdate, Path: "main.py", Bytes: int64(len("print('updated')"))},
+			{Action: UploadDelete, Path: "old.py"},
+		},
+	})
+
+	// the state is not stored
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"image.bin", "main.py", "new.py"})
+}
@@ -0,0 +1,71 @@
+package runtime
+
+import (
+	"os"
+	"sync"
+)
+
+// ProgressFunc is called with the number of files processed and the total number of files to process
+type ProgressFunc func(done, total int)
+
+// SetProgress sets fn to be called after every file hashed or read by GetChanges, StoreState and readAll
+// eg: to show a progress bar, the total is counted by a walk before the files are processed
+// files created or deleted in between make the count drift, so the total is raised if done would exceed it
+// and lowered to done when finished, done never exceeds total and the last call has done equal to total
+// fn is called from one goroutine at a time with increasing done, nil disables progress
+func (m *Manager) SetProgress(fn ProgressFunc) {
+	m.progressFn = fn
+}
+
+// progress of processing the files of a walk
+type progress struct {
+	mu    sync.Mutex
+	fn    ProgressFunc
+	done  int
+	total int
+}
+
+// startProgress counts the files of the root dir for the progress of processing them
+// returns nil if progress is not reported, methods of a nil progress do nothing
+func (m *Manager) startProgress(runtime string) (*progress, error) {
+	if m.progressFn == nil {
+		return nil, nil
+	}
+	total := 0
+	err := m.walkFiles(runtime, func(path string, info os.FileInfo) error {
+		total++
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &progress{fn: m.progressFn, total: total}, nil
+}
+
+// step reports a processed file, the total is raised if files were created since they were counted
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if p.done > p.total {
+		p.total = p.done
+	}
+	p.fn(p.done, p.total)
+}
+
+// finish reports that all files are processed, the total is lowered if files were deleted since they were counted
+// or were not processed eg: files of unchanged dirs
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done < p.total {
+		p.total = p.done
+		p.fn(p.done, p.total)
+	}
+}
@@ -0,0 +1,104 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// walkHookFS calls onWalk before every walk of the root dir with the number of the walk starting at 1
+type walkHookFS struct {
+	FileSystem
+	root   string
+	walks  int
+	onWalk func(n int)
+}
+
+func (fs *walkHookFS) Walk(root string, fn filepath.WalkFunc) error {
+	if root == fs.root {
+		fs.walks++
+		fs.onWalk(fs.walks)
+	}
+	return fs.FileSystem.Walk(root, fn)
+}
+
+// fields are exported to be compared by assert.DeepEqual
+type progressCall struct {
+	Done, Total int
+}
+
+// records calls of the progress of m and checks that done increases by one and never exceeds total
+func recordProgress(t *testing.T, m *Manager) *[]progressCall {
+	var calls []progressCall
+	m.SetProgress(func(done, total int) {
+		if len(calls) > 0 {
+			last := calls[len(calls)-1]
+			assert.Assert(t, done == last.Done+1 || (done == last.Done && total < last.Total), "done %d after %v", done, last)
+		}
+		assert.Assert(t, done <= total, "done %d exceeds total %d", done, total)
+		calls = append(calls, progressCall{done, total})
+	})
+	return &calls
+}
+
+func TestProgress(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"lib/data.txt": "data",
+	})
+	calls := recordProgress(t, m)
+	assert.NilError(t, m.StoreState())
+	assert.DeepEqual(t, *calls, []progressCall{{1, 3}, {2, 3}, {3, 3}})
+
+	*calls = nil
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "print('updated')"})
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"main.py"})
+	assert.DeepEqual(t, *calls, []progressCall{{1, 3}, {2, 3}, {3, 3}})
+}
+
+func TestProgressDrift(t *testing.T) {
+	files := map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"lib/data.txt": "data",
+	}
+
+	t.Run("files created after counting", func(t *testing.T) {
+		m := newTestManager(t, files)
+		m.SetConcurrency(4)
+		m.fs = &walkHookFS{FileSystem: osFS{}, root: m.rootDir, onWalk: func(n int) {
+			// the first walk counts the files
+			if n == 2 {
+				writeTestFiles(t, m.rootDir, map[string]string{"a.py": "a", "b.py": "b", "lib/c.py": "c"})
+			}
+		}}
+		calls := recordProgress(t, m)
+		sc, err := m.readAll()
+		assert.NilError(t, err)
+		assert.Equal(t, len(sc.Changes), 6)
+		assert.Equal(t, len(*calls), 6)
+		assert.Equal(t, (*calls)[0].Total, 3)
+		assert.Equal(t, (*calls)[5], progressCall{6, 6})
+	})
+
+	t.Run("files deleted after counting", func(t *testing.T) {
+		m := newTestManager(t, files)
+		assert.NilError(t, m.StoreState())
+		m.fs = &walkHookFS{FileSystem: osFS{}, root: m.rootDir, onWalk: func(n int) {
+			if n == 2 {
+				assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "lib", "data.txt")))
+			}
+		}}
+		calls := recordProgress(t, m)
+		sc, err := m.GetChanges()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, sc.Deletions, []string{"lib/data.txt"})
+		// the total is lowered to done when finished
+		assert.DeepEqual(t, *calls, []progressCall{{1, 3}, {2, 3}, {2, 2}})
+	})
+}
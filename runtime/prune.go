@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// age after which a lock or a temp file of an atomic write in the deta dir is stale eg: after a crash
+var staleArtifactAge = 10 * time.Minute
+
+// PruneDetaDir removes stale artifacts of the deta dir and returns the names of the removed files in sorted order
+// stale artifacts are a lock and temp files of atomic writes eg: snapshot.tmp older than a threshold, and backups eg: state.bak, state~
+// program info, state and other files are never removed
+func (m *Manager) PruneDetaDir() ([]string, error) {
+	entries, err := m.fs.ReadDir(m.detaPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var pruned []string
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || !isStaleArtifact(e) {
+			continue
+		}
+		m.debugf("removing stale %s", e.Name())
+		err = m.fs.Remove(filepath.Join(m.detaPath, e.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return pruned, err
+		}
+		pruned = append(pruned, e.Name())
+	}
+	sort.Strings(pruned)
+	return pruned, nil
+}
+
+// if a file of the deta dir is a stale artifact
+func isStaleArtifact(info os.FileInfo) bool {
+	name := info.Name()
+	switch name {
+	// files of the state are never stale
+	case progInfoFile, stateFile, stateSumFile, modesFile, dirsFile, digestsFile, snapshotFile, configFile, userInfoFile, secretsFile:
+		return false
+	}
+	old := time.Since(info.ModTime()) > staleArtifactAge
+	switch {
+	case name == lockFile, strings.HasSuffix(name, ".tmp"):
+		return old
+	case strings.HasSuffix(name, ".bak"), strings.HasSuffix(name, "~"):
+		return true
+	}
+	return false
+}
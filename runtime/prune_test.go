@@ -0,0 +1,46 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPruneDetaDir(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": "print('hello')"})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.detaPath, map[string]string{
+		lockFile:       "",
+		"snapshot.tmp": "partial",
+		"state.tmp":    "partial",
+		"state.bak":    "{}",
+		"state~":       "{}",
+		"notes.txt":    "kept",
+	})
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{lockFile, "snapshot.tmp"} {
+		assert.NilError(t, os.Chtimes(filepath.Join(m.detaPath, name), old, old))
+	}
+
+	pruned, err := m.PruneDetaDir()
+	assert.NilError(t, err)
+	// recent locks and temp files may be of a running process
+	assert.DeepEqual(t, pruned, []string{lockFile, "snapshot.tmp", "state.bak", "state~"})
+	for _, name := range []string{progInfoFile, stateFile, stateSumFile, "state.tmp", "notes.txt"} {
+		_, err := os.Stat(filepath.Join(m.detaPath, name))
+		assert.NilError(t, err, name)
+	}
+
+	// the live state is still read
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	pruned, err = m.PruneDetaDir()
+	assert.NilError(t, err)
+	assert.Assert(t, pruned == nil)
+}
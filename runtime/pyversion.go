@@ -0,0 +1,131 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	pythonVersionFile = ".python-version"
+	runtimeTxtFile    = "runtime.txt"
+	pyprojectFile     = "pyproject.toml"
+)
+
+// matches a version number eg: 3, 3.9, 3.9.7
+var versionNumberRegexp = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// a python version read from a source file
+type pythonVersion struct {
+	source  string
+	version string
+}
+
+// DetectPythonVersion detects the python version of the program
+// from .python-version, runtime.txt, the requires section of Pipfile or the python constraint in pyproject.toml
+// the most specific version is used eg: 3.9.7 over 3.9, a warning is recorded if sources disagree
+// the version is stored in program info if present, returns an empty string if no source is present
+func (m *Manager) DetectPythonVersion() (string, error) {
+	versions, err := m.readPythonVersions()
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", nil
+	}
+
+	best := versions[0]
+	for _, v := range versions[1:] {
+		if len(strings.Split(v.version, ".")) > len(strings.Split(best.version, ".")) {
+			best = v
+		}
+	}
+	for _, v := range versions {
+		if !versionPrefix(v.version, best.version) {
+			var found []string
+			for _, v := range versions {
+				found = append(found, fmt.Sprintf("%s %s", v.source, v.version))
+			}
+			m.warn("python version sources disagree (%s), using %s from %s", strings.Join(found, ", "), best.version, best.source)
+			break
+		}
+	}
+
+	progInfo, err := m.GetProgInfo()
+	if err != nil {
+		return "", err
+	}
+	if progInfo != nil && progInfo.PythonVersion != best.version {
+		progInfo.PythonVersion = best.version
+		err = m.StoreProgInfo(progInfo)
+		if err != nil {
+			return "", err
+		}
+	}
+	return best.version, nil
+}
+
+// reads python versions from the present sources in order of .python-version, runtime.txt, Pipfile, pyproject.toml
+func (m *Manager) readPythonVersions() ([]pythonVersion, error) {
+	var versions []pythonVersion
+	add := func(source, value string) {
+		// eg: python-3.9.7, ^3.9, >=3.8,<4
+		if v := versionNumberRegexp.FindString(value); v != "" {
+			versions = append(versions, pythonVersion{source: source, version: v})
+		}
+	}
+
+	for _, f := range []string{pythonVersionFile, runtimeTxtFile} {
+		contents, err := m.readDepFile(f)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		lines, err := readLines(contents)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range lines {
+			if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+				add(f, l)
+				break
+			}
+		}
+	}
+
+	for _, f := range []string{pipfile, pyprojectFile} {
+		contents, err := m.readDepFile(f)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		tables, err := parseTOML(contents)
+		if err != nil {
+			return nil, invalidDepFile(f, contents, err)
+		}
+		var candidates []interface{}
+		if f == pipfile {
+			candidates = []interface{}{tables["requires"]["python_full_version"], tables["requires"]["python_version"]}
+		} else {
+			candidates = []interface{}{tables["tool.poetry.dependencies"]["python"], tables["project"]["requires-python"]}
+		}
+		for _, c := range candidates {
+			if s, ok := c.(string); ok {
+				add(f, s)
+				break
+			}
+		}
+	}
+	return versions, nil
+}
+
+// checks if the components of version a are a prefix of the components of version b eg: 3.9 of 3.9.7
+func versionPrefix(a, b string) bool {
+	return a == b || strings.HasPrefix(b, a+".")
+}
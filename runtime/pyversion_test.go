@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDetectPythonVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{"none", map[string]string{}, ""},
+		{"python-version", map[string]string{".python-version": "3.9.7\n"}, "3.9.7"},
+		{"runtime.txt", map[string]string{"runtime.txt": "python-3.8.12"}, "3.8.12"},
+		{"pipfile", map[string]string{"Pipfile": "[requires]\npython_version = \"3.9\"\n"}, "3.9"},
+		{"poetry", map[string]string{"pyproject.toml": "[tool.poetry.dependencies]\npython = \"^3.8\"\n"}, "3.8"},
+		{"project", map[string]string{"pyproject.toml": "[project]\nrequires-python = \">=3.7\"\n"}, "3.7"},
+		{"agreeing sources", map[string]string{".python-version": "3.9", "runtime.txt": "python-3.9.7"}, "3.9.7"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{"main.py": ""}
+			for k, v := range tc.files {
+				files[k] = v
+			}
+			m := newTestManager(t, files)
+			assert.NilError(t, m.StoreProgInfo(&ProgInfo{ID: "id"}))
+
+			version, err := m.DetectPythonVersion()
+			assert.NilError(t, err)
+			assert.Equal(t, version, tc.expected)
+			assert.Equal(t, len(m.Warnings()), 0)
+
+			progInfo, err := m.GetProgInfo()
+			assert.NilError(t, err)
+			assert.Equal(t, progInfo.PythonVersion, tc.expected)
+		})
+	}
+}
+
+func TestDetectPythonVersionConflict(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":         "",
+		".python-version": "3.8",
+		"Pipfile":         "[requires]\npython_full_version = \"3.9.7\"\n",
+	})
+	version, err := m.DetectPythonVersion()
+	assert.NilError(t, err)
+	assert.Equal(t, version, "3.9.7")
+	assert.DeepEqual(t, m.Warnings(), []string{"python version sources disagree (.python-version 3.8, Pipfile 3.9.7), using 3.9.7 from Pipfile"})
+}
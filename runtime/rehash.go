@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RehashPaths gets the changes of only the files at relPaths compared to the stored state without walking the root dir
+// eg: of the paths of events of a burst of editor saves in watch mode, the state is not stored but the changes can be passed to UpdateState
+// paths that do not exist, are ignored or are special files are deletions if they are stored, paths of dirs are skipped
+// checksums of the files are cached like GetChanges, returns the changes of all files if no state is stored
+func (m *Manager) RehashPaths(relPaths []string) (*StateChanges, error) {
+	storedState, err := m.getStoredState()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m.readAll()
+		}
+		return nil, err
+	}
+	storedModes, err := m.getStoredModes()
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &StateChanges{
+		Changes:     make(map[string]string),
+		BinaryFiles: make(map[string]string),
+		Sizes:       make(map[string]int64),
+		ModeChanges: make(map[string]os.FileMode),
+		BinaryPaths: make(map[string]bool),
+		Deletions:   []string{},
+	}
+	keys := m.stateKeys(storedState)
+	seen := make(map[string]bool)
+	for _, relPath := range relPaths {
+		abs, err := m.absPath(relPath)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.ToSlash(filepath.Clean(filepath.FromSlash(relPath)))
+		if seen[m.stateKey(path)] {
+			continue
+		}
+		seen[m.stateKey(path)] = true
+		storedPath, stored := keys[m.stateKey(path)]
+
+		info, err := m.fs.Stat(abs)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil && info.IsDir() {
+			m.debugf("skipping dir %s", path)
+			continue
+		}
+		if err != nil || isSpecialFile(info) || m.IsIgnored(path) {
+			if stored {
+				sc.Deletions = append(sc.Deletions, storedPath)
+			}
+			continue
+		}
+
+		alwaysUpload := m.isAlwaysUpload(filepath.FromSlash(path), info)
+		var checksum string
+		if alwaysUpload {
+			sc.AlwaysUpload = append(sc.AlwaysUpload, path)
+		} else {
+			checksum, _, err = m.hashFile(abs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !alwaysUpload && stored && storedState[storedPath] == checksum {
+			if m.modeChanged(storedModes, storedPath, info) {
+				sc.ModeChanges[path] = info.Mode().Perm()
+			}
+			continue
+		}
+
+		contents, isBinary, err := m.readFileIsBinary(abs)
+		if err != nil {
+			return nil, err
+		}
+		if isBinary {
+			sc.BinaryFiles[path] = base64.StdEncoding.EncodeToString(contents)
+		} else {
+			sc.Changes[path] = string(contents)
+		}
+		sc.Sizes[path] = int64(len(contents))
+		if m.isOversized(len(contents)) {
+			sc.OversizedFiles = append(sc.OversizedFiles, path)
+		}
+		if m.classifyBinary {
+			sc.BinaryPaths[path] = looksBinary(contents)
+		}
+	}
+	sort.Strings(sc.AlwaysUpload)
+	sort.Strings(sc.OversizedFiles)
+	sort.Strings(sc.Deletions)
+
+	if sc.isEmpty() {
+		return nil, nil
+	}
+	return sc, nil
+}
@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRehashPaths(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"lib/other.py": "x = 1",
+		"old.py":       "y = 2",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	assert.NilError(t, m.StoreState())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":      "print('updated')",
+		"lib/other.py": "x = 2",
+		"new.py":       "z = 3",
+	})
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "old.py")))
+
+	opens := countOpens(m)
+	sc, err := m.RehashPaths([]string{"main.py", "main.py", "lib/utils.py", "new.py", "old.py", "lib", "app.pyc"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Changes, map[string]string{
+		"main.py": "print('updated')",
+		"new.py":  "z = 3",
+	})
+	assert.DeepEqual(t, sc.Deletions, []string{"old.py"})
+	// only the supplied files are evaluated, unchanged files are not read again
+	assert.Equal(t, opens["lib/other.py"], 0)
+	assert.Equal(t, opens["lib/utils.py"], 0)
+	assert.Equal(t, opens["main.py"], 2)
+
+	// the changes update the stored state
+	assert.NilError(t, m.UpdateState(sc))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/other.py"})
+
+	sc, err = m.RehashPaths([]string{"main.py"})
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	_, err = m.RehashPaths([]string{"../outside.py"})
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,46 @@
+package runtime
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+const (
+	// default retries of file reads failing with transient errors
+	defaultRetries = 3
+	// default wait before the first retry, doubled for every retry
+	defaultRetryBackoff = 10 * time.Millisecond
+)
+
+// SetRetries sets how many times file reads failing with transient errors are retried eg: on network mounted dirs
+// the wait before the first retry is backoff and is doubled for every retry, 0 retries disables retrying
+// errors that are not transient eg: not exist, permission denied are not retried
+func (m *Manager) SetRetries(retries int, backoff time.Duration) {
+	m.retries = retries
+	m.retryBackoff = backoff
+}
+
+// isTransient checks if err is a transient error a retry can succeed after
+func isTransient(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EAGAIN, syscall.ETIMEDOUT, syscall.EINTR} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry calls fn until it does not fail with a transient error or the retries are exhausted
+func (m *Manager) retry(fn func() error) error {
+	backoff := m.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= m.retries || !isTransient(err) {
+			return err
+		}
+		m.debugf("retrying after %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,69 @@
+package runtime
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// opens files after failing failures times with err
+func failingOpen(failures int, err error, calls *int) func(name string) (io.ReadCloser, error) {
+	return func(name string) (io.ReadCloser, error) {
+		*calls++
+		if *calls <= failures {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		return os.Open(name)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": "print('hello')"})
+	m.SetRetries(3, time.Millisecond)
+	path := filepath.Join(m.rootDir, "main.py")
+
+	calls := 0
+	m.fs = openFS{osFS{}, failingOpen(2, syscall.EAGAIN, &calls)}
+	contents, err := m.readFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), "print('hello')")
+	assert.Equal(t, calls, 3)
+
+	// retries are exhausted
+	calls = 0
+	m.SetRetries(1, time.Millisecond)
+	m.fs = openFS{osFS{}, failingOpen(2, syscall.ETIMEDOUT, &calls)}
+	_, err = m.readFile(path)
+	assert.Assert(t, errors.Is(err, syscall.ETIMEDOUT))
+	assert.Equal(t, calls, 2)
+
+	// errors that are not transient are not retried
+	calls = 0
+	m.SetRetries(3, time.Millisecond)
+	m.fs = openFS{osFS{}, failingOpen(2, syscall.EACCES, &calls)}
+	_, err = m.readFile(path)
+	assert.Assert(t, errors.Is(err, os.ErrPermission))
+	assert.Equal(t, calls, 1)
+}
+
+func TestRetryGetChanges(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	m.SetRetries(2, time.Millisecond)
+	// calls are not counted concurrently
+	m.readWorkers = 1
+	calls := 0
+	m.fs = openFS{osFS{}, failingOpen(2, syscall.EAGAIN, &calls)}
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Equal(t, len(sc.Changes), 2)
+}
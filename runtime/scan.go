@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// depReader reads the deps of the program from dependency files
+// files in scanned are not read again eg: dependency files read by the walk of FullScan
+type depReader struct {
+	*Manager
+	scanned map[string][]byte // contents of dependency files by slash separated path relative to the root dir
+}
+
+// readDepFile reads a dependency file like Manager.readDepFile unless it's in scanned
+func (m depReader) readDepFile(name string) ([]byte, error) {
+	if contents, ok := m.scanned[filepath.ToSlash(name)]; ok {
+		return bytes.TrimPrefix(contents, utf8BOM), nil
+	}
+	return m.Manager.readDepFile(name)
+}
+
+// FullScan gets the changes of files and dependencies of the program like GetChanges and GetDepChanges
+// in a single walk of the root dir, dependency files read by the walk are not read again to get the dependency changes
+func (m *Manager) FullScan() (*StateChanges, *DepChanges, error) {
+	var mu sync.Mutex
+	scanned := make(map[string][]byte)
+	sc, err := m.getChanges(func(path string, info os.FileInfo, contents []byte) {
+		// contents of transformed files are not the contents of the dependency file
+		if m.transform != nil || !isAnyDepFile(path) {
+			return
+		}
+		mu.Lock()
+		scanned[path] = contents
+		mu.Unlock()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	dc, err := m.getDepChanges(depReader{Manager: m, scanned: scanned})
+	if err != nil {
+		return nil, nil, err
+	}
+	return sc, dc, nil
+}
+
+// checks if a path relative to the root dir is a file deps of any runtime are read from
+// so the runtime does not have to be known to keep dependency files read by the walk
+func isAnyDepFile(path string) bool {
+	for runtime := range depFiles {
+		if isDepFileOf(runtime, path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// counts files opened by m by name relative to the root dir
+func countOpens(m *Manager) map[string]int {
+	opens := make(map[string]int)
+	m.fs = openFS{osFS{}, func(name string) (io.ReadCloser, error) {
+		if rel, err := filepath.Rel(m.rootDir, name); err == nil {
+			opens[filepath.ToSlash(rel)]++
+		}
+		return os.Open(name)
+	}}
+	return opens
+}
+
+func TestFullScan(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "flask==2.0.1\n",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+	m.SetConcurrency(1)
+
+	opens := countOpens(m)
+	sc, dc, err := m.FullScan()
+	assert.NilError(t, err)
+	assert.Equal(t, sc.Changes["requirements.txt"], "flask==2.0.1\n")
+	assert.DeepEqual(t, dc.Added, []string{"flask==2.0.1"})
+	assert.Equal(t, opens["requirements.txt"], 1)
+
+	// the same changes as getting them separately
+	wantChanges, err := m.GetChanges()
+	assert.NilError(t, err)
+	wantDeps, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Changes, wantChanges.Changes)
+	assert.DeepEqual(t, dc, wantDeps)
+	assert.Equal(t, opens["requirements.txt"], 3)
+
+	// the changed dependency file is read by the walk only
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{"requirements.txt": "flask==2.0.1\nrequests==2.28.0\n"})
+	before := opens["requirements.txt"]
+	sc, dc, err = m.FullScan()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Changes, map[string]string{"requirements.txt": "flask==2.0.1\nrequests==2.28.0\n"})
+	assert.DeepEqual(t, dc.Added, []string{"flask==2.0.1", "requests==2.28.0"})
+	// read once by the walk, not read again for the changes or the dependency changes
+	assert.Equal(t, opens["requirements.txt"], before+1)
+}
+
+func TestFullScanConcurrent(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "flask==2.0.1\n",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, dc, err := m.FullScan()
+			if err == nil && len(dc.Added) != 1 {
+				err = fmt.Errorf("added deps %v", dc.Added)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NilError(t, err)
+	}
+}
+
+func benchmarkScanManager(b *testing.B) (*Manager, map[string]int) {
+	files := map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": strings.Repeat("flask==2.0.1\n", 100),
+	}
+	for i := 0; i < 200; i++ {
+		files[filepath.Join("lib", fmt.Sprintf("file_%d.py", i))] = strings.Repeat("x = 1\n", 100)
+	}
+	m := newTestManager(b, files)
+	// opens are counted by a single reader
+	m.SetConcurrency(1)
+	if err := m.StoreProgInfo(&ProgInfo{Runtime: "python3.9"}); err != nil {
+		b.Fatal(err)
+	}
+	return m, countOpens(m)
+}
+
+func reportOpens(b *testing.B, opens map[string]int) {
+	total := 0
+	for _, n := range opens {
+		total += n
+	}
+	b.ReportMetric(float64(total)/float64(b.N), "opens/op")
+}
+
+func BenchmarkFullScan(b *testing.B) {
+	m, opens := benchmarkScanManager(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := m.FullScan(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportOpens(b, opens)
+}
+
+func BenchmarkSeparateScans(b *testing.B) {
+	m, opens := benchmarkScanManager(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.GetChanges(); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := m.GetDepChanges(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportOpens(b, opens)
+}
@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// replaces redacted values
+const redactedValue = "***"
+
+// redactRule redacts values matching value in files with paths matching glob
+type redactRule struct {
+	glob  string
+	value *regexp.Regexp
+}
+
+// readRedactRules reads the redaction rules of the secrets file in the deta dir, no rules if the file is absent
+// every line is a glob of paths relative to the root dir and a regexp of values separated by whitespace
+// eg: .env* =(.+) , globs without a slash match file names in any dir, empty lines and lines starting with # are skipped
+func (m *Manager) readRedactRules() ([]redactRule, error) {
+	contents, err := m.readFile(filepath.Join(m.detaPath, secretsFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	lines, err := readLines(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []redactRule
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		sep := strings.IndexAny(l, " \t")
+		if sep < 0 {
+			return nil, fmt.Errorf("reading %s: line %d: expected a glob and a regexp of values", secretsFile, i+1)
+		}
+		glob := l[:sep]
+		if _, err := matchGlob(glob, ""); err != nil {
+			return nil, fmt.Errorf("reading %s: line %d: invalid glob '%s': %w", secretsFile, i+1, glob, err)
+		}
+		value, err := regexp.Compile(strings.TrimSpace(l[sep:]))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: line %d: %w", secretsFile, i+1, err)
+		}
+		rules = append(rules, redactRule{glob: glob, value: value})
+	}
+	return rules, nil
+}
+
+// redact replaces values of contents of the file in the slash separated path matched by rules with ***
+// if a regexp has groups, only the first group of a match is replaced eg: the value of KEY=(.+)
+// returns if values were replaced
+func redact(rules []redactRule, path, contents string) (string, bool) {
+	redacted := false
+	for _, r := range rules {
+		name := path
+		if !strings.Contains(r.glob, "/") {
+			name = filepath.Base(filepath.FromSlash(path))
+		}
+		if ok, _ := matchGlob(r.glob, name); !ok {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, match := range r.value.FindAllStringSubmatchIndex(contents, -1) {
+			start, end := match[0], match[1]
+			if len(match) > 2 && match[2] >= 0 {
+				start, end = match[2], match[3]
+			}
+			if start == end {
+				continue
+			}
+			b.WriteString(contents[last:start])
+			b.WriteString(redactedValue)
+			last = end
+			redacted = true
+		}
+		b.WriteString(contents[last:])
+		contents = b.String()
+	}
+	return contents, redacted
+}
@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const snapshotFile = "snapshot"
+
+var (
+	// maxSnapshotSize max total size in bytes of files stored in a snapshot
+	maxSnapshotSize int64 = 50 << 20
+
+	// ErrSnapshotTooLarge files are too large to store in a snapshot
+	ErrSnapshotTooLarge = errors.New("files are too large for a snapshot")
+	// ErrNoSnapshot no snapshot is stored
+	ErrNoSnapshot = errors.New("no snapshot stored")
+)
+
+// SnapshotContents stores the contents of all files(not hidden) in the root program directory in .deta/snapshot
+// so they can be restored with Revert, returns ErrSnapshotTooLarge if the files are larger than the size cap
+func (m *Manager) SnapshotContents() error {
+	stats, err := m.Stats()
+	if err != nil {
+		return err
+	}
+	if stats.TotalBytes > maxSnapshotSize {
+		return fmt.Errorf("%w: %d bytes, max %d bytes", ErrSnapshotTooLarge, stats.TotalBytes, maxSnapshotSize)
+	}
+
+	snapshotPath := filepath.Join(m.detaPath, snapshotFile)
+	tmpPath := snapshotPath + ".tmp"
+	f, err := m.fs.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePermMode)
+	if err != nil {
+		return err
+	}
+	err = m.ArchiveTo(f)
+	if err != nil {
+		f.Close()
+		m.fs.Remove(tmpPath)
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		m.fs.Remove(tmpPath)
+		return err
+	}
+	// replaced at once so a failed snapshot does not corrupt the previous one
+	return m.fs.Rename(tmpPath, snapshotPath)
+}
+
+// Revert restores the files of the root program directory from the snapshot stored by SnapshotContents
+// changed and deleted files are restored and files created since the snapshot are removed
+// hidden and ignored files are not changed
+func (m *Manager) Revert() error {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return err
+	}
+
+	f, err := m.fs.Open(filepath.Join(m.detaPath, snapshotFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoSnapshot
+		}
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	tr := tar.NewReader(gr)
+
+	restored := make(map[string]struct{})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+
+		dest := filepath.Join(m.rootDir, filepath.FromSlash(hdr.Name))
+		// check for paths outside of the root dir
+		if !strings.HasPrefix(dest, filepath.Clean(m.rootDir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path '%s' in snapshot", hdr.Name)
+		}
+		err = m.restoreFile(dest, tr, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		restored[hdr.Name] = struct{}{}
+	}
+
+	// remove files created since the snapshot
+	var created []string
+	err = m.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if _, ok := restored[slash]; !ok {
+			created = append(created, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, path := range created {
+		m.debugf("removing %s created since the snapshot", path)
+		err = m.fs.Remove(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writes the contents of r to dest with mode
+func (m *Manager) restoreFile(dest string, r io.Reader, mode os.FileMode) error {
+	err := m.fs.MkdirAll(filepath.Dir(dest), dirPermMode)
+	if err != nil {
+		return err
+	}
+	f, err := m.fs.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	// the mode of an existing file is not changed by OpenFile
+	return m.fs.Chmod(dest, mode)
+}
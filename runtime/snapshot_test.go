@@ -0,0 +1,55 @@
+package runtime
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRevert(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"data.bin":     "\x00\x01\x02",
+		".env":         "KEY=VALUE",
+	})
+	assert.Assert(t, errors.Is(m.Revert(), ErrNoSnapshot))
+	assert.NilError(t, m.SnapshotContents())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":    "print('broken')",
+		"new.py":     "x = 1",
+		"lib/new.py": "y = 2",
+		".env":       "KEY=CHANGED",
+	})
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "lib", "utils.py")))
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "data.bin")))
+
+	assert.NilError(t, m.Revert())
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.Changes, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	assert.DeepEqual(t, changedPaths(sc), []string{"data.bin", "lib/utils.py", "main.py"})
+
+	// hidden files are not reverted
+	contents, err := ioutil.ReadFile(filepath.Join(m.rootDir, ".env"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), "KEY=CHANGED")
+}
+
+func TestSnapshotTooLarge(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": "print('hello')"})
+	defer func(size int64) { maxSnapshotSize = size }(maxSnapshotSize)
+	maxSnapshotSize = 4
+
+	assert.Assert(t, errors.Is(m.SnapshotContents(), ErrSnapshotTooLarge))
+	_, err := os.Stat(filepath.Join(m.detaPath, snapshotFile))
+	assert.Assert(t, os.IsNotExist(err))
+}
@@ -0,0 +1,34 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSkipSpecialFiles(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py": "print('hello')",
+	})
+	assert.NilError(t, syscall.Mkfifo(filepath.Join(m.rootDir, "pipe"), 0644))
+	assert.NilError(t, os.Symlink("pipe", filepath.Join(m.rootDir, "link")))
+
+	// opening the pipe would block without a writer
+	sc, err := m.readAll()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.SkippedSpecial, []string{"link", "pipe"})
+	assert.DeepEqual(t, changedPaths(sc), []string{"main.py"})
+
+	assert.NilError(t, m.StoreState())
+	writeTestFiles(t, m.rootDir, map[string]string{"main.py": "print('updated')"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.SkippedSpecial, []string{"link", "pipe"})
+	assert.DeepEqual(t, changedPaths(sc), []string{"main.py"})
+}
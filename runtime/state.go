@@ -1,10 +1,72 @@
 package runtime
 
-import "encoding/json"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// prefix of keys of paths that are not valid utf-8, as json strings can only hold valid utf-8
+// paths can not contain a null byte, so keys with the prefix do not conflict with other paths
+const rawPathPrefix = "\x00base64:"
+
+// encodes path as a key of a json object
+func encodePathKey(path string) string {
+	if utf8.ValidString(path) {
+		return path
+	}
+	return rawPathPrefix + base64.StdEncoding.EncodeToString([]byte(path))
+}
+
+// decodes a key of a json object encoded by encodePathKey
+func decodePathKey(key string) (string, error) {
+	if !strings.HasPrefix(key, rawPathPrefix) {
+		return key, nil
+	}
+	path, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(key, rawPathPrefix))
+	if err != nil {
+		return "", err
+	}
+	return string(path), nil
+}
 
 // map filepath to checksum
 type stateMap map[string]string
 
+// MarshalJSON encodes paths that are not valid utf-8 so they are not replaced with the unicode replacement character
+func (s stateMap) MarshalJSON() ([]byte, error) {
+	encoded := make(map[string]string, len(s))
+	for path, checksum := range s {
+		encoded[encodePathKey(path)] = checksum
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes paths encoded by MarshalJSON
+func (s *stateMap) UnmarshalJSON(data []byte) error {
+	var encoded map[string]string
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return err
+	}
+	if encoded == nil {
+		*s = nil
+		return nil
+	}
+	*s = make(stateMap, len(encoded))
+	for key, checksum := range encoded {
+		path, err := decodePathKey(key)
+		if err != nil {
+			return err
+		}
+		(*s)[path] = checksum
+	}
+	return nil
+}
+
 // unmarshals data into a stateMap
 func stateMapFromBytes(data []byte) (stateMap, error) {
 	var s stateMap
@@ -15,9 +77,143 @@ func stateMapFromBytes(data []byte) (stateMap, error) {
 	return s, nil
 }
 
+// map filepath to permissions of the file
+type modeMap map[string]os.FileMode
+
+// MarshalJSON encodes paths like stateMap
+func (mm modeMap) MarshalJSON() ([]byte, error) {
+	encoded := make(map[string]os.FileMode, len(mm))
+	for path, mode := range mm {
+		encoded[encodePathKey(path)] = mode
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes paths encoded by MarshalJSON
+func (mm *modeMap) UnmarshalJSON(data []byte) error {
+	var encoded map[string]os.FileMode
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return err
+	}
+	if encoded == nil {
+		*mm = nil
+		return nil
+	}
+	*mm = make(modeMap, len(encoded))
+	for key, mode := range encoded {
+		path, err := decodePathKey(key)
+		if err != nil {
+			return err
+		}
+		(*mm)[path] = mode
+	}
+	return nil
+}
+
+// unmarshals data into a modeMap
+func modeMapFromBytes(data []byte) (modeMap, error) {
+	var m modeMap
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // StateChanges changes in state of files of the root directory
+// paths are relative to the root directory and use forward slashes eg: lib/utils.py
 type StateChanges struct {
-	Changes   map[string]string // map of files to content
-	Deletions []string
+	Changes     map[string]string // map of files to content
+	Deletions   []string          // sorted paths of deleted files
 	BinaryFiles map[string]string
+	Sizes       map[string]int64       // map of changed files to size in bytes
+	ModeChanges map[string]os.FileMode // map of files that changed only in permissions to new permissions, if modes are tracked
+	// files that are always uploaded without comparing checksums, also present in Changes or BinaryFiles
+	AlwaysUpload []string
+	// sorted paths of created and deleted empty dirs, if empty dirs are tracked
+	EmptyDirs        []string
+	DeletedEmptyDirs []string
+	// map of changed files to whether they look binary by a null byte or invalid utf-8, if binary paths are classified
+	// eg: to not log diffs of binary files
+	BinaryPaths map[string]bool
+	// sorted paths of changed files larger than the max file size, the files are also in Changes or BinaryFiles
+	OversizedFiles []string
+	// paths of symlinks to missing targets that are skipped, not considered a change on their own
+	BrokenLinks []string
+	// paths of named pipes, sockets and devices or links to them that are skipped, not considered a change on their own
+	SkippedSpecial []string
+	// map of new or changed hard links to the path of the file they link to which is read instead, if hard links are deduplicated
+	// the links are uploaded from the contents of the file they link to
+	Hardlinks map[string]string
+	// map of sha256 digests of contents to the paths of changed files with the contents in walk order, if contents are deduplicated
+	// only contents of more than one file, the first path is the canonical path to upload the contents from
+	Duplicates map[string][]string
+	// sorted paths of files in Changes or BinaryFiles with different contents in the compared root dir, set by CompareWith
+	Differing []string
+}
+
+// records path as a hard link to orig
+func (sc *StateChanges) addHardlink(path, orig string) {
+	if sc.Hardlinks == nil {
+		sc.Hardlinks = make(map[string]string)
+	}
+	sc.Hardlinks[path] = orig
+}
+
+// records path as a skipped broken link or special file
+func (sc *StateChanges) addSkipped(path string, special bool) {
+	if special {
+		sc.SkippedSpecial = append(sc.SkippedSpecial, path)
+		return
+	}
+	sc.BrokenLinks = append(sc.BrokenLinks, path)
+}
+
+// ChangeKind kind of contents of a changed file
+type ChangeKind string
+
+const (
+	// ChangeText a changed file in Changes
+	ChangeText ChangeKind = "text"
+	// ChangeBinary a changed file in BinaryFiles
+	ChangeBinary ChangeKind = "binary"
+)
+
+// FileChange a changed or created file
+type FileChange struct {
+	Path string
+	Size int64 // size in bytes
+	Kind ChangeKind
+}
+
+// SortedBySize returns the changed and created files largest first eg: to spot big files added by accident
+// files of the same size are sorted by path, deletions are not included as they have no size, see Deletions
+func (sc *StateChanges) SortedBySize() []FileChange {
+	files := make([]FileChange, 0, len(sc.Changes)+len(sc.BinaryFiles))
+	size := func(path string, n int) int64 {
+		if s, ok := sc.Sizes[path]; ok {
+			return s
+		}
+		return int64(n)
+	}
+	for path, content := range sc.Changes {
+		files = append(files, FileChange{Path: path, Size: size(path, len(content)), Kind: ChangeText})
+	}
+	for path, encoded := range sc.BinaryFiles {
+		files = append(files, FileChange{Path: path, Size: size(path, base64.StdEncoding.DecodedLen(len(encoded))), Kind: ChangeBinary})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// isEmpty checks if there are no changes
+func (sc *StateChanges) isEmpty() bool {
+	return len(sc.Changes) == 0 && len(sc.Deletions) == 0 && len(sc.BinaryFiles) == 0 &&
+		len(sc.ModeChanges) == 0 && len(sc.EmptyDirs) == 0 && len(sc.DeletedEmptyDirs) == 0 && len(sc.Hardlinks) == 0
 }
@@ -0,0 +1,165 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStateSpecialPaths(t *testing.T) {
+	files := map[string]string{
+		"main.py":                "print('hello')",
+		"my file (1).py":         "a = 1",
+		"new\nline.txt":          "b",
+		"quote\"back\\slash.txt": "c",
+		"ünï cödé/日本語.txt":       "d",
+		"tab\tand separator.md":  "e",
+	}
+	m := newTestManager(t, files)
+	assert.NilError(t, m.StoreState())
+
+	sm, err := m.getStoredState()
+	assert.NilError(t, err)
+	assert.Equal(t, len(sm), len(files))
+	for path := range files {
+		_, ok := sm[path]
+		assert.Assert(t, ok, "%q is not stored", path)
+	}
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil, "unexpected changes: %+v", sc)
+}
+
+func TestStateMapJSON(t *testing.T) {
+	sm := stateMap{"a.txt": "1", "caf\xe9": "2"}
+	data, err := sm.MarshalJSON()
+	assert.NilError(t, err)
+	decoded, err := stateMapFromBytes(data)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, decoded, sm)
+
+	mm := modeMap{"caf\xe9": 0755}
+	data, err = mm.MarshalJSON()
+	assert.NilError(t, err)
+	decodedModes, err := modeMapFromBytes(data)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, decodedModes, mm)
+}
+
+func TestCorruptState(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+	})
+	assert.NilError(t, m.StoreState())
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// a valid map that was edited
+	sm, err := m.getStoredState()
+	assert.NilError(t, err)
+	sm["main.py"] = sm["lib/utils.py"]
+	marshalled, err := json.Marshal(sm)
+	assert.NilError(t, err)
+	assert.NilError(t, ioutil.WriteFile(m.statePath, marshalled, filePermMode))
+
+	_, err = m.getStoredState()
+	assert.Assert(t, errors.Is(err, ErrCorruptState))
+	var corrupt *CorruptStateError
+	assert.Assert(t, errors.As(err, &corrupt))
+	assert.Equal(t, corrupt.Path, m.statePath)
+
+	// all files are read again
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changedPaths(sc), []string{"lib/utils.py", "main.py"})
+	hasChanges, err := m.HasChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, hasChanges)
+	errs := m.Validate()
+	assert.Equal(t, len(errs), 1)
+	assert.Assert(t, errors.Is(errs[0], ErrCorruptState))
+
+	// storing the state again recovers
+	assert.NilError(t, m.UpdateState(sc))
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil)
+
+	// states stored without a checksum are read
+	assert.NilError(t, os.Remove(filepath.Join(m.detaPath, stateSumFile)))
+	_, err = m.getStoredState()
+	assert.NilError(t, err)
+}
+
+func TestSortedBySize(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"old.py":       "x = 1",
+	})
+	assert.NilError(t, m.StoreState())
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "old.py")))
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":     "print('hello world')",
+		"data.bin":    strings.Repeat("\x00", 100),
+		"a.py":        "y = 2",
+		"b.py":        "z = 3",
+		"assets.json": `{"big": "` + strings.Repeat("a", 50) + `"}`,
+	})
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, sc.SortedBySize(), []FileChange{
+		{Path: "data.bin", Size: 100, Kind: ChangeBinary},
+		{Path: "assets.json", Size: 61, Kind: ChangeText},
+		{Path: "main.py", Size: 20, Kind: ChangeText},
+		{Path: "a.py", Size: 5, Kind: ChangeText},
+		{Path: "b.py", Size: 5, Kind: ChangeText},
+	})
+	assert.DeepEqual(t, sc.Deletions, []string{"old.py"})
+}
+
+func TestStateAge(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": "print('hello')"})
+	_, err := m.StateAge()
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	stale, _, err := m.IsStateStale()
+	assert.NilError(t, err)
+	assert.Assert(t, !stale)
+
+	assert.NilError(t, m.StoreState())
+	old := time.Now().Add(-45 * 24 * time.Hour)
+	assert.NilError(t, os.Chtimes(m.statePath, old, old))
+	age, err := m.StateAge()
+	assert.NilError(t, err)
+	assert.Assert(t, age >= 45*24*time.Hour && age < 45*24*time.Hour+time.Minute, age)
+
+	stale, staleAge, err := m.IsStateStale()
+	assert.NilError(t, err)
+	assert.Assert(t, stale)
+	assert.Assert(t, staleAge >= 45*24*time.Hour)
+
+	// changes against a stale state are warned about
+	_, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m.Warnings(), []string{"the stored state is 45 days old, consider syncing the program before deploying"})
+
+	m.SetStaleStateAge(60 * 24 * time.Hour)
+	stale, _, err = m.IsStateStale()
+	assert.NilError(t, err)
+	assert.Assert(t, !stale)
+	m.SetStaleStateAge(0)
+	stale, _, err = m.IsStateStale()
+	assert.NilError(t, err)
+	assert.Assert(t, !stale)
+}
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ProjectStats counts of the files of the root program directory
+type ProjectStats struct {
+	FileCount    int   // files that are not skipped
+	DirCount     int   // dirs that are not skipped except the root dir
+	TotalBytes   int64 // size of files that are not skipped
+	IgnoredCount int   // skipped files and dirs, files in skipped dirs are not counted
+	Hardlinks    int   // hard links to files counted before, if hard links are deduplicated
+}
+
+// Stats counts the files, dirs and bytes of the root program directory in a single walk
+// hidden and ignored files are counted as ignored
+func (m *Manager) Stats() (*ProjectStats, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats ProjectStats
+	links := m.newHardlinks()
+	err = m.walkAll(r.Name, func(path string, info os.FileInfo) error {
+		if info.IsDir() {
+			stats.DirCount++
+			return nil
+		}
+		if _, ok := links.original(path, info); ok {
+			stats.Hardlinks++
+			return nil
+		}
+		stats.FileCount++
+		stats.TotalBytes += info.Size()
+		return nil
+	}, func(path string, info os.FileInfo, reason string) {
+		stats.IgnoredCount++
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// TrackedSize returns the total size in bytes of the files that are read on changes, without reading the files
+// symlinks to files count the size of their targets, hard links to files counted before are not counted if hard links are deduplicated
+func (m *Manager) TrackedSize() (int64, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	links := m.newHardlinks()
+	err = m.walkFiles(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if _, ok := links.original(slash, info); ok {
+			return nil
+		}
+		// symlinks to files are read from their targets
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := m.fs.Stat(filepath.Join(m.rootDir, path))
+			if err != nil {
+				return err
+			}
+			info = target
+		}
+		size += info.Size()
+		return nil
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
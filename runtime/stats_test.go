@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStats(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":              "print('hello')",
+		"lib/utils.py":         "def f(): pass",
+		"lib/nested/data.txt":  "data",
+		".env":                 "KEY=VALUE",
+		"__pycache__/main.pyc": "cache",
+		"lib/cache.pyc":        "cache",
+		".detaignore":          "docs",
+		"docs/index.md":        "docs",
+		"docs/more.md":         "docs",
+	})
+	m, err := NewManager(&m.rootDir, true)
+	assert.NilError(t, err)
+
+	stats, err := m.Stats()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, stats, &ProjectStats{
+		FileCount:  4,
+		DirCount:   2,
+		TotalBytes: int64(len("print('hello')") + len("def f(): pass") + len("data") + len("docs")),
+		// .deta, .env, __pycache__, lib/cache.pyc, docs
+		IgnoredCount: 5,
+	})
+}
+
+func TestTrackedSize(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":             "print('hello')",
+		"lib/utils.py":        "def f(): pass",
+		"lib/nested/data.txt": "data",
+		".env":                "KEY=VALUE",
+		"lib/cache.pyc":       "cache",
+		".detaignore":         "docs",
+		"docs/index.md":       "docs",
+	})
+	assert.NilError(t, os.Symlink("main.py", filepath.Join(m.rootDir, "link.py")))
+
+	var opened []string
+	m.fs = openFS{osFS{}, func(name string) (io.ReadCloser, error) {
+		opened = append(opened, name)
+		return os.Open(name)
+	}}
+	size, err := m.TrackedSize()
+	assert.NilError(t, err)
+	// main.py and its link, lib/utils.py, lib/nested/data.txt and .detaignore
+	assert.Equal(t, size, int64(2*len("print('hello')")+len("def f(): pass")+len("data")+len("docs")))
+	// only the program info is read to get the runtime
+	for _, name := range opened {
+		assert.Equal(t, filepath.Dir(name), m.detaPath)
+	}
+}
@@ -0,0 +1,22 @@
+package runtime
+
+// ChangeSummary changes of files and dependencies of the program
+type ChangeSummary struct {
+	Files *StateChanges // nil if no files changed
+	Deps  *DepChanges   // nil if no dependencies changed
+}
+
+// IsEmpty checks if neither files nor dependencies changed
+func (cs *ChangeSummary) IsEmpty() bool {
+	return cs.Files == nil && cs.Deps == nil
+}
+
+// Summary gets the changes of files and dependencies of the program like GetChanges and GetDepChanges
+// the runtime is detected once and the root dir is walked once for both, see FullScan
+func (m *Manager) Summary() (*ChangeSummary, error) {
+	sc, dc, err := m.FullScan()
+	if err != nil {
+		return nil, err
+	}
+	return &ChangeSummary{Files: sc, Deps: dc}, nil
+}
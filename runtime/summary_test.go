@@ -0,0 +1,36 @@
+package runtime
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSummary(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "requests==2.25.1\n",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{RuntimeName: Python, Runtime: "python3.9", Deps: []string{"requests==2.25.1"}}))
+	assert.NilError(t, m.StoreState())
+
+	cs, err := m.Summary()
+	assert.NilError(t, err)
+	assert.Assert(t, cs.IsEmpty())
+
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py":          "print('changed')",
+		"requirements.txt": "requests==2.25.1\nflask==2.0.1\n",
+	})
+	cs, err = m.Summary()
+	assert.NilError(t, err)
+	assert.Assert(t, !cs.IsEmpty())
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	dc, err := m.GetDepChanges()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cs.Files, sc)
+	assert.DeepEqual(t, cs.Deps, dc)
+	assert.DeepEqual(t, cs.Deps.Added, []string{"flask==2.0.1"})
+}
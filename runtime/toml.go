@@ -0,0 +1,51 @@
+package runtime
+
+import "github.com/BurntSushi/toml"
+
+// tomlTables maps table names eg: packages, tool.poetry.dependencies to the keys and values of the table
+// keys outside of any table are in the table with an empty name
+// values are decoded as by toml.Decode into an interface{} eg: string, int64, []interface{} or map[string]interface{}
+// sub tables are values of their parent table and tables themselves eg: dependencies.serde is the serde key of dependencies
+// of an array of tables eg: [[bin]], the keys of all the tables are in the table, later tables take precedence
+type tomlTables map[string]map[string]interface{}
+
+// parseTOML parses the tables of a toml document
+func parseTOML(contents []byte) (tomlTables, error) {
+	var doc map[string]interface{}
+	_, err := toml.Decode(string(contents), &doc)
+	if err != nil {
+		return nil, err
+	}
+	tables := tomlTables{"": doc}
+	addTOMLTables(tables, "", doc)
+	return tables, nil
+}
+
+// adds the sub tables of the table named name to tables
+func addTOMLTables(tables tomlTables, name string, table map[string]interface{}) {
+	for key, value := range table {
+		subName := key
+		if name != "" {
+			subName = name + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			mergeTOMLTable(tables, subName, v)
+			addTOMLTables(tables, subName, v)
+		case []map[string]interface{}:
+			for _, t := range v {
+				mergeTOMLTable(tables, subName, t)
+				addTOMLTables(tables, subName, t)
+			}
+		}
+	}
+}
+
+func mergeTOMLTable(tables tomlTables, name string, table map[string]interface{}) {
+	if tables[name] == nil {
+		tables[name] = make(map[string]interface{}, len(table))
+	}
+	for k, v := range table {
+		tables[name][k] = v
+	}
+}
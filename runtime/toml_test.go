@@ -0,0 +1,55 @@
+package runtime
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseTOML(t *testing.T) {
+	doc := `# comment
+title = "app" # trailing comment
+
+[packages]
+requests = "*"
+"flask" = '==2.0.1'
+django = {version = ">=3.0", extras = ["bcrypt"]}
+
+[project]
+dependencies = [
+    "httpx>=0.23",  # http
+    'rich',
+]
+description = """
+multi
+line"""
+port = 8080
+
+[tool.poetry]
+name = "app"
+dependencies.requests = "^2.28"
+"key=with=equals" = "value"
+
+[[bin]]
+name = "app"
+`
+	tables, err := parseTOML([]byte(doc))
+	assert.NilError(t, err)
+	assert.Equal(t, tables[""]["title"], "app")
+	assert.Equal(t, tables["packages"]["requests"], "*")
+	assert.Equal(t, tables["packages"]["flask"], "==2.0.1")
+	assert.DeepEqual(t, tables["packages"]["django"], map[string]interface{}{
+		"version": ">=3.0",
+		"extras":  []interface{}{"bcrypt"},
+	})
+	assert.DeepEqual(t, tables["project"]["dependencies"], []interface{}{"httpx>=0.23", "rich"})
+	assert.Equal(t, tables["project"]["description"], "multi\nline")
+	assert.Equal(t, tables["project"]["port"], int64(8080))
+	assert.Equal(t, tables["bin"]["name"], "app")
+	// dotted and quoted keys
+	assert.Equal(t, tables["tool.poetry.dependencies"]["requests"], "^2.28")
+	assert.Equal(t, tables["tool.poetry"]["key=with=equals"], "value")
+
+	_, err = parseTOML([]byte("[packages]\nrequests = \"*\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
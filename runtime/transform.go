@@ -0,0 +1,34 @@
+package runtime
+
+import "fmt"
+
+// ContentTransform rewrites the contents of a file before it is hashed or read into changes
+// eg: to inject build metadata or strip secrets, relPath is relative to the root dir and uses forward slashes
+type ContentTransform func(relPath string, content []byte) ([]byte, error)
+
+// SetContentTransform sets the transform applied to the contents of files of the root dir
+// checksums of the state are calculated from the transformed contents, so changes of the transform are diffed as changes of files
+func (m *Manager) SetContentTransform(t ContentTransform) {
+	m.transform = t
+	// checksums cached before are of other contents
+	m.checksumsMu.Lock()
+	m.checksums = nil
+	m.checksumsMu.Unlock()
+}
+
+// reads the contents of the file in path under the root dir with the content transform applied
+func (m *Manager) readProgFile(path string) ([]byte, error) {
+	contents, err := m.readFile(path)
+	if err != nil || m.transform == nil {
+		return contents, err
+	}
+	rel, err := m.relPath(path)
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := m.transform(rel, contents)
+	if err != nil {
+		return nil, fmt.Errorf("transforming %s: %w", rel, err)
+	}
+	return transformed, nil
+}
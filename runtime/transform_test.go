@@ -0,0 +1,68 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func upperMarker(relPath string, content []byte) ([]byte, error) {
+	if relPath == "marker.txt" {
+		return bytes.ToUpper(content), nil
+	}
+	return content, nil
+}
+
+func TestContentTransform(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":    "print('hello')",
+		"marker.txt": "build: dev",
+	})
+	m.SetContentTransform(upperMarker)
+
+	sc, err := m.GetChanges()
+	assert.NilError(t, err)
+	assert.Equal(t, sc.Changes["marker.txt"], "BUILD: DEV")
+	assert.Equal(t, sc.Changes["main.py"], "print('hello')")
+
+	assert.NilError(t, m.StoreState())
+	sm, err := m.getStoredState()
+	assert.NilError(t, err)
+	assert.Equal(t, sm["marker.txt"], m.checksum([]byte("BUILD: DEV")))
+
+	// a change that does not change the transformed contents is not a change
+	writeTestFiles(t, m.rootDir, map[string]string{"marker.txt": "BUILD: dev"})
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Assert(t, sc == nil, "unexpected changes: %+v", sc)
+
+	walked := make(map[string]string)
+	err = m.WalkFiles(func(relPath string, r io.Reader) error {
+		contents, err := ioutil.ReadAll(r)
+		walked[relPath] = string(contents)
+		return err
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, walked["marker.txt"], "BUILD: DEV")
+
+	// without the transform the file changed
+	m.SetContentTransform(nil)
+	sc, err = m.GetChanges()
+	assert.NilError(t, err)
+	assert.Equal(t, sc.Changes["marker.txt"], "BUILD: dev")
+}
+
+func TestContentTransformError(t *testing.T) {
+	m := newTestManager(t, map[string]string{"main.py": "print('hello')"})
+	errSecret := errors.New("secret found")
+	m.SetContentTransform(func(relPath string, content []byte) ([]byte, error) {
+		return nil, errSecret
+	})
+	_, err := m.GetChanges()
+	assert.Assert(t, errors.Is(err, errSecret))
+	assert.ErrorContains(t, err, "transforming main.py")
+}
@@ -5,15 +5,23 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
+// readLines splits data into lines ending with \n, \r\n or \r
 func readLines(data []byte) ([]string, error) {
+	data = bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
 	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// lines longer than the default max token size are not an error
+	scanner.Buffer(nil, len(data)+1)
 
 	var lines []string
 	for scanner.Scan() {
@@ -23,6 +31,44 @@ func readLines(data []byte) ([]string, error) {
 	return lines, scanner.Err()
 }
 
+// isBlank checks if contents are empty or only whitespace
+func isBlank(contents []byte) bool {
+	return len(bytes.TrimSpace(contents)) == 0
+}
+
+// toSlash replaces the separators sep of path with forward slashes
+func toSlash(path string, sep byte) string {
+	if sep == '/' {
+		return path
+	}
+	return strings.ReplaceAll(path, string(sep), "/")
+}
+
+// relPath returns the path of abs relative to the root dir with forward slashes, as paths are stored eg: lib/utils.py
+// returns an error if abs is not in the root dir
+func (m *Manager) relPath(abs string) (string, error) {
+	rel, err := relPathFrom(m.rootDir, abs)
+	if errors.Is(err, errNotInDir) {
+		return "", fmt.Errorf("'%s' is not in the root dir", abs)
+	}
+	return rel, err
+}
+
+// errNotInDir is returned by relPathFrom for paths outside of the dir
+var errNotInDir = errors.New("not in the dir")
+
+// relPathFrom returns the path of abs relative to the dir base like relPath eg: of a file in a linked dir
+func relPathFrom(base, abs string) (string, error) {
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is %w '%s'", abs, errNotInDir, base)
+	}
+	return toSlash(rel, filepath.Separator), nil
+}
+
 // contains checks if the given string exists on given array
 func contains(arr []string, str string) bool {
 	for _, v := range arr {
@@ -34,24 +80,67 @@ func contains(arr []string, str string) bool {
 	return false
 }
 
-// checks if dir is empty
-func isDirEmpty(path string) (bool, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return false, err
+// sortedKeys returns the keys of the given map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
-	names, err := f.Readdirnames(-1)
-	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return true, nil
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedKeysOf returns the keys of the given map in sorted order
+func sortedKeysOf(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// matchGlob checks if a slash separated path matches pattern
+// pattern segments are matched with path.Match and ** matches zero or more segments eg: api/**, **/*.py
+func matchGlob(pattern, name string) (bool, error) {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// try to match the rest of the pattern at every position
+			for i := 0; i <= len(name); i++ {
+				ok, err := matchGlobSegments(pattern[1:], name[i:])
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
 		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// checks if dir is empty
+func (m *Manager) isDirEmpty(path string) (bool, error) {
+	files, err := m.fs.ReadDir(path)
+	if err != nil {
 		return false, err
 	}
-	return len(names) == 0, nil
+	return len(files) == 0, nil
 }
 
-// unzip unzips a zip file into dest skipping skipFileNames
-func unzip(zipFile []byte, dest string, skipFileNames []string) error {
+// unzip unzips a zip file into dest of fs skipping skipFileNames
+func unzip(fs FileSystem, zipFile []byte, dest string, skipFileNames []string) error {
 	// map for faster lookup later
 	skipFilesMap := make(map[string]struct{})
 	for _, name := range skipFileNames {
@@ -77,7 +166,7 @@ func unzip(zipFile []byte, dest string, skipFileNames []string) error {
 
 		// make folder if is a folder
 		if f.FileInfo().IsDir() {
-			err = os.MkdirAll(fpath, os.ModePerm)
+			err = fs.MkdirAll(fpath, os.ModePerm)
 			if err != nil {
 				return err
 			}
@@ -85,11 +174,11 @@ func unzip(zipFile []byte, dest string, skipFileNames []string) error {
 		}
 
 		// make and copy file
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		if err = fs.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
 			return err
 		}
 
-		copyDest, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		copyDest, err := fs.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
 		if err != nil {
 			return err
 		}
@@ -112,6 +201,32 @@ func unzip(zipFile []byte, dest string, skipFileNames []string) error {
 	return nil
 }
 
+// copyFile copies file from src to dest with mode creating parent dirs of dest
+func (m *Manager) copyFile(src, dest string, mode os.FileMode) error {
+	err := m.fs.MkdirAll(filepath.Dir(dest), dirPermMode)
+	if err != nil {
+		return err
+	}
+
+	srcFile, err := m.fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := m.fs.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(destFile, srcFile)
+	if err != nil {
+		destFile.Close()
+		return err
+	}
+	return destFile.Close()
+}
+
 // check if data is binary content type
 func isBinary(data []byte) bool {
 	nonBinaryPrefixes := []string{
@@ -135,3 +250,52 @@ func isBinary(data []byte) bool {
 	}
 	return true
 }
+
+// bytes of the start of a file inspected by looksBinary
+const binarySniffLen = 8 << 10
+
+// looksBinary checks if data is binary by a null byte or invalid utf-8 in the first binarySniffLen bytes
+func looksBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+		// a rune cut off at the end of the sniffed bytes is not invalid
+		for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+			if utf8.RuneStart(data[len(data)-i]) {
+				if !utf8.FullRune(data[len(data)-i:]) {
+					data = data[:len(data)-i]
+				}
+				break
+			}
+		}
+	}
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+// normalizeText converts \r\n and \r line endings of data to \n
+// and trims trailing spaces and tabs of lines if trim is set
+func normalizeText(data []byte, trim bool) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	if !trim {
+		return data
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	for i, l := range lines {
+		lines[i] = bytes.TrimRight(l, " \t")
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// createFile creates a file with contents, returns an error wrapping os.ErrExist if the file exists
+func (m *Manager) createFile(path string, contents []byte) error {
+	f, err := m.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePermMode)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(contents)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
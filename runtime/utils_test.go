@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"bytes"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -68,7 +69,7 @@ func testUnzip(t *testing.T, path, dest string, skipFileNames []string, expected
 	}
 
 	// assert no nil error
-	assert.NilError(t, unzip(fileData, dest, skipFileNames), fmt.Sprintf("unzip returned non nil error: %v", err))
+	assert.NilError(t, unzip(osFS{}, fileData, dest, skipFileNames), fmt.Sprintf("unzip returned non nil error: %v", err))
 
 	f.Close()
 
@@ -148,3 +149,56 @@ func TestUnzip(t *testing.T) {
 		testUnzip(t, filepath.Join(archiveTestDataDir, tc.archiveName), destDir, tc.skipFiles, tc.expectedContent)
 	}
 }
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"api/**", "api/main.py", true},
+		{"api/**", "api/v1/users.py", true},
+		{"api/**", "apis/main.py", false},
+		{"api/**", "main.py", false},
+		{"**/*.py", "main.py", true},
+		{"**/*.py", "lib/utils/main.py", true},
+		{"**/*.py", "lib/data.json", false},
+		{"lib/*.py", "lib/main.py", true},
+		{"lib/*.py", "lib/sub/main.py", false},
+		{"api/**/test_*.py", "api/test_users.py", true},
+		{"api/**/test_*.py", "api/v1/test_users.py", true},
+		{"main.py", "main.py", true},
+	}
+	for _, tc := range testCases {
+		match, err := matchGlob(tc.pattern, tc.name)
+		assert.NilError(t, err)
+		assert.Equal(t, match, tc.match, fmt.Sprintf("pattern %s, name %s", tc.pattern, tc.name))
+	}
+
+	_, err := matchGlob("[", "a")
+	assert.Assert(t, err != nil)
+}
+
+func TestLooksBinary(t *testing.T) {
+	assert.Assert(t, !looksBinary([]byte("plain text\n")))
+	assert.Assert(t, !looksBinary([]byte("ünïcödé ✓")))
+	assert.Assert(t, looksBinary([]byte("null\x00byte")))
+	assert.Assert(t, looksBinary([]byte{0xff, 0xfe, 'a'}))
+
+	// a rune cut off at the end of the inspected bytes is not binary
+	data := append(bytes.Repeat([]byte("a"), binarySniffLen-1), []byte("✓")...)
+	assert.Assert(t, !looksBinary(data))
+}
+
+func TestRelPath(t *testing.T) {
+	assert.Equal(t, toSlash(`lib\utils\helpers.py`, '\\'), "lib/utils/helpers.py")
+	assert.Equal(t, toSlash("lib/utils.py", '/'), "lib/utils.py")
+
+	m := newTestManager(t, map[string]string{"main.py": ""})
+	rel, err := m.relPath(filepath.Join(m.rootDir, "lib", "utils.py"))
+	assert.NilError(t, err)
+	assert.Equal(t, rel, "lib/utils.py")
+
+	_, err = m.relPath(filepath.Join(filepath.Dir(m.rootDir), "other", "main.py"))
+	assert.ErrorContains(t, err, "is not in the root dir")
+}
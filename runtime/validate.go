@@ -0,0 +1,79 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Validate checks the program for problems eg: no entrypoint, dependency files of another runtime, an unreadable state
+// all problems are returned so they can be shown at once, returns nil if there are none
+func (m *Manager) Validate() []error {
+	var errs []error
+
+	progInfo, err := m.GetProgInfo()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("reading program info: %w", err))
+	}
+
+	var runtime string
+	detected, err := m.detectRuntime()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		runtime = detected.Name
+	}
+	if progInfo != nil && progInfo.RuntimeName != "" {
+		if detected != nil && detected.Name != progInfo.RuntimeName {
+			errs = append(errs, fmt.Errorf("%w: found %s entrypoint but micro runtime is %s",
+				ErrRuntimeMismatch, detected.Name, progInfo.Runtime))
+		}
+		runtime = progInfo.RuntimeName
+	}
+
+	if runtime != "" {
+		errs = append(errs, m.validateDepFiles(runtime)...)
+	}
+
+	_, err = m.getStoredState()
+	if err != nil && (!errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrCorruptState)) {
+		errs = append(errs, fmt.Errorf("reading state: %w", err))
+	}
+	return errs
+}
+
+// checks that dependency files of other runtimes are not present without a dependency file of runtime
+// and that the deps of runtime can be read
+func (m *Manager) validateDepFiles(runtime string) []error {
+	exists, err := m.depFileExists(runtime)
+	if err != nil {
+		return []error{err}
+	}
+	if exists {
+		_, err = m.readDeps(runtime)
+		if err != nil {
+			return []error{err}
+		}
+		return nil
+	}
+
+	ignored, err := m.ignoredDepFiles(runtime)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, name := range ignored {
+		errs = append(errs, fmt.Errorf("%w: %s is a dependency file of %s but the runtime is %s", ErrDepFileMismatch, name, depFileRuntime(name), runtime))
+	}
+	return errs
+}
+
+// returns the runtime of a dependency file name of depFiles
+func depFileRuntime(name string) string {
+	for runtime, depFile := range depFiles {
+		if depFile == name {
+			return runtime
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestValidate(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "requests==2.28.0",
+	})
+	assert.Assert(t, m.Validate() == nil)
+
+	// node micro with only a python dependency file, a python entrypoint and a corrupt state
+	m = newTestManager(t, map[string]string{
+		"main.py":          "print('hello')",
+		"requirements.txt": "requests==2.28.0",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "nodejs14.x", RuntimeName: Node}))
+	assert.NilError(t, ioutil.WriteFile(m.statePath, []byte("{"), filePermMode))
+
+	errs := m.Validate()
+	assert.Equal(t, len(errs), 3)
+	assert.Assert(t, errors.Is(errs[0], ErrRuntimeMismatch))
+	assert.Assert(t, errors.Is(errs[1], ErrDepFileMismatch))
+	assert.ErrorContains(t, errs[1], "requirements.txt is a dependency file of python but the runtime is node")
+	assert.ErrorContains(t, errs[2], "reading state")
+}
+
+func TestValidateNoEntrypoint(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":  "",
+		"index.js": "",
+	})
+	errs := m.Validate()
+	assert.Equal(t, len(errs), 1)
+	assert.Assert(t, errors.Is(errs[0], ErrEntrypointConflict))
+
+	m = newTestManager(t, map[string]string{
+		"README.md":    "",
+		"package.json": "{",
+	})
+	assert.NilError(t, m.StoreProgInfo(&ProgInfo{Runtime: "nodejs14.x", RuntimeName: Node}))
+	errs = m.Validate()
+	assert.Equal(t, len(errs), 2)
+	assert.Assert(t, errors.Is(errs[0], ErrNoEntrypoint))
+	assert.Assert(t, errors.Is(errs[1], ErrInvalidDepFile))
+}
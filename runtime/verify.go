@@ -0,0 +1,92 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DriftReport compares the stored state with the files of the root dir
+// paths are relative to the root dir and use forward slashes, lists are sorted
+type DriftReport struct {
+	Matching  []string // stored files that did not change
+	Modified  []string // stored files that changed
+	Missing   []string // stored files that no longer exist
+	Untracked []string // files that are not stored
+}
+
+// IsClean checks if the stored state matches the files of the root dir
+func (d *DriftReport) IsClean() bool {
+	return len(d.Modified) == 0 && len(d.Missing) == 0 && len(d.Untracked) == 0
+}
+
+// String renders the counts of the report eg: 3 matching, 1 modified, 0 missing, 2 untracked
+func (d *DriftReport) String() string {
+	return fmt.Sprintf("%d matching, %d modified, %d missing, %d untracked",
+		len(d.Matching), len(d.Modified), len(d.Missing), len(d.Untracked))
+}
+
+// VerifyState compares every file of the stored state with the files of the root dir eg: for diagnostics
+// unlike GetChanges, contents are not read into changes and unchanged dirs are not skipped
+// files that are always uploaded match if they exist, returns an error wrapping os.ErrNotExist if no state is stored
+func (m *Manager) VerifyState() (*DriftReport, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+	storedState, err := m.getStoredState()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{}
+	unseen := m.stateKeys(storedState)
+	err = m.walk(r.Name, func(path string, info os.FileInfo) error {
+		slash, err := m.relPath(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		storedPath, ok := unseen[m.stateKey(slash)]
+		if !ok {
+			report.Untracked = append(report.Untracked, slash)
+			return nil
+		}
+		delete(unseen, m.stateKey(slash))
+
+		stored := storedState[storedPath]
+		if stored == "" {
+			report.Matching = append(report.Matching, slash)
+			return nil
+		}
+		checksum, err := m.calcChecksum(filepath.Join(m.rootDir, path))
+		if err != nil {
+			return err
+		}
+		if checksum == stored {
+			report.Matching = append(report.Matching, slash)
+		} else {
+			report.Modified = append(report.Modified, slash)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, storedPath := range unseen {
+		if isEmptyDirKey(storedPath) {
+			dir := strings.TrimSuffix(storedPath, "/")
+			if info, err := m.fs.Stat(filepath.Join(m.rootDir, filepath.FromSlash(dir))); err == nil && info.IsDir() {
+				report.Matching = append(report.Matching, storedPath)
+				continue
+			}
+		}
+		report.Missing = append(report.Missing, storedPath)
+	}
+	for _, paths := range [][]string{report.Matching, report.Modified, report.Missing, report.Untracked} {
+		sort.Strings(paths)
+	}
+	return report, nil
+}
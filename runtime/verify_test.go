@@ -0,0 +1,43 @@
+package runtime
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestVerifyState(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":      "print('hello')",
+		"lib/utils.py": "def f(): pass",
+		"lib/db.py":    "db = None",
+	})
+	_, err := m.VerifyState()
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	assert.NilError(t, m.StoreState())
+	report, err := m.VerifyState()
+	assert.NilError(t, err)
+	assert.Assert(t, report.IsClean())
+	assert.DeepEqual(t, report.Matching, []string{"lib/db.py", "lib/utils.py", "main.py"})
+
+	// drifted
+	writeTestFiles(t, m.rootDir, map[string]string{
+		"main.py": "print('changed')",
+		"new.py":  "x = 1",
+	})
+	assert.NilError(t, os.Remove(filepath.Join(m.rootDir, "lib", "db.py")))
+	report, err = m.VerifyState()
+	assert.NilError(t, err)
+	assert.Assert(t, !report.IsClean())
+	assert.DeepEqual(t, report, &DriftReport{
+		Matching:  []string{"lib/utils.py"},
+		Modified:  []string{"main.py"},
+		Missing:   []string{"lib/db.py"},
+		Untracked: []string{"new.py"},
+	})
+	assert.Equal(t, report.String(), "1 matching, 1 modified, 1 missing, 1 untracked")
+}
@@ -0,0 +1,96 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// default interval the dependency files are polled at by WatchDeps
+const defaultWatchInterval = 500 * time.Millisecond
+
+// WatchDeps watches the dependency files of the detected runtime and sends the changes of the deps
+// compared to the deps last sent, or read when watching started, on every edit that changes the deps eg: to reinstall deps
+// edits are debounced until the files are unchanged for a poll interval, edits that do not change the deps
+// eg: of comments or whitespace do not send changes, and dependency files that can not be read eg: while being written are retried on the next edit
+// the channel is closed when ctx is done
+func (m *Manager) WatchDeps(ctx context.Context) (<-chan *DepChanges, error) {
+	r, err := m.GetRuntime()
+	if err != nil {
+		return nil, err
+	}
+	if r.Name == Custom {
+		return nil, fmt.Errorf("deps of the %s runtime are installed by its %s", Custom, dockerfile)
+	}
+	last, err := m.readDeps(r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *DepChanges)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(m.watchInterval)
+		defer ticker.Stop()
+
+		stamp := m.depFilesStamp(r.Name)
+		pending := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current := m.depFilesStamp(r.Name)
+			if current != stamp {
+				// wait for the files to be unchanged for an interval
+				stamp = current
+				pending = true
+				continue
+			}
+			if !pending {
+				continue
+			}
+			pending = false
+
+			deps, err := m.readDeps(r.Name)
+			if err != nil {
+				m.debugf("reading deps while watching: %v", err)
+				continue
+			}
+			dc := DiffDeps(last, deps)
+			if dc.IsEmpty() {
+				continue
+			}
+			last = deps
+			select {
+			case ch <- dc:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// returns the sizes and modification times of the dependency files of runtime, which changes if the files are edited
+func (m *Manager) depFilesStamp(runtime string) string {
+	names := append([]string{depFiles[runtime]}, altDepFiles[runtime]...)
+	if runtime == DotNet {
+		csproj, err := m.csprojFile()
+		if err != nil || csproj == "" {
+			return ""
+		}
+		names = []string{csproj}
+	}
+	var stamp string
+	for _, name := range names {
+		info, err := m.fs.Stat(filepath.Join(m.rootDir, name))
+		if err != nil {
+			continue
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp
+}
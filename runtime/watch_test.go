@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWatchDeps(t *testing.T) {
+	m := newTestManager(t, map[string]string{
+		"main.py":          "",
+		"requirements.txt": "flask==2.0.1\n",
+	})
+	m.watchInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := m.WatchDeps(ctx)
+	assert.NilError(t, err)
+
+	// edits of comments and whitespace do not change the deps
+	writeTestFiles(t, m.rootDir, map[string]string{"requirements.txt": "# web\nflask == 2.0.1\n"})
+	select {
+	case dc := <-ch:
+		t.Fatalf("unexpected changes %+v", dc)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	writeTestFiles(t, m.rootDir, map[string]string{"requirements.txt": "# web\nflask == 2.0.1\nrequests==2.28.0\n"})
+	select {
+	case dc := <-ch:
+		assert.DeepEqual(t, dc.Added, []string{"requests==2.28.0"})
+		assert.Assert(t, len(dc.Removed) == 0)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no changes of deps")
+	}
+
+	// changes are compared to the deps last sent
+	writeTestFiles(t, m.rootDir, map[string]string{"requirements.txt": "requests==2.28.0\n"})
+	select {
+	case dc := <-ch:
+		assert.Assert(t, len(dc.Added) == 0)
+		assert.DeepEqual(t, dc.Removed, []string{"flask==2.0.1"})
+	case <-time.After(5 * time.Second):
+		t.Fatal("no changes of deps")
+	}
+
+	cancel()
+	for range ch {
+	}
+}